@@ -2,21 +2,27 @@ package main
 
 import (
 	"AdminBlockchain/handlers"
+	"AdminBlockchain/storage"
 	"AdminBlockchain/utils"
 	"bufio"
+	"flag"
 	"fmt"
 	"log"
 	"net/rpc"
 	"os"
+	"strings"
 	"time"
 )
 
 var (
-	clientKey       utils.SignatureCreator
-	clientAddress   handlers.Address
-	accountHandler  handlers.AccountHandler
-	contractHandler handlers.ContractHandler
-	client          *rpc.Client
+	clientKey        utils.SignatureCreator
+	clientAddress    handlers.Address
+	accountHandler   *handlers.AccountHandler
+	contractHandler  *handlers.ContractHandler
+	roleHandler      *handlers.RoleHandler
+	proposalHandler  *handlers.ProposalHandler
+	validatorHandler *handlers.ValidatorHandler
+	client           *rpc.Client
 )
 
 func syncClient(sync *handlers.BlockSyncHandler, rpc *handlers.RPCBlockProvider, stop chan bool) {
@@ -39,23 +45,35 @@ func stopSync(stop chan bool) {
 }
 
 func main() {
+	storageName := flag.String("storage", storage.SQLiteBackendName, "storage backend: sqlite or memory")
+	account := flag.String("account", "", "address of the client account, derived from the public key if not set. Needed after the key was rotated.")
+	keystoreDir := flag.String("keystore", "./keystore", "directory of the encrypted client keys")
+	identity := flag.String("identity", "", "name of the client key in the keystore, private.pem and public.pem are used if not set. "+
+		"The passphrase is read from "+utils.PassphraseEnv+", the file named by "+utils.PassphraseFileEnv+" or asked for.")
+	flag.Parse()
+	backend, err := storage.BackendByName(*storageName)
+	utils.LogErrorF(err)
+
 	// Prepare rpc connection
 	log.Print("Connecting...")
-	var err error
 	client, err = rpc.DialHTTP("tcp", "localhost:8900")
 	utils.LogErrorF(err)
 	defer client.Close()
 
 	// Create base handler for transactions
-	baseHandler := handlers.NewBaseHandler("./")
+	serverKey, err := utils.LoadPublicKey("./server.pem")
+	utils.LogErrorF(err)
+	baseHandler := handlers.NewBaseHandlerWithBackend(serverKey, backend)
+	// Define handlers, they replay the operations of the chain
+	accountHandler = handlers.NewAccountHandler(baseHandler)
+	contractHandler = handlers.NewContractHandler(baseHandler, accountHandler)
+	roleHandler = handlers.NewRoleHandler(baseHandler, accountHandler)
+	proposalHandler = handlers.NewProposalHandler(baseHandler, accountHandler)
+	validatorHandler = handlers.NewValidatorHandler(baseHandler, accountHandler)
+	baseHandler.Load("./")
 	defer baseHandler.Close()
-	// Define handlers
-	accountHandler = handlers.AccountHandler{BaseQueryHandler: baseHandler}
-	contractHandler = handlers.ContractHandler{BaseQueryHandler: baseHandler, Accounts: &accountHandler}
 
 	// Set up block synchronization
-	serverKey, err := utils.LoadPublicKey("./server.pem")
-	utils.LogErrorF(err)
 	blockSync := handlers.BlockSyncHandler{StorageProvider: &baseHandler.Sp, QueryHandlers: []handlers.IHandler{accountHandler}, SignValidator: serverKey}
 	blockProvider := handlers.RPCBlockProvider{Client: client}
 
@@ -64,15 +82,32 @@ func main() {
 	defer stopSync(syncChan)
 
 	// Load client keys
-	clientKey, err = utils.LoadPrivateKey("./private.pem")
-	utils.LogErrorF(err)
-	tmpKey, err := utils.LoadPublicKey("./public.pem")
-	utils.LogErrorF(err)
-	clientAddress = handlers.GetAddressFromPubKey(tmpKey)
+	var tmpKey utils.SignatureValidator
+	if *identity != "" {
+		clientKey, err = utils.LoadKeystoreKey(*keystoreDir, *identity)
+		utils.LogErrorF(err)
+		tmpKey = clientKey.PublicKey()
+	} else {
+		clientKey, err = utils.LoadPrivateKey("./private.pem")
+		utils.LogErrorF(err)
+		tmpKey, err = utils.LoadPublicKey("./public.pem")
+		utils.LogErrorF(err)
+	}
+	clientAddress, err = accountHandler.FindAddress(tmpKey)
+	if err != nil {
+		clientAddress = handlers.GetAddressFromPubKey(tmpKey)
+	}
+	if *account != "" {
+		var ok bool
+		clientAddress, ok = parseAddress(*account)
+		if !ok {
+			os.Exit(1)
+		}
+	}
 
 	// Start input loop
 	reader := bufio.NewReader(os.Stdin)
-	fmt.Print("Available commands: accounts, contracts, balance, state, help, exit\n")
+	fmt.Print("Available commands: accounts, contracts, roles, proposals, validators, pending, status, balance, state, help, exit\n")
 	var running = true
 	for running {
 		fmt.Print("> ")
@@ -87,6 +122,10 @@ func main() {
 					"    get - list all current accounts (local)\n" +
 					"    create <path to public key> <personal info> <access level> - create a new user account. By default access level is basic.\n" +
 					"    update <address> <personal info> <access level> - update data about user accountn\n" +
+					"    rotate <address> <path to public key> - replace the key of the account\n" +
+					"    disable <address> - disable the account, its signatures are rejected\n" +
+					"    enable <address> - enable a disabled account\n" +
+					"    keys <address> - list the keys the account used (local)\n" +
 					"  contracts - manage contracts\n" +
 					"    get - list all contracts\n" +
 					"    getmy - list user contracts\n" +
@@ -96,6 +135,25 @@ func main() {
 					"    start <id> - start progress on the contract\n" +
 					"    resolve <id> - resolve the contract\n" +
 					"    accept <id> <accepted> - acceptance of the contract\n" +
+					"  roles - manage roles\n" +
+					"    get - list all roles with their permissions and members (local)\n" +
+					"    getmy - list user roles (local)\n" +
+					"    grant <role> <operation> - permit the operation to the role\n" +
+					"    revoke <role> <operation> - remove the permission of the role\n" +
+					"    assign <address> <role> - give the role to the account\n" +
+					"    unassign <address> <role> - remove the role from the account\n" +
+					"  proposals - manage operations approved by several admins\n" +
+					"    get - list all proposals (local)\n" +
+					"    create <lifetime> <path to public key> <personal info> <access level> - propose a new account, open for <lifetime> blocks\n" +
+					"    update <lifetime> <address> <personal info> <access level> - propose an account update, open for <lifetime> blocks\n" +
+					"    approve <id> - approve the proposal\n" +
+					"    threshold <operation> <approvals> - set the amount of admin approvals the operation needs\n" +
+					"  validators - manage the servers producing blocks\n" +
+					"    get - list the validators in the order they take turns (local)\n" +
+					"    add <path to public key> - add the block signing key of a server\n" +
+					"    remove <address> - remove a validator\n" +
+					"  pending - lists transactions waiting for the next block\n" +
+					"  status <id> - prints the status of a submitted transaction\n" +
 					"  balance - prints users balance\n" +
 					"  state - prints the current blockchain state. (local)\n" +
 					"  help - prints this help message.\n" +
@@ -108,7 +166,7 @@ func main() {
 					item.ID,
 					fmt.Sprintf("% x", item.PrevHash),
 					fmt.Sprintf("% x", item.Hash()),
-					item.Data)
+					strings.Join(item.Transactions, "; "))
 			}
 
 		case "accounts":
@@ -117,6 +175,32 @@ func main() {
 		case "contracts":
 			handleContracts(input)
 
+		case "roles":
+			handleRoles(input)
+
+		case "proposals":
+			handleProposals(input)
+
+		case "validators":
+			handleValidators(input)
+
+		case "pending":
+			var pending []handlers.PendingTransaction
+			err := client.Call("TransactionPool.Pending", 0, &pending)
+			utils.LogError(err)
+			fmt.Print(" Transaction id   | Method                         | From\n")
+			for _, item := range pending {
+				fmt.Printf(" %14.14s ... | %-30.30s | %v\n", item.ID, item.Method, item.From)
+			}
+
+		case "status":
+			var id string
+			fmt.Sscanf(input, "status %s", &id)
+			var status handlers.TransactionStatus
+			err := client.Call("TransactionPool.Status", id, &status)
+			utils.LogError(err)
+			printStatus(status)
+
 		case "balance":
 			balance, err := contractHandler.GetBalance(clientAddress, false)
 			utils.LogError(err)
@@ -135,7 +219,7 @@ func handleAccounts(input string) {
 	switch command {
 	case "get":
 		accounts := accountHandler.ListAccounts()
-		fmt.Printf(" Address        | Personal info    | Access level\n")
+		fmt.Printf(" %-50s | Personal info    | Access level     | Key\n", "Address")
 		for _, account := range accounts {
 			var accessLvl string
 			if account.AccessLevel == handlers.BasicAccountAccess {
@@ -143,10 +227,18 @@ func handleAccounts(input string) {
 			} else {
 				accessLvl = "admin"
 			}
-			fmt.Printf(" %14.14s | %16.16s | %11.11s\n",
+			if account.Disabled {
+				accessLvl += ", disabled"
+			}
+			algorithm := "invalid"
+			if account.PubKey != nil {
+				algorithm = account.PubKey.Algorithm()
+			}
+			fmt.Printf(" %-50s | %16.16s | %16.16s | %s\n",
 				account.Address,
 				account.PersonalInfo,
-				accessLvl)
+				accessLvl,
+				algorithm)
 		}
 	case "create":
 		var pubKeyPath, personalInfo string
@@ -156,31 +248,111 @@ func handleAccounts(input string) {
 		utils.LogErrorF(err)
 		pubKeyData, err := publicKey.Store()
 		utils.LogErrorF(err)
-		signature, err := clientKey.Sign(utils.Hash(personalInfo, access, pubKeyData))
-		utils.LogErrorF(err)
+		nonce, signature, err := signRequest("AccountHandler.CreateAccount", handlers.OperationCreateAccount, personalInfo, access, pubKeyData)
+		if err != nil {
+			utils.LogError(err)
+			return
+		}
 
+		var txID string
 		err = client.Call("AccountHandler.CreateAccount", handlers.CreateAccountParams{
 			From:         clientAddress,
 			PersonalInfo: personalInfo,
 			AccessLevel:  access,
 			PubKey:       pubKeyData,
-			Signature:    signature}, nil)
-		utils.LogErrorF(err)
+			Nonce:        nonce,
+			Signature:    signature}, &txID)
+		printSubmitted(txID, err)
 
 	case "update":
 		var addressStr, personalInfo string
 		var access int
 		fmt.Sscanf(input, "accounts update %s %q %d", &addressStr, &personalInfo, &access)
-		signature, err := clientKey.Sign(utils.Hash(addressStr, personalInfo, access))
-		utils.LogErrorF(err)
+		address, ok := parseAddress(addressStr)
+		if !ok {
+			return
+		}
+		nonce, signature, err := signRequest("AccountHandler.UpdateAccount", handlers.OperationUpdateAccount, address, personalInfo, access)
+		if err != nil {
+			utils.LogError(err)
+			return
+		}
 
+		var txID string
 		err = client.Call("AccountHandler.UpdateAccount", handlers.UpdateAccountParams{
 			From:         clientAddress,
-			Account:      handlers.Address(addressStr),
+			Account:      address,
 			PersonalInfo: personalInfo,
 			AccessLevel:  access,
-			Signature:    signature}, nil)
+			Nonce:        nonce,
+			Signature:    signature}, &txID)
+		printSubmitted(txID, err)
+
+	case "rotate":
+		var addressStr, pubKeyPath string
+		fmt.Sscanf(input, "accounts rotate %s %q", &addressStr, &pubKeyPath)
+		address, ok := parseAddress(addressStr)
+		if !ok {
+			return
+		}
+		publicKey, err := utils.LoadPublicKey(pubKeyPath)
 		utils.LogErrorF(err)
+		pubKeyData, err := publicKey.Store()
+		utils.LogErrorF(err)
+		nonce, signature, err := signRequest("AccountHandler.RotateKey", handlers.OperationRotateKey, address, pubKeyData)
+		if err != nil {
+			utils.LogError(err)
+			return
+		}
+
+		var txID string
+		err = client.Call("AccountHandler.RotateKey", handlers.RotateKeyParams{
+			From:      clientAddress,
+			Account:   address,
+			PubKey:    pubKeyData,
+			Nonce:     nonce,
+			Signature: signature}, &txID)
+		printSubmitted(txID, err)
+
+	case "disable", "enable":
+		var addressStr string
+		fmt.Sscanf(input, "accounts "+command+" %s", &addressStr)
+		address, ok := parseAddress(addressStr)
+		if !ok {
+			return
+		}
+		method, operation := "AccountHandler.DisableAccount", handlers.OperationDisableAccount
+		if command == "enable" {
+			method, operation = "AccountHandler.EnableAccount", handlers.OperationEnableAccount
+		}
+		nonce, signature, err := signRequest(method, operation, address)
+		if err != nil {
+			utils.LogError(err)
+			return
+		}
+
+		var txID string
+		err = client.Call(method, handlers.AccountStateParams{
+			From:      clientAddress,
+			Account:   address,
+			Nonce:     nonce,
+			Signature: signature}, &txID)
+		printSubmitted(txID, err)
+
+	case "keys":
+		var addressStr string
+		fmt.Sscanf(input, "accounts keys %s", &addressStr)
+		address, ok := parseAddress(addressStr)
+		if !ok {
+			return
+		}
+		var history []handlers.AccountKey
+		err := accountHandler.KeyHistory(address, &history)
+		utils.LogError(err)
+		fmt.Printf(" Since  | Until  | Algorithm  | Key hash\n")
+		for _, key := range history {
+			fmt.Printf(" %6d | %6d | %-10s | %x\n", key.Since, key.Until, key.Algorithm, utils.Hash(key.PubKey)[:8])
+		}
 	}
 }
 
@@ -200,89 +372,324 @@ func handleContracts(input string) {
 		var Assignee, ContractInfo string
 		var Reward int
 		fmt.Sscanf(input, "contracts create %q %q %d", &Assignee, &ContractInfo, &Reward)
-		signature, err := clientKey.Sign(utils.Hash(Assignee, ContractInfo, Reward))
-		utils.LogErrorF(err)
-		var contractID int64
+		assignee, ok := parseAddress(Assignee)
+		if !ok {
+			return
+		}
+		nonce, signature, err := signRequest("ContractHandler.Create", handlers.OperationCreateContract, assignee, ContractInfo, Reward)
+		if err != nil {
+			utils.LogError(err)
+			return
+		}
+		var txID string
 		err = client.Call("ContractHandler.Create", handlers.CreateContractParams{
 			From:         clientAddress,
-			Assignee:     handlers.Address(Assignee),
+			Assignee:     assignee,
 			ContractInfo: ContractInfo,
 			Reward:       Reward,
-			Signature:    signature}, &contractID)
-		utils.LogError(err)
-		if err == nil {
-			fmt.Printf("Contract created - %v", contractID)
-		}
+			Nonce:        nonce,
+			Signature:    signature}, &txID)
+		printSubmitted(txID, err)
 
 	case "update":
 		var Assignee, ContractInfo string
 		var Reward int
 		var ID int64
 		fmt.Sscanf(input, "contracts update %d %q %q %d", &ID, &Assignee, &ContractInfo, &Reward)
-		signature, err := clientKey.Sign(utils.Hash(ID, Assignee, ContractInfo, Reward))
-		utils.LogErrorF(err)
-		var tmp bool
+		assignee, ok := parseAddress(Assignee)
+		if !ok {
+			return
+		}
+		nonce, signature, err := signRequest("ContractHandler.Update", handlers.OperationUpdateContract, ID, assignee, ContractInfo, Reward)
+		if err != nil {
+			utils.LogError(err)
+			return
+		}
+		var txID string
 		err = client.Call("ContractHandler.Update", handlers.UpdateContractParams{
 			ContractID:   ID,
 			From:         clientAddress,
-			Assignee:     handlers.Address(Assignee),
+			Assignee:     assignee,
 			ContractInfo: ContractInfo,
 			Reward:       Reward,
-			Signature:    signature}, &tmp)
-		utils.LogError(err)
+			Nonce:        nonce,
+			Signature:    signature}, &txID)
+		printSubmitted(txID, err)
 
 	case "sign":
 		var ID int64
 		fmt.Sscanf(input, "contracts sign %d", &ID)
-		signature, err := clientKey.Sign(utils.Hash(ID))
-		utils.LogErrorF(err)
-		var tmp bool
+		nonce, signature, err := signRequest("ContractHandler.Sign", handlers.OperationSignContract, ID)
+		if err != nil {
+			utils.LogError(err)
+			return
+		}
+		var txID string
 		err = client.Call("ContractHandler.Sign", handlers.ContractStateParams{
 			ContractID: ID,
 			From:       clientAddress,
-			Signature:  signature}, &tmp)
-		utils.LogError(err)
+			Nonce:      nonce,
+			Signature:  signature}, &txID)
+		printSubmitted(txID, err)
 
 	case "start":
 		var ID int64
 		fmt.Sscanf(input, "contracts start %d", &ID)
-		signature, err := clientKey.Sign(utils.Hash(ID))
-		utils.LogErrorF(err)
-		var tmp bool
+		nonce, signature, err := signRequest("ContractHandler.StartProgress", handlers.OperationStartContract, ID)
+		if err != nil {
+			utils.LogError(err)
+			return
+		}
+		var txID string
 		err = client.Call("ContractHandler.StartProgress", handlers.ContractStateParams{
 			ContractID: ID,
 			From:       clientAddress,
-			Signature:  signature}, &tmp)
-		utils.LogError(err)
+			Nonce:      nonce,
+			Signature:  signature}, &txID)
+		printSubmitted(txID, err)
 
 	case "resolve":
 		var ID int64
 		fmt.Sscanf(input, "contracts resolve %d", &ID)
-		signature, err := clientKey.Sign(utils.Hash(ID))
-		utils.LogErrorF(err)
-		var tmp bool
+		nonce, signature, err := signRequest("ContractHandler.Resolve", handlers.OperationResolveContract, ID)
+		if err != nil {
+			utils.LogError(err)
+			return
+		}
+		var txID string
 		err = client.Call("ContractHandler.Resolve", handlers.ContractStateParams{
 			ContractID: ID,
 			From:       clientAddress,
-			Signature:  signature}, &tmp)
-		utils.LogError(err)
+			Nonce:      nonce,
+			Signature:  signature}, &txID)
+		printSubmitted(txID, err)
 
 	case "accept":
 		var ID int64
 		var success bool
 		fmt.Sscanf(input, "contracts accept %d %t", &ID, &success)
-		signature, err := clientKey.Sign(utils.Hash(ID, success))
-		utils.LogErrorF(err)
-		var tmp bool
+		nonce, signature, err := signRequest("ContractHandler.Acceptance", handlers.OperationAcceptContract, ID, success)
+		if err != nil {
+			utils.LogError(err)
+			return
+		}
+		var txID string
 		err = client.Call("ContractHandler.Acceptance", handlers.ContractAcceptanceParams{
 			ContractID: ID,
 			From:       clientAddress,
 			Success:    success,
-			Signature:  signature}, &tmp)
+			Nonce:      nonce,
+			Signature:  signature}, &txID)
+		printSubmitted(txID, err)
+	}
+}
+
+func handleRoles(input string) {
+	var command string
+	fmt.Sscanf(input, "roles %s", &command)
+	switch command {
+	case "get":
+		roles, err := roleHandler.ListRoles()
+		utils.LogError(err)
+		fmt.Printf(" Role             | Operations                               | Members\n")
+		for _, role := range roles {
+			fmt.Printf(" %-16.16s | %-40.40s | %v\n", role.Name, strings.Join(role.Operations, ", "), role.Members)
+		}
+	case "getmy":
+		roles, err := roleHandler.GetRolesOfAccount(clientAddress)
 		utils.LogError(err)
+		fmt.Printf("Roles of user %v: %v\n", clientAddress, append([]string{handlers.RoleEveryone}, roles...))
+	case "grant", "revoke":
+		var role, operation string
+		fmt.Sscanf(input, "roles "+command+" %s %s", &role, &operation)
+		method, tag := "RoleHandler.Grant", handlers.OperationGrantPermission
+		if command == "revoke" {
+			method, tag = "RoleHandler.Revoke", handlers.OperationRevokePermission
+		}
+		nonce, signature, err := signRequest(method, tag, role, operation)
+		if err != nil {
+			utils.LogError(err)
+			return
+		}
+		var txID string
+		err = client.Call(method, handlers.PermissionParams{
+			From:      clientAddress,
+			Role:      role,
+			Operation: operation,
+			Nonce:     nonce,
+			Signature: signature}, &txID)
+		printSubmitted(txID, err)
+	case "assign", "unassign":
+		var addressStr, role string
+		fmt.Sscanf(input, "roles "+command+" %s %s", &addressStr, &role)
+		address, ok := parseAddress(addressStr)
+		if !ok {
+			return
+		}
+		method, tag := "RoleHandler.Assign", handlers.OperationAssignRole
+		if command == "unassign" {
+			method, tag = "RoleHandler.Unassign", handlers.OperationUnassignRole
+		}
+		nonce, signature, err := signRequest(method, tag, address, role)
+		if err != nil {
+			utils.LogError(err)
+			return
+		}
+		var txID string
+		err = client.Call(method, handlers.RoleParams{
+			From:      clientAddress,
+			Account:   address,
+			Role:      role,
+			Nonce:     nonce,
+			Signature: signature}, &txID)
+		printSubmitted(txID, err)
 	}
 }
 
+func handleValidators(input string) {
+	var command string
+	fmt.Sscanf(input, "validators %s", &command)
+	switch command {
+	case "get":
+		validators, err := validatorHandler.ListValidators()
+		utils.LogError(err)
+		fmt.Printf(" Turn | %-50s | %-10s | Since\n", "Address", "Algorithm")
+		for i, validator := range validators {
+			fmt.Printf(" %-4d | %-50s | %-10s | %d\n", i, validator.Address, validator.PubKey.Algorithm(), validator.Since)
+		}
+	case "add":
+		var pubKeyPath string
+		fmt.Sscanf(input, "validators add %q", &pubKeyPath)
+		publicKey, err := utils.LoadPublicKey(pubKeyPath)
+		if err != nil {
+			utils.LogError(err)
+			return
+		}
+		pubKeyData, err := publicKey.Store()
+		utils.LogErrorF(err)
+		nonce, signature, err := signRequest("ValidatorHandler.AddValidator", handlers.OperationAddValidator, pubKeyData)
+		if err != nil {
+			utils.LogError(err)
+			return
+		}
+		var txID string
+		err = client.Call("ValidatorHandler.AddValidator", handlers.ValidatorParams{
+			From:      clientAddress,
+			PubKey:    pubKeyData,
+			Nonce:     nonce,
+			Signature: signature}, &txID)
+		printSubmitted(txID, err)
+	case "remove":
+		var addressStr string
+		fmt.Sscanf(input, "validators remove %s", &addressStr)
+		address, ok := parseAddress(addressStr)
+		if !ok {
+			return
+		}
+		nonce, signature, err := signRequest("ValidatorHandler.RemoveValidator", handlers.OperationRemoveValidator, address)
+		if err != nil {
+			utils.LogError(err)
+			return
+		}
+		var txID string
+		err = client.Call("ValidatorHandler.RemoveValidator", handlers.ValidatorParams{
+			From:      clientAddress,
+			Validator: address,
+			Nonce:     nonce,
+			Signature: signature}, &txID)
+		printSubmitted(txID, err)
+	}
+}
+
+func handleProposals(input string) {
+	var command string
+	fmt.Sscanf(input, "proposals %s", &command)
+	switch command {
+	case "get":
+		proposals, err := proposalHandler.ListProposals()
+		utils.LogError(err)
+		fmt.Printf(" ID | Operation          | Proposer       | Deadline | Status | Approvals\n")
+		for _, item := range proposals {
+			fmt.Printf(" %2.d | %-18.18s | %14.14s | %8d | %6d | %v %v\n",
+				item.ID,
+				item.Operation,
+				item.Proposer,
+				item.Deadline,
+				item.Status,
+				item.Approvals,
+				item.Error)
+		}
+	case "create":
+		var lifetime, access int
+		var pubKeyPath, personalInfo string
+		fmt.Sscanf(input, "proposals create %d %q %q %d", &lifetime, &pubKeyPath, &personalInfo, &access)
+		publicKey, err := utils.LoadPublicKey(pubKeyPath)
+		utils.LogErrorF(err)
+		pubKeyData, err := publicKey.Store()
+		utils.LogErrorF(err)
+		propose(handlers.OperationCreateAccount, lifetime, personalInfo, access, pubKeyData)
+	case "update":
+		var lifetime, access int
+		var addressStr, personalInfo string
+		fmt.Sscanf(input, "proposals update %d %s %q %d", &lifetime, &addressStr, &personalInfo, &access)
+		address, ok := parseAddress(addressStr)
+		if !ok {
+			return
+		}
+		propose(handlers.OperationUpdateAccount, lifetime, string(address), personalInfo, access)
+	case "approve":
+		var ID int64
+		fmt.Sscanf(input, "proposals approve %d", &ID)
+		nonce, signature, err := signRequest("ProposalHandler.Approve", handlers.OperationApprove, ID)
+		if err != nil {
+			utils.LogError(err)
+			return
+		}
+		var txID string
+		err = client.Call("ProposalHandler.Approve", handlers.ApproveParams{
+			ProposalID: ID,
+			From:       clientAddress,
+			Nonce:      nonce,
+			Signature:  signature}, &txID)
+		printSubmitted(txID, err)
+	case "threshold":
+		var operation string
+		var threshold int
+		fmt.Sscanf(input, "proposals threshold %s %d", &operation, &threshold)
+		nonce, signature, err := signRequest("ProposalHandler.SetThreshold", handlers.OperationSetThreshold, operation, threshold)
+		if err != nil {
+			utils.LogError(err)
+			return
+		}
+		var txID string
+		err = client.Call("ProposalHandler.SetThreshold", handlers.ThresholdParams{
+			From:      clientAddress,
+			Operation: operation,
+			Threshold: threshold,
+			Nonce:     nonce,
+			Signature: signature}, &txID)
+		printSubmitted(txID, err)
+	}
+}
+
+// propose submits a proposal of the operation, signed by the client as the first approval
+func propose(operation string, lifetime int, params ...interface{}) {
+	nonce, signature, err := signRequest("ProposalHandler.Propose", handlers.OperationPropose, append([]interface{}{operation, lifetime}, params...)...)
+	if err != nil {
+		utils.LogError(err)
+		return
+	}
+	var txID string
+	err = client.Call("ProposalHandler.Propose", handlers.ProposeParams{
+		From:      clientAddress,
+		Operation: operation,
+		Params:    params,
+		Lifetime:  lifetime,
+		Nonce:     nonce,
+		Signature: signature}, &txID)
+	printSubmitted(txID, err)
+}
+
 func printContracts(contracts []handlers.Contract) {
 	fmt.Printf(" ID | Reporter       | Assignee         | Info             | Status | Reward \n")
 	for _, item := range contracts {
@@ -295,3 +702,57 @@ func printContracts(contracts []handlers.Contract) {
 			item.Reward)
 	}
 }
+
+func printSubmitted(txID string, err error) {
+	utils.LogError(err)
+	if err == nil {
+		fmt.Printf("Transaction submitted - %v\n", txID)
+	}
+}
+
+func printStatus(status handlers.TransactionStatus) {
+	switch status.State {
+	case handlers.TransactionPending:
+		fmt.Printf("Transaction %v is pending\n", status.ID)
+	case handlers.TransactionCommitted:
+		fmt.Printf("Transaction %v is committed in block %d\n", status.ID, status.BlockID)
+	case handlers.TransactionRejected:
+		fmt.Printf("Transaction %v was rejected: %v\n", status.ID, status.Error)
+	default:
+		fmt.Printf("Transaction %v is unknown\n", status.ID)
+	}
+}
+
+// parseAddress validates an address typed by the user, the reason is printed if it is invalid
+func parseAddress(text string) (handlers.Address, bool) {
+	address, err := handlers.ParseAddress(text)
+	if err != nil {
+		fmt.Printf("Invalid address %q: %v\n", text, err)
+		return "", false
+	}
+	return address, true
+}
+
+// signRequest signs the operation for the rpc method with the next nonce of the client. The signature is only
+// valid on the chain the client is synchronized with.
+func signRequest(method string, operation string, params ...interface{}) (uint64, []byte, error) {
+	chainID, err := accountHandler.ChainID()
+	if err != nil {
+		return 0, nil, fmt.Errorf("the chain isn't synchronized yet: %v", err)
+	}
+	nonce := nextNonce()
+	payload, err := handlers.SignedPayload(chainID, method, operation, nonce, params...)
+	if err != nil {
+		return 0, nil, err
+	}
+	signature, err := clientKey.Sign(payload)
+	return nonce, signature, err
+}
+
+// nextNonce asks the server for the nonce of the next operation signed by the client
+func nextNonce() uint64 {
+	var nonce uint64
+	err := client.Call("AccountHandler.NextNonce", clientAddress, &nonce)
+	utils.LogError(err)
+	return nonce
+}
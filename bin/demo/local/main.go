@@ -1,7 +1,7 @@
 package main
 
 import (
-	"AdminBlockchain/handlers"
+	"AdminBlockchain/handlers/sample"
 	"bufio"
 	"fmt"
 	"log"
@@ -11,7 +11,7 @@ import (
 
 func main() {
 	reader := bufio.NewReader(os.Stdin)
-	handler := handlers.NewSimpleHandler("./")
+	handler := sample.NewSimpleHandler("./")
 	defer handler.Close()
 
 	fmt.Print("Available commands: query, execute, state, help, exit\n")
@@ -38,14 +38,14 @@ func main() {
 					item.ID,
 					fmt.Sprintf("% x", item.PrevHash),
 					fmt.Sprintf("% x", item.Hash()),
-					item.Data)
+					strings.Join(item.Transactions, "; "))
 			}
 
 		case "query":
 			var query string
 			fmt.Sscanf(input, "query%q", &query)
-			var resp handlers.SimpleHandlerResponce
-			err := handler.ExecuteQuery(handlers.SimpleHandlerRequest{Query: query, Params: []interface{}{}}, &resp)
+			var resp sample.SimpleHandlerResponce
+			err := handler.ExecuteQuery(sample.SimpleHandlerRequest{Query: query, Params: []interface{}{}}, &resp)
 			if err == nil {
 				printTable(resp)
 			} else {
@@ -56,7 +56,7 @@ func main() {
 			var query string
 			fmt.Sscanf(input, "execute%q", &query)
 			var success bool
-			err := handler.ExecuteTransaction(handlers.SimpleHandlerRequest{Query: query, Params: []interface{}{}}, &success)
+			err := handler.ExecuteTransaction(sample.SimpleHandlerRequest{Query: query, Params: []interface{}{}}, &success)
 			if err != nil {
 				log.Fatal(err)
 			}
@@ -69,7 +69,7 @@ func main() {
 
 }
 
-func printTable(resp handlers.SimpleHandlerResponce) {
+func printTable(resp sample.SimpleHandlerResponce) {
 	fmt.Printf("%v\n", strings.Join(resp.Columns, "\t|"))
 	for _, row := range resp.Rows {
 		fmt.Printf("%v\n", strings.Join(row, "\t|"))
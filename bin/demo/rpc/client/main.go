@@ -75,7 +75,7 @@ func main() {
 					item.ID,
 					fmt.Sprintf("% x", item.PrevHash),
 					fmt.Sprintf("% x", item.Hash()),
-					item.Data)
+					strings.Join(item.Transactions, "; "))
 			}
 
 		case "query":
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"AdminBlockchain/handlers"
+	"AdminBlockchain/utils"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+)
+
+func main() {
+	keystoreDir := flag.String("keystore", "./keystore", "directory of the encrypted keys")
+	algorithm := flag.String("algorithm", utils.KeyAlgorithmEd25519,
+		"algorithm of generated keys: "+utils.KeyAlgorithmEd25519+", "+utils.KeyAlgorithmECDSAP256+" or "+utils.KeyAlgorithmRSA)
+	out := flag.String("out", "", "file the exported public key is written to, printed if not set")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr,
+			"Usage: keys [flags] <command>\n"+
+				"Commands:\n"+
+				"  generate <name> - creates a new key and stores it in the keystore\n"+
+				"  import <name> <path to private key> - stores an existing PEM encoded private key in the keystore\n"+
+				"  export <name> - writes the PEM encoded public key, e.g. as public.pem for the server or server.pem for clients\n"+
+				"  address <name or path to public key> - prints the account address of the key\n"+
+				"  list - lists the keys in the keystore\n"+
+				"The passphrase is read from "+utils.PassphraseEnv+", the file named by "+utils.PassphraseFileEnv+" or asked for.\n"+
+				"Flags:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	ks, err := utils.OpenKeystore(*keystoreDir)
+	utils.LogErrorF(err)
+	name := flag.Arg(1)
+
+	switch flag.Arg(0) {
+	case "generate":
+		requireArgs(2)
+		key, err := utils.GenerateKey(*algorithm)
+		utils.LogErrorF(err)
+		storeKey(ks, name, key)
+
+	case "import":
+		requireArgs(3)
+		key, err := utils.LoadPrivateKey(flag.Arg(2))
+		utils.LogErrorF(err)
+		storeKey(ks, name, key)
+
+	case "export":
+		requireArgs(2)
+		key, err := ks.PublicKey(name)
+		utils.LogErrorF(err)
+		data, err := utils.EncodePublicKey(key)
+		utils.LogErrorF(err)
+		if *out == "" {
+			fmt.Print(string(data))
+		} else {
+			utils.LogErrorF(ioutil.WriteFile(*out, data, 0644))
+		}
+
+	case "address":
+		requireArgs(2)
+		var key utils.SignatureValidator
+		if _, statErr := os.Stat(name); statErr == nil {
+			key, err = utils.LoadPublicKey(name)
+		} else {
+			key, err = ks.PublicKey(name)
+		}
+		utils.LogErrorF(err)
+		fmt.Println(handlers.GetAddressFromPubKey(key))
+
+	case "list":
+		names, err := ks.List()
+		utils.LogErrorF(err)
+		fmt.Printf(" %-16s | %-10s | Address\n", "Name", "Algorithm")
+		for _, name := range names {
+			key, err := ks.PublicKey(name)
+			if err != nil {
+				log.Printf("%v: %v", name, err)
+				continue
+			}
+			fmt.Printf(" %-16s | %-10s | %v\n", name, key.Algorithm(), handlers.GetAddressFromPubKey(key))
+		}
+
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+// storeKey encrypts the key with a new passphrase and prints the address of the identity
+func storeKey(ks *utils.Keystore, name string, key utils.SignatureCreator) {
+	passphrase, err := utils.ReadNewPassphrase(fmt.Sprintf("Passphrase of %s: ", name))
+	utils.LogErrorF(err)
+	utils.LogErrorF(ks.Store(name, key, passphrase))
+	fmt.Printf("Stored %s key %s with address %v\n", key.PublicKey().Algorithm(), name, handlers.GetAddressFromPubKey(key.PublicKey()))
+}
+
+func requireArgs(count int) {
+	if flag.NArg() != count {
+		flag.Usage()
+		os.Exit(2)
+	}
+}
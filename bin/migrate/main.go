@@ -0,0 +1,53 @@
+package main
+
+import (
+	"AdminBlockchain/handlers"
+	"AdminBlockchain/storage"
+	"AdminBlockchain/utils"
+	"flag"
+	"io/ioutil"
+	"log"
+)
+
+func main() {
+	path := flag.String("path", "./", "directory holding blockchain.db")
+	keyPath := flag.String("key", "./private.pem", "private key of the block producer, used to sign rehashed blocks")
+	keystoreDir := flag.String("keystore", "./keystore", "directory of the encrypted keys")
+	identity := flag.String("identity", "", "name of the block producer key in the keystore, replaces -key")
+	flag.Parse()
+
+	var key utils.SignatureCreator
+	var err error
+	if *identity != "" {
+		key, err = utils.LoadKeystoreKey(*keystoreDir, *identity)
+	} else {
+		key, err = utils.LoadPrivateKey(*keyPath)
+	}
+	utils.LogErrorF(err)
+
+	// keep a copy of the original chain, the migration can't be undone
+	chainDbPath := *path + "/blockchain.db"
+	data, err := ioutil.ReadFile(chainDbPath)
+	utils.LogErrorF(err)
+	err = ioutil.WriteFile(chainDbPath+".bak", data, 0600)
+	utils.LogErrorF(err)
+
+	var sp storage.Provider
+	sp.LoadChain(*path)
+	defer sp.ChainStore.Close()
+
+	if sp.ChainVersion >= storage.CanonicalBlockVersion {
+		log.Printf("The chain already uses block version %d, nothing to migrate.", sp.ChainVersion)
+		return
+	}
+
+	migrated, err := storage.MigrateChain(sp.Chain, key, string(handlers.GetAddressFromPubKey(key.PublicKey())))
+	utils.LogErrorF(err)
+	if !migrated.IsValid(key.PublicKey()) {
+		log.Fatal("The migrated chain is invalid.")
+	}
+
+	err = sp.ReplaceChain(migrated)
+	utils.LogErrorF(err)
+	log.Printf("Migrated %d blocks to block version %d. Clients have to sync the chain again.", len(migrated), storage.CanonicalBlockVersion)
+}
@@ -3,14 +3,21 @@ package main
 import (
 	"AdminBlockchain/handlers"
 	"AdminBlockchain/network"
+	"AdminBlockchain/storage"
 	"AdminBlockchain/utils"
+	"flag"
+	"log"
+	"net/rpc"
 	"os"
 	"os/signal"
+	"strings"
+	"time"
 )
 
 var (
 	np          network.ServerNetworkProvider
 	baseHandler *handlers.BaseQueryHandler
+	producer    handlers.BlockProducer
 )
 
 func handleStop() {
@@ -19,32 +26,135 @@ func handleStop() {
 	<-sigchan
 
 	np.Stop()
+	producer.Stop()
 	baseHandler.Close()
 
 	os.Exit(0)
 }
 
-func main() {
-	np = network.NewServerProvider()
-	baseHandler = handlers.NewBaseHandler("./")
+// syncPeer appends the blocks produced by another validator, the peer is dialed every round so restarts are picked up
+func syncPeer(sync *handlers.BlockSyncHandler, address string) {
+	for {
+		client, err := rpc.DialHTTP("tcp", address)
+		if err == nil {
+			err = sync.Sync(&handlers.RPCBlockProvider{Client: client})
+			client.Close()
+		}
+		if err != nil {
+			log.Printf("Peer %s: %v", address, err)
+			time.Sleep(handlers.DefaultBlockInterval)
+			continue
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// setupModules creates or upgrades the state of the handlers once the node is the validator in turn
+func setupModules() {
+	err := baseHandler.SetupModules()
+	for err == handlers.ErrNotInTurn {
+		time.Sleep(time.Second)
+		err = baseHandler.SetupModules()
+	}
+	utils.LogErrorF(err)
+}
 
-	key, err := utils.LoadPrivateKey("./private.pem")
+func main() {
+	storageName := flag.String("storage", storage.SQLiteBackendName, "storage backend: sqlite or memory")
+	chainID := flag.String("chain-id", "", "id of a new chain, client signatures are only valid on it. A random id is created if not set.")
+	keystoreDir := flag.String("keystore", "./keystore", "directory of the encrypted server keys")
+	identity := flag.String("identity", "", "name of the block signing key in the keystore, private.pem is used if not set. "+
+		"The passphrase is read from "+utils.PassphraseEnv+", the file named by "+utils.PassphraseFileEnv+" or asked for.")
+	signerSocket := flag.String("signer", "", "unix socket of a signer daemon holding the block signing key, replaces -identity")
+	port := flag.String("port", "8900", "rpc port of the server")
+	peers := flag.String("peers", "", "comma separated addresses (host:port) of the other validators, their blocks are synchronized")
+	producerKey := flag.String("producer", "", "public key of the server producing the chain before it had validators, the block signing key if not set")
+	flag.Parse()
+	backend, err := storage.BackendByName(*storageName)
 	utils.LogErrorF(err)
-	var blockHandler = handlers.BlockPropagationHandler{Storage: &baseHandler.Sp, Signer: key}
 
-	accHandler := handlers.AccountHandler{BaseQueryHandler: baseHandler}
-	contractHandler := handlers.ContractHandler{BaseQueryHandler: baseHandler, Accounts: &accHandler}
+	np = network.NewServerProvider()
+	var key utils.SignatureCreator
+	if *signerSocket != "" {
+		key, err = network.DialSigner(*signerSocket)
+	} else if *identity != "" {
+		key, err = utils.LoadKeystoreKey(*keystoreDir, *identity)
+	} else {
+		key, err = utils.LoadPrivateKey("./private.pem")
+	}
+	utils.LogErrorF(err)
 
-	if len(baseHandler.Sp.Chain) == 0 {
-		key, err := utils.LoadPublicKey("./public.pem")
+	producerPubKey := key.PublicKey()
+	if *producerKey != "" {
+		producerPubKey, err = utils.LoadPublicKey(*producerKey)
 		utils.LogErrorF(err)
-		accHandler.Genesis(key)
-		contractHandler.Genesis()
 	}
 
-	np.RegisterHandler(&accHandler)
-	np.RegisterHandler(&contractHandler)
+	baseHandler = handlers.NewBaseHandlerWithBackend(producerPubKey, backend)
+	baseHandler.SetSigner(key)
+	baseHandler.Sp.SnapshotInterval = 100
+	baseHandler.Sp.SnapshotsKept = 3
+	var blockHandler = handlers.BlockPropagationHandler{Storage: &baseHandler.Sp, Lock: baseHandler.Locker()}
+	if *signerSocket == "" {
+		// the signer daemon only signs block headers, legacy blocks are served unsigned then
+		blockHandler.Signer = key
+	}
+
+	accHandler := handlers.NewAccountHandler(baseHandler)
+	contractHandler := handlers.NewContractHandler(baseHandler, accHandler)
+	roleHandler := handlers.NewRoleHandler(baseHandler, accHandler)
+	proposalHandler := handlers.NewProposalHandler(baseHandler, accHandler)
+	validatorHandler := handlers.NewValidatorHandler(baseHandler, accHandler)
+	baseHandler.Load("./")
+
+	// blocks of the other validators are synchronized before the node produces blocks itself
+	for _, peer := range strings.Split(*peers, ",") {
+		if peer = strings.TrimSpace(peer); peer == "" {
+			continue
+		}
+		sync := &handlers.BlockSyncHandler{
+			StorageProvider: &baseHandler.Sp,
+			QueryHandlers:   []handlers.IHandler{baseHandler},
+			SignValidator:   producerPubKey,
+			Lock:            baseHandler.Locker(),
+		}
+		client, err := rpc.DialHTTP("tcp", peer)
+		if err == nil {
+			err = sync.Sync(&handlers.RPCBlockProvider{Client: client})
+			client.Close()
+		}
+		if err != nil && len(baseHandler.Sp.Chain) == 0 {
+			// a new chain would be created instead of joining the chain of the peers
+			log.Fatalf("Peer %s: %v", peer, err)
+		}
+		if err != nil {
+			log.Printf("Peer %s: %v", peer, err)
+		}
+		go syncPeer(sync, peer)
+	}
+
+	// create or upgrade the state of the handlers, the changes are stored on the chain
+	adminKey, err := utils.LoadPublicKey("./public.pem")
+	utils.LogErrorF(err)
+	baseHandler.RegisterModule(handlers.ChainModule(*chainID))
+	baseHandler.RegisterModule(accHandler.Module(adminKey))
+	baseHandler.RegisterModule(contractHandler.Module())
+	baseHandler.RegisterModule(roleHandler.Module())
+	baseHandler.RegisterModule(proposalHandler.Module())
+	baseHandler.RegisterModule(validatorHandler.Module(producerPubKey))
+	setupModules()
+
+	baseHandler.Pool = handlers.NewTransactionPool(baseHandler)
+	producer = handlers.BlockProducer{Pool: baseHandler.Pool, Interval: handlers.DefaultBlockInterval}
+	producer.Start()
+
+	np.RegisterHandler(accHandler)
+	np.RegisterHandler(contractHandler)
+	np.RegisterHandler(roleHandler)
+	np.RegisterHandler(proposalHandler)
+	np.RegisterHandler(validatorHandler)
 	np.RegisterHandler(&blockHandler)
+	np.RegisterHandler(baseHandler.Pool)
 	go handleStop()
-	np.Start("", "8900")
+	np.Start("", *port)
 }
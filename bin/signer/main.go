@@ -0,0 +1,46 @@
+package main
+
+import (
+	"AdminBlockchain/handlers"
+	"AdminBlockchain/network"
+	"AdminBlockchain/utils"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+)
+
+// Signer daemon, holds the block signing key of a server in a separate process.
+// The server connects to it with the -signer flag, only block headers above the last signed block are signed.
+func main() {
+	socket := flag.String("socket", "./signer.sock", "unix socket the daemon listens on")
+	state := flag.String("state", "./signer.state", "file keeping the last signed block height, remove it only when the chain is reset")
+	keystoreDir := flag.String("keystore", "./keystore", "directory of the encrypted keys")
+	identity := flag.String("identity", "", "name of the block signing key in the keystore, private.pem is used if not set. "+
+		"The passphrase is read from "+utils.PassphraseEnv+", the file named by "+utils.PassphraseFileEnv+" or asked for.")
+	flag.Parse()
+
+	var key utils.SignatureCreator
+	var err error
+	if *identity != "" {
+		key, err = utils.LoadKeystoreKey(*keystoreDir, *identity)
+	} else {
+		key, err = utils.LoadPrivateKey("./private.pem")
+	}
+	utils.LogErrorF(err)
+
+	service, err := network.NewSignerService(key, *state)
+	utils.LogErrorF(err)
+	listener, err := network.ListenSigner(*socket)
+	utils.LogErrorF(err)
+	go func() {
+		sigchan := make(chan os.Signal, 1)
+		signal.Notify(sigchan, os.Interrupt)
+		<-sigchan
+		listener.Close()
+	}()
+
+	log.Printf("Signing blocks of producer %v on %v", handlers.GetAddressFromPubKey(key.PublicKey()), *socket)
+	err = network.ServeSigner(listener, service)
+	log.Print(err)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"AdminBlockchain/storage"
+	"AdminBlockchain/utils"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+func main() {
+	path := flag.String("path", "./", "directory holding blockchain.db and storage.db")
+	keep := flag.Int("keep", 3, "amount of snapshots kept by prune")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr,
+			"Usage: snapshot [flags] <command>\n"+
+				"Commands:\n"+
+				"  create - takes a snapshot of the current state\n"+
+				"  list - lists snapshots and checks them against the chain\n"+
+				"  prune - removes all but the newest snapshots\n"+
+				"Flags:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	var sp storage.Provider
+	sp.LoadChain(*path)
+	defer sp.ChainStore.Close()
+
+	switch flag.Arg(0) {
+	case "create":
+		utils.LogErrorF(sp.OpenState(false))
+		defer sp.StateDb.Close()
+		info, found, err := storage.ReadStateInfo(&sp.StateDb)
+		utils.LogErrorF(err)
+		if !found || !info.Matches(sp.Chain) {
+			log.Fatal("The state database doesn't match the chain, start the node to reconcile it first.")
+		}
+
+		snapshot, err := sp.CreateSnapshot()
+		utils.LogErrorF(err)
+		fmt.Printf("Created snapshot %v at block height %d\n", snapshot.Path, snapshot.Height)
+
+	case "list":
+		snapshots, err := storage.ListSnapshots(sp.SnapshotDir())
+		utils.LogErrorF(err)
+		fmt.Print(" Height     | Tip hash         | Valid | Path\n")
+		for _, snapshot := range snapshots {
+			fmt.Printf(" %-10d | %14.14s ... | %-5t | %v\n",
+				snapshot.Height,
+				fmt.Sprintf("% x", snapshot.TipHash),
+				snapshot.Matches(sp.Chain),
+				snapshot.Path)
+		}
+
+	case "prune":
+		removed, err := storage.PruneSnapshots(sp.SnapshotDir(), *keep)
+		utils.LogErrorF(err)
+		for _, snapshot := range removed {
+			fmt.Printf("Removed %v\n", snapshot.Path)
+		}
+
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
@@ -1,9 +1,9 @@
 package handlers
 
 import (
+	"AdminBlockchain/storage"
 	"AdminBlockchain/utils"
 	"errors"
-	"fmt"
 )
 
 // AccessLevels
@@ -12,6 +12,9 @@ const (
 	AdminAccountAccess = 1
 )
 
+// accountsVersion current version of the account state
+const accountsVersion = 5
+
 // Address an address of an account
 type Address string
 
@@ -21,6 +24,16 @@ type Account struct {
 	PersonalInfo string                   // Information to identify the account owner
 	AccessLevel  int                      // Account access level
 	PubKey       utils.SignatureValidator // To validate user signature
+	Nonce        uint64                   // Nonce of the last operation signed by the account
+	Disabled     bool                     // Signatures of disabled accounts are rejected
+}
+
+// AccountKey a key an account used, the current key has no end
+type AccountKey struct {
+	PubKey    []byte
+	Algorithm string // one of the utils.KeyAlgorithm constants
+	Since     int    // block height the key was set at, 0 for keys set before the history was kept
+	Until     int    // block height the key was replaced at, 0 for the current key
 }
 
 // AccountHandler handles account data
@@ -28,18 +41,127 @@ type AccountHandler struct {
 	*BaseQueryHandler
 }
 
-// Genesis initializes the handler state for new blockchain
-func (handler *AccountHandler) Genesis(PublicKey utils.SignatureValidator) {
-	handler.ExecuteTransaction(
-		"create table Accounts (address text, personal text, level int, pkey blob)")
+// NewAccountHandler creates an account handler and registers its operations
+func NewAccountHandler(base *BaseQueryHandler) *AccountHandler {
+	handler := &AccountHandler{BaseQueryHandler: base}
+	base.RegisterOperation(OperationCreateAccount, handler.createAccount)
+	base.RegisterOperation(OperationUpdateAccount, handler.updateAccount)
+	base.RegisterOperation(OperationRotateKey, handler.rotateKey)
+	base.RegisterOperation(OperationDisableAccount, handler.disableAccount)
+	base.RegisterOperation(OperationEnableAccount, handler.enableAccount)
+	return handler
+}
+
+// Module declares the account state. The admin account is created together with the state.
+func (handler *AccountHandler) Module(admin utils.SignatureValidator) Module {
+	return Module{
+		Name:    "accounts",
+		Version: accountsVersion,
+		Schema: []string{
+			"create table Accounts (address text, personal text, level int, pkey blob, nonce int default 0, algorithm text)",
+			"create unique index AccountAddresses on Accounts (address)",
+			"create table AccountKeys (address text, pkey blob, since int, until int default 0, algorithm text)",
+			"create table DisabledAccounts (address text)"},
+		Genesis: func(scope *TransactionScope) error {
+			key, err := admin.Store()
+			if err != nil {
+				return err
+			}
+			return insertAccount(scope, accountsVersion, GetAddressFromPubKey(admin), "admin", AdminAccountAccess, admin, key)
+		},
+		Migrations: []Migration{handler.addNonce, handler.addKeyHistory, handler.addUniqueAddresses, handler.addKeyAlgorithms},
+		Legacy:     true,
+	}
+}
 
-	accAddress := GetAddressFromPubKey(PublicKey)
-	key, err := PublicKey.Store()
-	utils.LogErrorF(err)
+// addNonce adds account nonces. Chains that added the column before the registry existed already have it.
+func (handler *AccountHandler) addNonce(scope *TransactionScope) error {
+	found, err := hasColumn(scope, "Accounts", "nonce")
+	if err != nil || found {
+		return err
+	}
+	_, err = scope.ExecuteTransaction("alter table Accounts add column nonce int default 0")
+	return err
+}
 
-	_, err = handler.ExecuteTransaction(
-		"insert into Accounts (address, personal, level, pkey) values (?, ?, ?, ?)", accAddress, "admin", AdminAccountAccess, key)
-	utils.LogErrorF(err)
+// addKeyHistory adds the key history and disabled accounts, the current keys start the history
+func (handler *AccountHandler) addKeyHistory(scope *TransactionScope) error {
+	statements := []string{
+		"create table AccountKeys (address text, pkey blob, since int, until int default 0)",
+		"insert into AccountKeys (address, pkey, since) select address, pkey, 0 from Accounts",
+		"create table DisabledAccounts (address text)"}
+	for _, statement := range statements {
+		_, err := scope.ExecuteTransaction(statement)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addUniqueAddresses removes duplicate accounts, keeping the first one, and makes addresses unique.
+// Accounts created from now on get checksummed addresses.
+func (handler *AccountHandler) addUniqueAddresses(scope *TransactionScope) error {
+	statements := []string{
+		"delete from Accounts where rowid not in (select min(rowid) from Accounts group by address)",
+		"delete from AccountKeys where rowid not in (select min(rowid) from AccountKeys group by address, pkey, since, until)",
+		"create unique index AccountAddresses on Accounts (address)"}
+	for _, statement := range statements {
+		_, err := scope.ExecuteTransaction(statement)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addKeyAlgorithms stores the algorithm of the account keys, keys stored until now are RSA keys
+func (handler *AccountHandler) addKeyAlgorithms(scope *TransactionScope) error {
+	statements := []string{
+		"alter table Accounts add column algorithm text",
+		"alter table AccountKeys add column algorithm text",
+		"update Accounts set algorithm='rsa'",
+		"update AccountKeys set algorithm='rsa'"}
+	for _, statement := range statements {
+		_, err := scope.ExecuteTransaction(statement)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newAccountAddress returns the address of a new account. Accounts created before version 4 of the module got legacy addresses.
+func newAccountAddress(version int, key utils.SignatureValidator) Address {
+	if version < 4 {
+		return legacyAddressFromPubKey(key)
+	}
+	return GetAddressFromPubKey(key)
+}
+
+// FindAddress returns the address of the account using the key, accounts created before checksummed addresses are found as well
+func (handler *AccountHandler) FindAddress(key utils.SignatureValidator) (Address, error) {
+	for _, addr := range []Address{GetAddressFromPubKey(key), legacyAddressFromPubKey(key)} {
+		exists, err := accountExists(&handler.Sp.StateDb, addr)
+		if err != nil {
+			return "", err
+		}
+		if exists {
+			return addr, nil
+		}
+	}
+	return "", errors.New("account not found")
+}
+
+// NextNonce rpc method, returns the nonce the account has to sign its next operation with. Pending transactions are included.
+func (handler *AccountHandler) NextNonce(addr Address, nonce *uint64) error {
+	return handler.ReadPending(func(db queryer) error {
+		acc, err := handler.getAccountByAddress(db, addr)
+		if err == nil {
+			*nonce = acc.Nonce + 1
+		}
+		return err
+	})
 }
 
 // CreateAccountParams for updating or creating an account
@@ -48,33 +170,80 @@ type CreateAccountParams struct {
 	PersonalInfo string  // personal info of the new account
 	AccessLevel  int     // access level of the new account
 	PubKey       []byte  // public key of the new account
+	Nonce        uint64  // next nonce of the sender
 	Signature    []byte  // sender signature
 }
 
 // CreateAccount creates an account
-func (handler *AccountHandler) CreateAccount(params CreateAccountParams, sucess *bool) error {
-	acc, err := handler.getAccountByAddress(params.From)
+func (handler *AccountHandler) CreateAccount(params CreateAccountParams, txID *string) error {
+	return handler.Submit(storage.Request{
+		Method:    "AccountHandler.CreateAccount",
+		Operation: OperationCreateAccount,
+		Signer:    string(params.From),
+		Nonce:     params.Nonce,
+		Params:    []interface{}{params.PersonalInfo, params.AccessLevel, params.PubKey},
+		Signature: params.Signature}, txID)
+}
+
+func (handler *AccountHandler) createAccount(scope *TransactionScope, request storage.Request) error {
+	params := readParams(request, 3)
+	personalInfo, accessLevel, pubKey := params.text(0), params.integer(1), params.bytes(2)
+	if params.err != nil {
+		return params.err
+	}
+
+	acc, err := handler.getAccountByAddress(scope, Address(request.Signer))
 	if err != nil {
 		return err
 	}
-	err = checkAdminUserSignature(acc, params.Signature, params.PersonalInfo, params.AccessLevel, params.PubKey)
+	err = checkAccessLevelChange(acc, int(accessLevel))
 	if err != nil {
 		return err
 	}
-	key, err := utils.ParsePublicKey(params.PubKey)
+	err = authorize(scope, acc, request)
+	if err != nil {
+		return err
+	}
+	key, err := utils.ParsePublicKey(pubKey)
+	if err != nil {
+		return err
+	}
+	version, err := moduleVersion(scope, "accounts")
 	if err != nil {
 		return err
 	}
 
-	accAddress := GetAddressFromPubKey(key)
-	_, err = handler.ExecuteTransaction(
-		"insert into Accounts (address, personal, level, pkey) values (?, ?, ?, ?)",
-		accAddress,
-		params.PersonalInfo,
-		params.AccessLevel,
-		params.PubKey)
+	accAddress := newAccountAddress(version, key)
+	exists, err := accountExists(scope, accAddress)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return errors.New("account already exists")
+	}
+	return insertAccount(scope, version, accAddress, personalInfo, int(accessLevel), key, pubKey)
+}
 
-	return err
+// insertAccount stores a new account with its key. Blocks replayed before the state was migrated
+// write the state of their version.
+func insertAccount(scope *TransactionScope, version int, address Address, personalInfo string, accessLevel int, key utils.SignatureValidator, pubKey []byte) error {
+	var err error
+	if version < 5 {
+		_, err = scope.ExecuteTransaction(
+			"insert into Accounts (address, personal, level, pkey) values (?, ?, ?, ?)", address, personalInfo, accessLevel, pubKey)
+	} else {
+		_, err = scope.ExecuteTransaction(
+			"insert into Accounts (address, personal, level, pkey, algorithm) values (?, ?, ?, ?, ?)",
+			address,
+			personalInfo,
+			accessLevel,
+			pubKey,
+			key.Algorithm())
+	}
+	if err != nil {
+		return err
+	}
+	return addAccountKey(scope, version, address, key, pubKey)
 }
 
 // UpdateAccountParams for updating or creating an account
@@ -83,75 +252,397 @@ type UpdateAccountParams struct {
 	Account      Address // whom to update
 	PersonalInfo string  // personal info of the new account
 	AccessLevel  int     // access level of the new account
+	Nonce        uint64  // next nonce of the sender
 	Signature    []byte  // sender signature
 }
 
 // UpdateAccount creates an account
-func (handler *AccountHandler) UpdateAccount(params UpdateAccountParams, sucess *bool) error {
-	acc, err := handler.getAccountByAddress(params.From)
-	err = checkAdminUserSignature(acc, params.Signature, params.Account, params.PersonalInfo, params.AccessLevel)
+func (handler *AccountHandler) UpdateAccount(params UpdateAccountParams, txID *string) error {
+	return handler.Submit(storage.Request{
+		Method:    "AccountHandler.UpdateAccount",
+		Operation: OperationUpdateAccount,
+		Signer:    string(params.From),
+		Nonce:     params.Nonce,
+		Params:    []interface{}{params.Account, params.PersonalInfo, params.AccessLevel},
+		Signature: params.Signature}, txID)
+}
+
+func (handler *AccountHandler) updateAccount(scope *TransactionScope, request storage.Request) error {
+	params := readParams(request, 3)
+	account, personalInfo, accessLevel := Address(params.text(0)), params.text(1), params.integer(2)
+	if params.err != nil {
+		return params.err
+	}
+
+	acc, err := handler.getAccountByAddress(scope, Address(request.Signer))
+	if err != nil {
+		return err
+	}
+	err = checkAccessLevelChange(acc, int(accessLevel))
+	if err != nil {
+		return err
+	}
+	err = authorize(scope, acc, request)
 	if err != nil {
 		return err
 	}
+	target, err := handler.getAccountByAddress(scope, account)
+	if err != nil {
+		return err
+	}
+	err = checkTargetLevel(acc, target)
+	if err != nil {
+		return err
+	}
+	if accessLevel != AdminAccountAccess {
+		err = checkLastAdmin(scope, target)
+		if err != nil {
+			return err
+		}
+	}
 
-	handler.ExecuteTransaction(
+	_, err = scope.ExecuteTransaction(
 		"update Accounts set personal=?, level=? where address=?",
-		params.PersonalInfo,
-		params.AccessLevel,
-		params.Account)
+		personalInfo,
+		accessLevel,
+		account)
+	return err
+}
 
-	return nil
+// RotateKeyParams parameters for replacing the key of an account
+type RotateKeyParams struct {
+	From      Address // the account itself, signing with its current key, or an admin
+	Account   Address // whose key to replace
+	PubKey    []byte  // the new public key
+	Nonce     uint64  // next nonce of the sender
+	Signature []byte  // sender signature
+}
+
+// RotateKey replaces the key of an account. The address of the account doesn't change.
+func (handler *AccountHandler) RotateKey(params RotateKeyParams, txID *string) error {
+	return handler.Submit(storage.Request{
+		Method:    "AccountHandler.RotateKey",
+		Operation: OperationRotateKey,
+		Signer:    string(params.From),
+		Nonce:     params.Nonce,
+		Params:    []interface{}{params.Account, params.PubKey},
+		Signature: params.Signature}, txID)
+}
+
+func (handler *AccountHandler) rotateKey(scope *TransactionScope, request storage.Request) error {
+	params := readParams(request, 2)
+	account, pubKey := Address(params.text(0)), params.bytes(1)
+	if params.err != nil {
+		return params.err
+	}
+
+	acc, err := handler.getAccountByAddress(scope, Address(request.Signer))
+	if err != nil {
+		return err
+	}
+	if acc.Address != account && acc.AccessLevel != AdminAccountAccess {
+		return errors.New("only admins can rotate the key of another account")
+	}
+	err = authorize(scope, acc, request)
+	if err != nil {
+		return err
+	}
+	_, err = handler.getAccountByAddress(scope, account)
+	if err != nil {
+		return err
+	}
+	key, err := utils.ParsePublicKey(pubKey)
+	if err != nil {
+		return err
+	}
+	version, err := moduleVersion(scope, "accounts")
+	if err != nil {
+		return err
+	}
+
+	if version < 5 {
+		_, err = scope.ExecuteTransaction("update Accounts set pkey=? where address=?", pubKey, account)
+	} else {
+		_, err = scope.ExecuteTransaction("update Accounts set pkey=?, algorithm=? where address=?", pubKey, key.Algorithm(), account)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = scope.ExecuteTransaction("update AccountKeys set until=? where address=? and until=0", scope.height, account)
+	if err != nil {
+		return err
+	}
+	return addAccountKey(scope, version, account, key, pubKey)
+}
+
+// addAccountKey adds the key to the key history, which exists since version 3 of the state
+func addAccountKey(scope *TransactionScope, version int, address Address, key utils.SignatureValidator, pubKey []byte) error {
+	var err error
+	switch {
+	case version < 3:
+	case version < 5:
+		_, err = scope.ExecuteTransaction("insert into AccountKeys (address, pkey, since) values (?, ?, ?)", address, pubKey, scope.height)
+	default:
+		_, err = scope.ExecuteTransaction(
+			"insert into AccountKeys (address, pkey, since, algorithm) values (?, ?, ?, ?)", address, pubKey, scope.height, key.Algorithm())
+	}
+	return err
+}
+
+// AccountStateParams parameters for disabling or enabling an account
+type AccountStateParams struct {
+	From      Address // who sends the transaction
+	Account   Address // whom to change
+	Nonce     uint64  // next nonce of the sender
+	Signature []byte  // sender signature
+}
+
+// DisableAccount disables an account, its signatures are rejected until it is enabled again
+func (handler *AccountHandler) DisableAccount(params AccountStateParams, txID *string) error {
+	return handler.Submit(accountStateRequest("AccountHandler.DisableAccount", OperationDisableAccount, params), txID)
+}
+
+func (handler *AccountHandler) disableAccount(scope *TransactionScope, request storage.Request) error {
+	return handler.setDisabled(scope, request, true)
+}
+
+// EnableAccount enables a disabled account
+func (handler *AccountHandler) EnableAccount(params AccountStateParams, txID *string) error {
+	return handler.Submit(accountStateRequest("AccountHandler.EnableAccount", OperationEnableAccount, params), txID)
+}
+
+func (handler *AccountHandler) enableAccount(scope *TransactionScope, request storage.Request) error {
+	return handler.setDisabled(scope, request, false)
+}
+
+func (handler *AccountHandler) setDisabled(scope *TransactionScope, request storage.Request, disabled bool) error {
+	params := readParams(request, 1)
+	account := Address(params.text(0))
+	if params.err != nil {
+		return params.err
+	}
+
+	acc, err := handler.getAccountByAddress(scope, Address(request.Signer))
+	if err != nil {
+		return err
+	}
+	err = authorize(scope, acc, request)
+	if err != nil {
+		return err
+	}
+	target, err := handler.getAccountByAddress(scope, account)
+	if err != nil {
+		return err
+	}
+	if target.Disabled == disabled {
+		return errors.New("account is already in the requested state")
+	}
+	err = checkTargetLevel(acc, target)
+	if err != nil {
+		return err
+	}
+	if disabled {
+		err = checkLastAdmin(scope, target)
+		if err != nil {
+			return err
+		}
+	}
+
+	if disabled {
+		_, err = scope.ExecuteTransaction("insert into DisabledAccounts (address) values (?)", account)
+	} else {
+		_, err = scope.ExecuteTransaction("delete from DisabledAccounts where address=?", account)
+	}
+	return err
+}
+
+func accountStateRequest(method string, operation string, params AccountStateParams) storage.Request {
+	return storage.Request{
+		Method:    method,
+		Operation: operation,
+		Signer:    string(params.From),
+		Nonce:     params.Nonce,
+		Params:    []interface{}{params.Account},
+		Signature: params.Signature}
+}
+
+// KeyHistory rpc method, lists the keys of the account from the oldest to the current one
+func (handler *AccountHandler) KeyHistory(addr Address, history *[]AccountKey) error {
+	algorithm, err := algorithmColumn(&handler.Sp.StateDb, "AccountKeys")
+	if err != nil {
+		return err
+	}
+	rows, err := handler.Sp.StateDb.Query("select pkey, since, until, "+algorithm+" from AccountKeys where address=? order by rowid", addr)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	*history = []AccountKey{}
+	for rows.Next() {
+		var key AccountKey
+		err = rows.Scan(&key.PubKey, &key.Since, &key.Until, &key.Algorithm)
+		if err != nil {
+			return err
+		}
+		*history = append(*history, key)
+	}
+	return rows.Err()
 }
 
 // ListAccounts lists available accounts
 func (handler *AccountHandler) ListAccounts() []Account {
 	var accounts []Account
 	var acc Account
-	rows, err := handler.Sp.StateDb.Query("select address, personal, level, pkey from Accounts")
+	algorithm, err := algorithmColumn(&handler.Sp.StateDb, "Accounts")
+	if err != nil {
+		return accounts
+	}
+	rows, err := handler.Sp.StateDb.Query("select address, personal, level, pkey, nonce, " + algorithm + " from Accounts")
 	defer rows.Close()
 	if err == nil {
 		for rows.Next() {
 			pubKeyData := make([]byte, 1024)
-			rows.Scan(&acc.Address, &acc.PersonalInfo, &acc.AccessLevel, &pubKeyData)
-			acc.PubKey, err = utils.ParsePublicKey(pubKeyData)
+			var keyAlgorithm string
+			rows.Scan(&acc.Address, &acc.PersonalInfo, &acc.AccessLevel, &pubKeyData, &acc.Nonce, &keyAlgorithm)
+			acc.PubKey, err = utils.ParsePublicKeyWithAlgorithm(keyAlgorithm, pubKeyData)
 			accounts = append(accounts, acc)
 		}
 	}
+	rows.Close()
+
+	for i := range accounts {
+		accounts[i].Disabled, _ = accountDisabled(&handler.Sp.StateDb, accounts[i].Address)
+	}
 	return accounts
 }
 
-func (handler *AccountHandler) getAccountByAddress(addr Address) (Account, error) {
+func (handler *AccountHandler) getAccountByAddress(db queryer, addr Address) (Account, error) {
+	return queryAccount(db, addr)
+}
+
+func queryAccount(db queryer, addr Address) (Account, error) {
 	var acc Account
-	rows, err := handler.Sp.StateDb.Query("select address, personal, level, pkey from Accounts where address=?", addr)
+	algorithm, err := algorithmColumn(db, "Accounts")
+	if err != nil {
+		return acc, err
+	}
+	rows, err := db.Query("select address, personal, level, pkey, nonce, "+algorithm+" from Accounts where address=?", addr)
+	if err != nil {
+		return acc, err
+	}
 	defer rows.Close()
+
+	var pubKeyData []byte
+	var keyAlgorithm string
+	if !rows.Next() {
+		return acc, errors.New("account not found")
+	}
+	err = rows.Scan(&acc.Address, &acc.PersonalInfo, &acc.AccessLevel, &pubKeyData, &acc.Nonce, &keyAlgorithm)
+	rows.Close()
 	if err != nil {
 		return acc, err
 	}
-	pubKeyData := make([]byte, 1024)
-	if rows.Next() {
-		rows.Scan(&acc.Address, &acc.PersonalInfo, &acc.AccessLevel, &pubKeyData)
+	acc.PubKey, err = utils.ParsePublicKeyWithAlgorithm(keyAlgorithm, pubKeyData)
+	if err != nil {
+		return acc, err
 	}
-	acc.PubKey, err = utils.ParsePublicKey(pubKeyData)
+	acc.Disabled, err = accountDisabled(db, addr)
 	return acc, err
 }
 
-func checkAdminUserSignature(acc Account, signature []byte, params ...interface{}) error {
-	err := acc.PubKey.CheckSignature(
-		utils.Hash(params...),
-		signature)
+// algorithmColumn returns the column holding the key algorithm of the table, states before version 5 only hold RSA keys
+func algorithmColumn(db queryer, table string) (string, error) {
+	found, err := hasColumn(db, table, "algorithm")
+	if err != nil || found {
+		return "algorithm", err
+	}
+	return "'" + utils.KeyAlgorithmRSA + "'", nil
+}
+
+func accountExists(db queryer, addr Address) (bool, error) {
+	rows, err := db.Query("select 1 from Accounts where address=?", addr)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	return rows.Next(), rows.Err()
+}
+
+// accountDisabled checks if the account is disabled. Accounts can't be disabled before the key history exists.
+func accountDisabled(db queryer, addr Address) (bool, error) {
+	found, err := hasTable(db, "DisabledAccounts")
+	if err != nil || !found {
+		return false, err
+	}
+	rows, err := db.Query("select 1 from DisabledAccounts where address=?", addr)
 	if err != nil {
-		return errors.New("invalid user signature")
+		return false, err
 	}
+	defer rows.Close()
+	return rows.Next(), rows.Err()
+}
 
-	if acc.AccessLevel != AdminAccountAccess {
+// checkAccessLevelChange checks that the account may give the access level, only admins can give admin access
+func checkAccessLevelChange(acc Account, accessLevel int) error {
+	if accessLevel != BasicAccountAccess && acc.AccessLevel != AdminAccountAccess {
 		return errors.New("invalid access level")
 	}
+	return nil
+}
 
+// checkTargetLevel checks that the account may change the target account. Role holders change basic accounts
+// other than their own, admin accounts are only changed by admins.
+func checkTargetLevel(acc Account, target Account) error {
+	if acc.AccessLevel == AdminAccountAccess {
+		return nil
+	}
+	if target.AccessLevel == AdminAccountAccess {
+		return errors.New("admin accounts are only changed by admins")
+	}
+	if target.Address == acc.Address {
+		return errors.New("the account can't change itself")
+	}
+	return nil
+}
+
+// checkLastAdmin checks that an enabled admin remains if the target account loses admin access or is disabled
+func checkLastAdmin(db queryer, target Account) error {
+	if target.AccessLevel != AdminAccountAccess || target.Disabled {
+		return nil
+	}
+	count, err := countEnabledAdmins(db)
+	if err != nil {
+		return err
+	}
+	if count <= 1 {
+		return errors.New("the chain needs at least one enabled admin")
+	}
 	return nil
 }
 
-// GetAddressFromPubKey retrieves address from public key
-func GetAddressFromPubKey(key utils.SignatureValidator) Address {
-	rawData, _ := key.Store()
-	return Address(fmt.Sprintf("0x%x", utils.Hash(rawData)[:5]))
+// countEnabledAdmins returns the amount of admin accounts which aren't disabled
+func countEnabledAdmins(db queryer) (int, error) {
+	query := "select count(*) from Accounts where level=?"
+	found, err := hasTable(db, "DisabledAccounts")
+	if err != nil {
+		return 0, err
+	}
+	if found {
+		query += " and address not in (select address from DisabledAccounts)"
+	}
+	rows, err := db.Query(query, AdminAccountAccess)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var count int
+	if rows.Next() {
+		err = rows.Scan(&count)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return count, rows.Err()
 }
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"AdminBlockchain/utils"
+	"testing"
+)
+
+// updateAccount sets the personal info and access level of the account, signed by the sender
+func (node *testNode) updateAccount(t *testing.T, sender utils.SignatureCreator, account Address, accessLevel int) error {
+	t.Helper()
+	from := GetAddressFromPubKey(sender.PublicKey())
+	nonce := node.nonce(t, from)
+	var txID string
+	return node.accounts.UpdateAccount(UpdateAccountParams{
+		From:         from,
+		Account:      account,
+		PersonalInfo: "updated",
+		AccessLevel:  accessLevel,
+		Nonce:        nonce,
+		Signature: node.sign(t, sender, "AccountHandler.UpdateAccount", OperationUpdateAccount, nonce,
+			account, "updated", accessLevel)}, &txID)
+}
+
+// setDisabled disables or enables the account, signed by the sender
+func (node *testNode) setDisabled(t *testing.T, sender utils.SignatureCreator, account Address, disabled bool) error {
+	t.Helper()
+	from := GetAddressFromPubKey(sender.PublicKey())
+	nonce := node.nonce(t, from)
+	params := AccountStateParams{From: from, Account: account, Nonce: nonce}
+	var txID string
+	if disabled {
+		params.Signature = node.sign(t, sender, "AccountHandler.DisableAccount", OperationDisableAccount, nonce, account)
+		return node.accounts.DisableAccount(params, &txID)
+	}
+	params.Signature = node.sign(t, sender, "AccountHandler.EnableAccount", OperationEnableAccount, nonce, account)
+	return node.accounts.EnableAccount(params, &txID)
+}
+
+func accessLevel(t *testing.T, node *testNode, account Address) int {
+	t.Helper()
+	acc, err := queryAccount(&node.Sp.StateDb, account)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return acc.AccessLevel
+}
+
+// Check if an account manager changes basic accounts, but neither admins nor its own account
+func TestAccountTargetLevel(t *testing.T) {
+	producer, admin := newKey(t), newKey(t)
+	node := newTestChain(t, producer, admin.PublicKey())
+	adminAddress := GetAddressFromPubKey(admin.PublicKey())
+	manager := newKey(t)
+	managerAddress := node.createAccount(t, admin, manager.PublicKey(), BasicAccountAccess)
+	assertEq(t, nil, node.assignRole(t, admin, managerAddress, RoleAccountManager))
+	userAddress := node.createAccount(t, admin, newKey(t).PublicKey(), BasicAccountAccess)
+
+	assertErr(t, node.updateAccount(t, manager, adminAddress, BasicAccountAccess))
+	assertEq(t, AdminAccountAccess, accessLevel(t, node, adminAddress))
+	assertErr(t, node.setDisabled(t, manager, adminAddress, true))
+	assertErr(t, node.updateAccount(t, manager, managerAddress, BasicAccountAccess))
+	assertErr(t, node.setDisabled(t, manager, managerAddress, true))
+
+	assertEq(t, nil, node.updateAccount(t, manager, userAddress, BasicAccountAccess))
+	assertErr(t, node.updateAccount(t, manager, userAddress, AdminAccountAccess))
+	assertEq(t, nil, node.setDisabled(t, manager, userAddress, true))
+	assertEq(t, nil, node.setDisabled(t, manager, userAddress, false))
+
+	// admins change any account
+	assertEq(t, nil, node.setDisabled(t, admin, userAddress, true))
+	assertEq(t, nil, node.setDisabled(t, admin, userAddress, false))
+	assertEq(t, nil, node.updateAccount(t, admin, managerAddress, AdminAccountAccess))
+	assertEq(t, AdminAccountAccess, accessLevel(t, node, managerAddress))
+}
+
+// Check if the last enabled admin can't be demoted or disabled
+func TestAccountLastAdmin(t *testing.T) {
+	producer, admin := newKey(t), newKey(t)
+	node := newTestChain(t, producer, admin.PublicKey())
+	adminAddress := GetAddressFromPubKey(admin.PublicKey())
+
+	assertErr(t, node.updateAccount(t, admin, adminAddress, BasicAccountAccess))
+	assertErr(t, node.setDisabled(t, admin, adminAddress, true))
+	assertEq(t, nil, node.updateAccount(t, admin, adminAddress, AdminAccountAccess))
+
+	second := newKey(t)
+	secondAddress := node.createAccount(t, admin, second.PublicKey(), AdminAccountAccess)
+	assertEq(t, nil, node.setDisabled(t, second, adminAddress, true))
+	// the disabled admin doesn't count
+	assertErr(t, node.updateAccount(t, second, secondAddress, BasicAccountAccess))
+	assertErr(t, node.setDisabled(t, second, secondAddress, true))
+
+	assertEq(t, nil, node.setDisabled(t, second, adminAddress, false))
+	assertEq(t, nil, node.updateAccount(t, admin, secondAddress, BasicAccountAccess))
+	assertEq(t, BasicAccountAccess, accessLevel(t, node, secondAddress))
+	assertErr(t, node.updateAccount(t, admin, adminAddress, BasicAccountAccess))
+}
+
+// rotateKey replaces the key of the account, signed by the sender
+func (node *testNode) rotateKey(t *testing.T, sender utils.SignatureCreator, account Address, key utils.SignatureValidator) error {
+	t.Helper()
+	pubKey, err := key.Store()
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := GetAddressFromPubKey(sender.PublicKey())
+	nonce := node.nonce(t, from)
+	var txID string
+	return node.accounts.RotateKey(RotateKeyParams{
+		From:      from,
+		Account:   account,
+		PubKey:    pubKey,
+		Nonce:     nonce,
+		Signature: node.sign(t, sender, "AccountHandler.RotateKey", OperationRotateKey, nonce, account, pubKey)}, &txID)
+}
+
+// Check if signatures of a rotated key are rejected and the address of the account is kept
+func TestAccountRotatedKey(t *testing.T) {
+	producer, admin := newKey(t), newKey(t)
+	node := newTestChain(t, producer, admin.PublicKey())
+	old := newKey(t)
+	address := node.createAccount(t, admin, old.PublicKey(), BasicAccountAccess)
+
+	// only admins rotate the keys of other accounts
+	other := newKey(t)
+	otherAddress := node.createAccount(t, admin, other.PublicKey(), BasicAccountAccess)
+	assertErr(t, node.rotateKey(t, other, address, newKey(t).PublicKey()))
+
+	current := newKey(t)
+	assertEq(t, nil, node.rotateKey(t, old, address, current.PublicKey()))
+	height := len(node.Sp.Chain) - 1
+	assertErr(t, node.rotateKey(t, old, address, newKey(t).PublicKey()))
+	assertEq(t, nil, node.rotateKey(t, admin, otherAddress, newKey(t).PublicKey()))
+
+	// a request signed with the old key for the next nonce
+	nonce := node.nonce(t, address)
+	pubKey, err := newKey(t).PublicKey().Store()
+	assertEq(t, nil, err)
+	var txID string
+	err = node.accounts.RotateKey(RotateKeyParams{
+		From:      address,
+		Account:   address,
+		PubKey:    pubKey,
+		Nonce:     nonce,
+		Signature: node.sign(t, old, "AccountHandler.RotateKey", OperationRotateKey, nonce, address, pubKey)}, &txID)
+	assertErr(t, err)
+	if err != nil {
+		assertEq(t, "invalid user signature", err.Error())
+	}
+
+	acc, err := queryAccount(&node.Sp.StateDb, address)
+	assertEq(t, nil, err)
+	assertEq(t, address, acc.Address)
+	assertEq(t, GetAddressFromPubKey(current.PublicKey()), GetAddressFromPubKey(acc.PubKey))
+	var history []AccountKey
+	assertEq(t, nil, node.accounts.KeyHistory(address, &history))
+	assertEq(t, 2, len(history))
+	assertEq(t, height, history[0].Until)
+	assertEq(t, height, history[1].Since)
+	assertEq(t, 0, history[1].Until)
+}
@@ -1,7 +1,7 @@
 package handlers
 
 import (
-	"AdminBlockchain/utils"
+	"AdminBlockchain/storage"
 	"errors"
 )
 
@@ -44,50 +44,88 @@ type ContractHandler struct {
 	Accounts *AccountHandler
 }
 
-// Genesis initializes the handler state for new blockchain
-func (handler *ContractHandler) Genesis() {
-	_, err := handler.ExecuteTransaction(
-		"create table Balances (owner text, balance text)")
-	utils.LogErrorF(err)
+// NewContractHandler creates a contract handler and registers its operations
+func NewContractHandler(base *BaseQueryHandler, accounts *AccountHandler) *ContractHandler {
+	handler := &ContractHandler{BaseQueryHandler: base, Accounts: accounts}
+	base.RegisterOperation(OperationCreateContract, handler.create)
+	base.RegisterOperation(OperationUpdateContract, handler.update)
+	base.RegisterOperation(OperationSignContract, handler.sign)
+	base.RegisterOperation(OperationStartContract, handler.startProgress)
+	base.RegisterOperation(OperationResolveContract, handler.resolve)
+	base.RegisterOperation(OperationAcceptContract, handler.acceptance)
+	return handler
+}
 
-	_, err = handler.ExecuteTransaction(
-		"create table Contracts (reporter text, assignee text, contractInfo text, status int, reward int)")
-	utils.LogErrorF(err)
+// Module declares the balance and contract state
+func (handler *ContractHandler) Module() Module {
+	return Module{
+		Name:    "contracts",
+		Version: 1,
+		Schema: []string{
+			"create table Balances (owner text, balance text)",
+			"create table Contracts (reporter text, assignee text, contractInfo text, status int, reward int)"},
+		Legacy: true,
+	}
 }
 
+// initialBalance balance of an account that never had a balance entry
+const initialBalance = 100
+
 // GetBalance returns the current user balance
 func (handler *ContractHandler) GetBalance(owner Address, createOnErr bool) (int, error) {
-	rows, err := handler.Sp.StateDb.Query("select balance from Balances where owner=?", owner)
+	if !createOnErr {
+		balance, found, err := handler.queryBalance(&handler.Sp.StateDb, owner)
+		if err != nil || !found {
+			return initialBalance, err
+		}
+		return balance, nil
+	}
+
+	scope, err := handler.Begin()
 	if err != nil {
 		return -1, err
 	}
-	var balance int
-	if rows.Next() {
-		rows.Scan(&balance)
-	} else {
-		if createOnErr {
-			err := handler.setBalance(owner, 100, false)
-			return 100, err
-		} else {
-			return 100, nil
-		}
+	defer scope.Rollback()
+
+	balance, err := handler.getBalance(scope, owner)
+	if err != nil {
+		return -1, err
 	}
-	rows.Close()
+	return balance, scope.Commit()
+}
 
-	return balance, nil
+// getBalance returns the user balance, creating the balance entry if it doesn't exist yet
+func (handler *ContractHandler) getBalance(scope *TransactionScope, owner Address) (int, error) {
+	balance, found, err := handler.queryBalance(scope, owner)
+	if err != nil || found {
+		return balance, err
+	}
+
+	_, err = scope.ExecuteTransaction("insert into Balances (owner, balance) values (?, ?)",
+		owner,
+		initialBalance)
+	return initialBalance, err
 }
 
-func (handler *ContractHandler) setBalance(owner Address, balance int, update bool) error {
-	var err error
-	if update {
-		_, err = handler.ExecuteTransaction("update Balances set balance=? where owner=?",
-			balance,
-			owner)
-	} else {
-		_, err = handler.ExecuteTransaction("insert into Balances (owner, balance) values (?, ?)",
-			owner,
-			balance)
+func (handler *ContractHandler) queryBalance(db queryer, owner Address) (int, bool, error) {
+	rows, err := db.Query("select balance from Balances where owner=?", owner)
+	if err != nil {
+		return -1, false, err
+	}
+	defer rows.Close()
+
+	var balance int
+	if !rows.Next() {
+		return -1, false, nil
 	}
+	err = rows.Scan(&balance)
+	return balance, err == nil, err
+}
+
+func (handler *ContractHandler) setBalance(scope *TransactionScope, owner Address, balance int) error {
+	_, err := scope.ExecuteTransaction("update Balances set balance=? where owner=?",
+		balance,
+		owner)
 	return err
 }
 
@@ -97,33 +135,50 @@ type CreateContractParams struct {
 	Assignee     Address // who is responsible for performing the task
 	ContractInfo string  // off-chain information (e.g. link to specification)
 	Reward       int     // reward for the contract
+	Nonce        uint64  // next nonce of the sender
 	Signature    []byte
 }
 
 // Create creates a contract
-func (handler *ContractHandler) Create(params CreateContractParams, contractID *int64) error {
-	*contractID = 0
-	acc, err := handler.Accounts.getAccountByAddress(params.From)
+func (handler *ContractHandler) Create(params CreateContractParams, txID *string) error {
+	return handler.Submit(storage.Request{
+		Method:    "ContractHandler.Create",
+		Operation: OperationCreateContract,
+		Signer:    string(params.From),
+		Nonce:     params.Nonce,
+		Params:    []interface{}{params.Assignee, params.ContractInfo, params.Reward},
+		Signature: params.Signature}, txID)
+}
+
+func (handler *ContractHandler) create(scope *TransactionScope, request storage.Request) error {
+	params := readParams(request, 3)
+	assignee, contractInfo, reward := Address(params.text(0)), params.text(1), int(params.integer(2))
+	if params.err != nil {
+		return params.err
+	}
+
+	acc, err := handler.Accounts.getAccountByAddress(scope, Address(request.Signer))
 	if err != nil {
 		return err
 	}
-	balance, err := handler.GetBalance(params.From, true)
-	if balance < params.Reward {
-		return errors.New("insufficient reporter funds")
+	err = checkUserSignature(scope, acc, request)
+	if err != nil {
+		return err
 	}
-	err = checkUserSignature(acc, params.Signature, params.Assignee, params.ContractInfo, params.Reward)
-	inserted, err := handler.ExecuteTransaction("insert into Contracts (reporter, assignee, contractInfo, status, reward) values (?, ?, ?, ?, ?)",
-		params.From,
-		params.Assignee,
-		params.ContractInfo,
-		ContractStatusCreated,
-		params.Reward)
+	balance, err := handler.getBalance(scope, acc.Address)
 	if err != nil {
 		return err
 	}
-
-	*contractID = inserted
-	return nil
+	if balance < reward {
+		return errors.New("insufficient reporter funds")
+	}
+	_, err = scope.ExecuteTransaction("insert into Contracts (reporter, assignee, contractInfo, status, reward) values (?, ?, ?, ?, ?)",
+		acc.Address,
+		assignee,
+		contractInfo,
+		ContractStatusCreated,
+		reward)
+	return err
 }
 
 // UpdateContractParams parameters for creating contract
@@ -133,131 +188,187 @@ type UpdateContractParams struct {
 	Assignee     Address // who is responsible for performing the task
 	ContractInfo string  // off-chain information (e.g. link to specification)
 	Reward       int     // reward for the contract
+	Nonce        uint64  // next nonce of the sender
 	Signature    []byte
 }
 
 // Update updates a contract
-func (handler *ContractHandler) Update(params UpdateContractParams, success *bool) error {
-	*success = false
-	contract, err := handler.getContract(params.ContractID)
+func (handler *ContractHandler) Update(params UpdateContractParams, txID *string) error {
+	return handler.Submit(storage.Request{
+		Method:    "ContractHandler.Update",
+		Operation: OperationUpdateContract,
+		Signer:    string(params.From),
+		Nonce:     params.Nonce,
+		Params:    []interface{}{params.ContractID, params.Assignee, params.ContractInfo, params.Reward},
+		Signature: params.Signature}, txID)
+}
+
+func (handler *ContractHandler) update(scope *TransactionScope, request storage.Request) error {
+	params := readParams(request, 4)
+	contractID, assignee, contractInfo, reward := params.integer(0), Address(params.text(1)), params.text(2), int(params.integer(3))
+	if params.err != nil {
+		return params.err
+	}
+
+	contract, err := handler.getContract(scope, contractID)
+	if err != nil {
+		return err
+	}
 	if contract.Status > ContractStatusConfirmation {
 		return errors.New("contract already confirmed")
 	}
-	balance, err := handler.GetBalance(contract.Reporter, true)
+	balance, err := handler.getBalance(scope, contract.Reporter)
+	if err != nil {
+		return err
+	}
 	if balance < contract.Reward {
 		return errors.New("insufficient reporter funds")
 	}
-	acc, err := handler.Accounts.getAccountByAddress(params.From)
+	acc, err := handler.Accounts.getAccountByAddress(scope, Address(request.Signer))
 	if err != nil {
 		return err
 	}
-	err = checkUserSignature(acc, params.Signature, params.ContractID, params.Assignee, params.ContractInfo, params.Reward)
-	_, err = handler.ExecuteTransaction("update Contracts set assignee=?, contractInfo=?, status=?, reward=? where rowid=?",
-		params.Assignee,
-		params.ContractInfo,
-		ContractStatusCreated,
-		params.Reward,
-		params.ContractID)
+	err = checkUserSignature(scope, acc, request)
 	if err != nil {
 		return err
 	}
-
-	*success = true
-	return nil
+	_, err = scope.ExecuteTransaction("update Contracts set assignee=?, contractInfo=?, status=?, reward=? where rowid=?",
+		assignee,
+		contractInfo,
+		ContractStatusCreated,
+		reward,
+		contractID)
+	return err
 }
 
 // ContractStateParams parameters to update contract
 type ContractStateParams struct {
 	ContractID int64
 	From       Address // who sends the transaction
+	Nonce      uint64  // next nonce of the sender
 	Signature  []byte
 }
 
 // Sign signs the contract
-func (handler *ContractHandler) Sign(params UpdateContractParams, success *bool) error {
-	*success = false
-	contract, err := handler.getContract(params.ContractID)
+func (handler *ContractHandler) Sign(params UpdateContractParams, txID *string) error {
+	return handler.Submit(contractStateRequest("ContractHandler.Sign", OperationSignContract, params), txID)
+}
+
+func (handler *ContractHandler) sign(scope *TransactionScope, request storage.Request) error {
+	params := readParams(request, 1)
+	contractID := params.integer(0)
+	if params.err != nil {
+		return params.err
+	}
+
+	contract, err := handler.getContract(scope, contractID)
+	if err != nil {
+		return err
+	}
 	if contract.Status > ContractStatusConfirmation {
 		return errors.New("contract already confirmed")
 	}
-	balanceR, err := handler.GetBalance(contract.Reporter, true)
-	if balanceR < contract.Reward {
-		return errors.New("insufficient reporter funds")
-	}
-	acc, err := handler.Accounts.getAccountByAddress(contract.Assignee)
+	balanceR, err := handler.getBalance(scope, contract.Reporter)
 	if err != nil {
 		return err
 	}
-
-	err = checkUserSignature(acc, params.Signature, params.ContractID)
+	if balanceR < contract.Reward {
+		return errors.New("insufficient reporter funds")
+	}
+	acc, err := handler.Accounts.getAccountByAddress(scope, contract.Assignee)
 	if err != nil {
 		return err
 	}
 
-	err = handler.updateStatus(params.ContractID, ContractStatusOpen)
+	err = checkUserSignature(scope, acc, request)
 	if err != nil {
 		return err
 	}
 
-	err = handler.setBalance(contract.Reporter, balanceR-contract.Reward, true)
+	err = handler.updateStatus(scope, contractID, ContractStatusOpen)
 	if err != nil {
 		return err
 	}
 
-	*success = true
-	return nil
+	err = handler.setBalance(scope, contract.Reporter, balanceR-contract.Reward)
+	return err
 }
 
 // StartProgress start progress on contract
-func (handler *ContractHandler) StartProgress(params UpdateContractParams, success *bool) error {
-	*success = false
-	contract, err := handler.getContract(params.ContractID)
-	if contract.Status != ContractStatusOpen {
-		return errors.New("contract is not available")
+func (handler *ContractHandler) StartProgress(params UpdateContractParams, txID *string) error {
+	return handler.Submit(contractStateRequest("ContractHandler.StartProgress", OperationStartContract, params), txID)
+}
+
+func (handler *ContractHandler) startProgress(scope *TransactionScope, request storage.Request) error {
+	params := readParams(request, 1)
+	contractID := params.integer(0)
+	if params.err != nil {
+		return params.err
 	}
-	acc, err := handler.Accounts.getAccountByAddress(contract.Assignee)
+
+	contract, err := handler.getContract(scope, contractID)
 	if err != nil {
 		return err
 	}
-
-	err = checkUserSignature(acc, params.Signature, params.ContractID)
+	if contract.Status != ContractStatusOpen {
+		return errors.New("contract is not available")
+	}
+	acc, err := handler.Accounts.getAccountByAddress(scope, contract.Assignee)
 	if err != nil {
 		return err
 	}
 
-	err = handler.updateStatus(params.ContractID, ContractStatusInProgress)
+	err = checkUserSignature(scope, acc, request)
 	if err != nil {
 		return err
 	}
 
-	*success = true
-	return nil
+	err = handler.updateStatus(scope, contractID, ContractStatusInProgress)
+	return err
 }
 
 // Resolve finish work on contract
-func (handler *ContractHandler) Resolve(params UpdateContractParams, success *bool) error {
-	*success = false
-	contract, err := handler.getContract(params.ContractID)
-	if contract.Status != ContractStatusInProgress {
-		return errors.New("contract is not available")
+func (handler *ContractHandler) Resolve(params UpdateContractParams, txID *string) error {
+	return handler.Submit(contractStateRequest("ContractHandler.Resolve", OperationResolveContract, params), txID)
+}
+
+func (handler *ContractHandler) resolve(scope *TransactionScope, request storage.Request) error {
+	params := readParams(request, 1)
+	contractID := params.integer(0)
+	if params.err != nil {
+		return params.err
 	}
-	acc, err := handler.Accounts.getAccountByAddress(contract.Assignee)
+
+	contract, err := handler.getContract(scope, contractID)
 	if err != nil {
 		return err
 	}
-
-	err = checkUserSignature(acc, params.Signature, params.ContractID)
+	if contract.Status != ContractStatusInProgress {
+		return errors.New("contract is not available")
+	}
+	acc, err := handler.Accounts.getAccountByAddress(scope, contract.Assignee)
 	if err != nil {
 		return err
 	}
 
-	err = handler.updateStatus(params.ContractID, ContractStatusComplete)
+	err = checkUserSignature(scope, acc, request)
 	if err != nil {
 		return err
 	}
 
-	*success = true
-	return nil
+	err = handler.updateStatus(scope, contractID, ContractStatusComplete)
+	return err
+}
+
+// contractStateRequest builds the request of an operation changing the state of a contract
+func contractStateRequest(method string, operation string, params UpdateContractParams) storage.Request {
+	return storage.Request{
+		Method:    method,
+		Operation: operation,
+		Signer:    string(params.From),
+		Nonce:     params.Nonce,
+		Params:    []interface{}{params.ContractID},
+		Signature: params.Signature}
 }
 
 // ContractAcceptanceParams parameters to update contract
@@ -265,48 +376,67 @@ type ContractAcceptanceParams struct {
 	ContractID int64
 	From       Address // who sends the transaction
 	Success    bool    // is acceptance succesful
+	Nonce      uint64  // next nonce of the sender
 	Signature  []byte
 }
 
 // Acceptance accept the completed work
-func (handler *ContractHandler) Acceptance(params ContractAcceptanceParams, success *bool) error {
-	*success = false
-	contract, err := handler.getContract(params.ContractID)
-	if contract.Status != ContractStatusComplete {
-		return errors.New("contract is not complete")
+func (handler *ContractHandler) Acceptance(params ContractAcceptanceParams, txID *string) error {
+	return handler.Submit(storage.Request{
+		Method:    "ContractHandler.Acceptance",
+		Operation: OperationAcceptContract,
+		Signer:    string(params.From),
+		Nonce:     params.Nonce,
+		Params:    []interface{}{params.ContractID, params.Success},
+		Signature: params.Signature}, txID)
+}
+
+func (handler *ContractHandler) acceptance(scope *TransactionScope, request storage.Request) error {
+	params := readParams(request, 2)
+	contractID, success := params.integer(0), params.flag(1)
+	if params.err != nil {
+		return params.err
 	}
-	acc, err := handler.Accounts.getAccountByAddress(contract.Reporter)
+
+	contract, err := handler.getContract(scope, contractID)
 	if err != nil {
 		return err
 	}
-
-	err = checkUserSignature(acc, params.Signature, params.ContractID, params.Success)
+	if contract.Status != ContractStatusComplete {
+		return errors.New("contract is not complete")
+	}
+	acc, err := handler.Accounts.getAccountByAddress(scope, contract.Reporter)
 	if err != nil {
 		return err
 	}
 
-	balanceR, err := handler.GetBalance(contract.Reporter, true)
-	balanceA, err := handler.GetBalance(contract.Assignee, true)
+	err = checkUserSignature(scope, acc, request)
 	if err != nil {
 		return err
 	}
 
-	if params.Success {
-		err = handler.updateStatus(params.ContractID, ContractStatusSuccess)
+	if success {
+		err = handler.updateStatus(scope, contractID, ContractStatusSuccess)
 		if err != nil {
 			return err
 		}
-		handler.setBalance(contract.Assignee, balanceA+contract.Reward, true)
+		err = handler.addBalance(scope, contract.Assignee, contract.Reward)
 	} else {
-		err = handler.updateStatus(params.ContractID, ContractStatusFail)
+		err = handler.updateStatus(scope, contractID, ContractStatusFail)
 		if err != nil {
 			return err
 		}
-		handler.setBalance(contract.Reporter, balanceR+contract.Reward, true)
+		err = handler.addBalance(scope, contract.Reporter, contract.Reward)
 	}
+	return err
+}
 
-	*success = true
-	return nil
+func (handler *ContractHandler) addBalance(scope *TransactionScope, owner Address, amount int) error {
+	balance, err := handler.getBalance(scope, owner)
+	if err != nil {
+		return err
+	}
+	return handler.setBalance(scope, owner, balance+amount)
 }
 
 // GetAllContracts retruns the list of contracts
@@ -345,35 +475,28 @@ func (handler *ContractHandler) GetContractsOfUser(user Address) ([]Contract, er
 	return contracts, nil
 }
 
-func (handler *ContractHandler) getContract(id int64) (Contract, error) {
+func (handler *ContractHandler) getContract(db queryer, id int64) (Contract, error) {
 	var contract Contract
-	rows, err := handler.Sp.StateDb.Query("select rowid, reporter, assignee, contractInfo, status, reward from Contracts where rowid=?", id)
-	defer rows.Close()
+	rows, err := db.Query("select rowid, reporter, assignee, contractInfo, status, reward from Contracts where rowid=?", id)
 	if err != nil {
 		return contract, err
 	}
+	defer rows.Close()
 
-	if rows.Next() {
-		rows.Scan(&contract.ID, &contract.Reporter, &contract.Assignee, &contract.ContractInfo, &contract.Status, &contract.Reward)
+	if !rows.Next() {
+		return contract, errors.New("contract not found")
 	}
-
-	return contract, nil
+	err = rows.Scan(&contract.ID, &contract.Reporter, &contract.Assignee, &contract.ContractInfo, &contract.Status, &contract.Reward)
+	return contract, err
 }
 
-func (handler *ContractHandler) updateStatus(id int64, status int) error {
-	_, err := handler.ExecuteTransaction("update Contracts set status=? where rowid=?",
+func (handler *ContractHandler) updateStatus(scope *TransactionScope, id int64, status int) error {
+	_, err := scope.ExecuteTransaction("update Contracts set status=? where rowid=?",
 		status,
 		id)
 	return err
 }
 
-func checkUserSignature(acc Account, signature []byte, params ...interface{}) error {
-	err := acc.PubKey.CheckSignature(
-		utils.Hash(params...),
-		signature)
-	if err != nil {
-		return errors.New("invalid user signature")
-	}
-
-	return nil
+func checkUserSignature(scope *TransactionScope, acc Account, request storage.Request) error {
+	return authorize(scope, acc, request)
 }
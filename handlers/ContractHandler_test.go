@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"AdminBlockchain/utils"
+	"testing"
+)
+
+// createContract creates a contract of the sender for the assignee
+func (node *testNode) createContract(t *testing.T, sender utils.SignatureCreator, assignee Address, reward int) error {
+	t.Helper()
+	from := GetAddressFromPubKey(sender.PublicKey())
+	nonce := node.nonce(t, from)
+	var txID string
+	return node.contracts.Create(CreateContractParams{
+		From:         from,
+		Assignee:     assignee,
+		ContractInfo: "task",
+		Reward:       reward,
+		Nonce:        nonce,
+		Signature:    node.sign(t, sender, "ContractHandler.Create", OperationCreateContract, nonce, assignee, "task", reward)}, &txID)
+}
+
+// updateContract changes the info and reward of the contract, signed by the sender
+func (node *testNode) updateContract(t *testing.T, sender utils.SignatureCreator, id int64, assignee Address, reward int) error {
+	t.Helper()
+	from := GetAddressFromPubKey(sender.PublicKey())
+	nonce := node.nonce(t, from)
+	var txID string
+	return node.contracts.Update(UpdateContractParams{
+		ContractID:   id,
+		From:         from,
+		Assignee:     assignee,
+		ContractInfo: "updated",
+		Reward:       reward,
+		Nonce:        nonce,
+		Signature: node.sign(t, sender, "ContractHandler.Update", OperationUpdateContract, nonce,
+			id, assignee, "updated", reward)}, &txID)
+}
+
+// signContract confirms the contract as its assignee
+func (node *testNode) signContract(t *testing.T, sender utils.SignatureCreator, id int64) error {
+	t.Helper()
+	from := GetAddressFromPubKey(sender.PublicKey())
+	nonce := node.nonce(t, from)
+	var txID string
+	return node.contracts.Sign(UpdateContractParams{
+		ContractID: id,
+		From:       from,
+		Nonce:      nonce,
+		Signature:  node.sign(t, sender, "ContractHandler.Sign", OperationSignContract, nonce, id)}, &txID)
+}
+
+// revokePermission removes the permission of the role, signed by the sender
+func (node *testNode) revokePermission(t *testing.T, sender utils.SignatureCreator, role string, operation string) error {
+	t.Helper()
+	from := GetAddressFromPubKey(sender.PublicKey())
+	nonce := node.nonce(t, from)
+	var txID string
+	return node.roles.Revoke(PermissionParams{
+		From:      from,
+		Role:      role,
+		Operation: operation,
+		Nonce:     nonce,
+		Signature: node.sign(t, sender, "RoleHandler.Revoke", OperationRevokePermission, nonce, role, operation)}, &txID)
+}
+
+func contract(t *testing.T, node *testNode, id int64) Contract {
+	t.Helper()
+	contract, err := node.contracts.getContract(&node.Sp.StateDb, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return contract
+}
+
+// Check if a contract is created once by a permitted account with enough funds
+func TestContractCreate(t *testing.T) {
+	producer, admin := newKey(t), newKey(t)
+	node := newTestChain(t, producer, admin.PublicKey())
+	reporter, assignee := newKey(t), newKey(t)
+	reporterAddress := node.createAccount(t, admin, reporter.PublicKey(), BasicAccountAccess)
+	assigneeAddress := node.createAccount(t, admin, assignee.PublicKey(), BasicAccountAccess)
+
+	assertEq(t, nil, node.createContract(t, reporter, assigneeAddress, 30))
+	created := contract(t, node, 1)
+	assertEq(t, reporterAddress, created.Reporter)
+	assertEq(t, assigneeAddress, created.Assignee)
+	assertEq(t, ContractStatusCreated, created.Status)
+	assertEq(t, 30, created.Reward)
+
+	// a replayed request and a request signed by another key are rejected
+	nonce := node.nonce(t, reporterAddress)
+	params := CreateContractParams{
+		From:         reporterAddress,
+		Assignee:     assigneeAddress,
+		ContractInfo: "task",
+		Reward:       30,
+		Nonce:        nonce - 1,
+		Signature:    node.sign(t, reporter, "ContractHandler.Create", OperationCreateContract, nonce-1, assigneeAddress, "task", 30)}
+	var txID string
+	assertErr(t, node.contracts.Create(params, &txID))
+	params.Nonce = nonce
+	params.Signature = node.sign(t, assignee, "ContractHandler.Create", OperationCreateContract, nonce, assigneeAddress, "task", 30)
+	assertErr(t, node.contracts.Create(params, &txID))
+	assertEq(t, nonce, node.nonce(t, reporterAddress))
+
+	// the balance entry created before the funds are checked is discarded with the request
+	height := len(node.Sp.Chain)
+	assertErr(t, node.createContract(t, assignee, reporterAddress, initialBalance+1))
+	assertEq(t, height, len(node.Sp.Chain))
+	_, found, err := node.contracts.queryBalance(&node.Sp.StateDb, assigneeAddress)
+	assertEq(t, nil, err)
+	assertEq(t, false, found)
+
+	// the permission is taken from every account, admins keep it
+	assertEq(t, nil, node.revokePermission(t, admin, RoleEveryone, OperationCreateContract))
+	assertErr(t, node.createContract(t, reporter, assigneeAddress, 10))
+	assertEq(t, nonce, node.nonce(t, reporterAddress))
+	assertEq(t, nil, node.createContract(t, admin, assigneeAddress, 10))
+	contracts, err := node.contracts.GetContractsOfUser(assigneeAddress)
+	assertEq(t, nil, err)
+	assertEq(t, 2, len(contracts))
+}
+
+// Check if a contract is only updated before its assignee signed it
+func TestContractUpdate(t *testing.T) {
+	producer, admin := newKey(t), newKey(t)
+	node := newTestChain(t, producer, admin.PublicKey())
+	reporter, assignee := newKey(t), newKey(t)
+	reporterAddress := node.createAccount(t, admin, reporter.PublicKey(), BasicAccountAccess)
+	assigneeAddress := node.createAccount(t, admin, assignee.PublicKey(), BasicAccountAccess)
+	assertEq(t, nil, node.createContract(t, reporter, assigneeAddress, 30))
+
+	assertEq(t, nil, node.updateContract(t, reporter, 1, assigneeAddress, 40))
+	updated := contract(t, node, 1)
+	assertEq(t, "updated", updated.ContractInfo)
+	assertEq(t, 40, updated.Reward)
+	assertErr(t, node.updateContract(t, reporter, 2, assigneeAddress, 40))
+
+	// only the assignee signs the contract, the reward is reserved
+	assertErr(t, node.signContract(t, reporter, 1))
+	assertEq(t, nil, node.signContract(t, assignee, 1))
+	assertEq(t, ContractStatusOpen, contract(t, node, 1).Status)
+	balance, err := node.contracts.GetBalance(reporterAddress, false)
+	assertEq(t, nil, err)
+	assertEq(t, initialBalance-40, balance)
+	nonce := node.nonce(t, reporterAddress)
+	assertErr(t, node.updateContract(t, reporter, 1, assigneeAddress, 10))
+	assertEq(t, nonce, node.nonce(t, reporterAddress))
+
+	assertEq(t, nil, node.createContract(t, reporter, assigneeAddress, 10))
+	assertEq(t, nil, node.revokePermission(t, admin, RoleEveryone, OperationUpdateContract))
+	assertErr(t, node.updateContract(t, reporter, 2, assigneeAddress, 20))
+	assertEq(t, 10, contract(t, node, 2).Reward)
+}
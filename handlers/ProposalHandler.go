@@ -0,0 +1,430 @@
+package handlers
+
+import (
+	"AdminBlockchain/storage"
+	"errors"
+	"fmt"
+)
+
+// Proposal states
+const (
+	//ProposalPending the proposal is waiting for approvals
+	ProposalPending = 0
+	//ProposalExecuted the proposal reached its threshold and the operation was applied
+	ProposalExecuted = 1
+	//ProposalFailed the proposal reached its threshold but the operation was rejected
+	ProposalFailed = 2
+	//ProposalExpired the deadline passed before the proposal reached its threshold, set by the first block after the deadline
+	ProposalExpired = 3
+)
+
+// Proposal an operation waiting for the approval of several admins
+type Proposal struct {
+	ID        int64
+	Operation string
+	Params    []interface{} // parameters of the operation
+	Proposer  Address
+	Deadline  int // last block height the proposal can be approved at
+	Status    int // one of the proposal states
+	Error     string
+	Approvals []Address // admins approving the proposal, including the proposer
+}
+
+// ProposalHandler handles operations which need the approval of several admins.
+// The amount of approvals is configured per operation, operations needing a single approval are applied directly.
+type ProposalHandler struct {
+	*BaseQueryHandler
+	Accounts *AccountHandler
+}
+
+// NewProposalHandler creates a proposal handler and registers its operations
+func NewProposalHandler(base *BaseQueryHandler, accounts *AccountHandler) *ProposalHandler {
+	handler := &ProposalHandler{BaseQueryHandler: base, Accounts: accounts}
+	base.RegisterOperation(OperationPropose, handler.propose)
+	base.RegisterOperation(OperationApprove, handler.approve)
+	base.RegisterOperation(OperationSetThreshold, handler.setThreshold)
+	base.RegisterBlockFunc(handler.expire)
+	return handler
+}
+
+// Module declares the proposal state, no operation needs several approvals until a threshold is set.
+// Since version 2 blocks close the proposals expiring at their height.
+func (handler *ProposalHandler) Module() Module {
+	return Module{
+		Name:    "proposals",
+		Version: 2,
+		Schema: []string{
+			"create table Proposals (operation text, request text, proposer text, deadline int, status int, error text)",
+			"create table ProposalApprovals (proposal int, admin text)",
+			"create table ApprovalThresholds (operation text, threshold int)"},
+		Migrations: []Migration{expireProposals},
+	}
+}
+
+// expire closes the pending proposals whose deadline passed, blocks of states before version 2 don't close them
+func (handler *ProposalHandler) expire(scope *TransactionScope) error {
+	version, err := moduleVersion(scope, "proposals")
+	if err != nil || version < 2 {
+		return err
+	}
+	return expireProposals(scope)
+}
+
+func expireProposals(scope *TransactionScope) error {
+	_, err := scope.ExecuteTransaction(
+		"update Proposals set status=? where status=? and deadline<?", ProposalExpired, ProposalPending, scope.height)
+	return err
+}
+
+// approvalThreshold returns the amount of admin approvals the operation needs
+func approvalThreshold(db queryer, operation string) (int, error) {
+	found, err := hasTable(db, "ApprovalThresholds")
+	if err != nil || !found {
+		return 1, err
+	}
+
+	rows, err := db.Query("select threshold from ApprovalThresholds where operation=?", operation)
+	if err != nil {
+		return 1, err
+	}
+	defer rows.Close()
+
+	threshold := 1
+	if rows.Next() {
+		err = rows.Scan(&threshold)
+	}
+	return threshold, err
+}
+
+// checkThreshold checks that the operation can be applied without a proposal
+func checkThreshold(db queryer, operation string) error {
+	threshold, err := approvalThreshold(db, operation)
+	if err != nil {
+		return err
+	}
+	if threshold > 1 {
+		return fmt.Errorf("operation %s needs a proposal approved by %d admins", operation, threshold)
+	}
+	return nil
+}
+
+// ProposeParams parameters for proposing an operation
+type ProposeParams struct {
+	From      Address       // who sends the transaction
+	Operation string        // operation tag, e.g. OperationCreateAccount
+	Params    []interface{} // parameters of the operation, as signed for a direct request
+	Lifetime  int           // amount of blocks the proposal can be approved for
+	Nonce     uint64        // next nonce of the sender
+	Signature []byte        // signature of the operation, the lifetime and the parameters
+}
+
+// Propose creates a proposal, approved by the sender. The operation is applied once enough admins approve it.
+func (handler *ProposalHandler) Propose(params ProposeParams, txID *string) error {
+	return handler.Submit(storage.Request{
+		Method:    "ProposalHandler.Propose",
+		Operation: OperationPropose,
+		Signer:    string(params.From),
+		Nonce:     params.Nonce,
+		Params:    append([]interface{}{params.Operation, params.Lifetime}, params.Params...),
+		Signature: params.Signature}, txID)
+}
+
+func (handler *ProposalHandler) propose(scope *TransactionScope, request storage.Request) error {
+	if len(request.Params) < 2 {
+		return errors.New("proposal needs an operation and a lifetime")
+	}
+	params := &requestParams{values: request.Params}
+	operation, lifetime := params.text(0), int(params.integer(1))
+	if params.err != nil {
+		return params.err
+	}
+
+	acc, err := handler.admin(scope, Address(request.Signer))
+	if err != nil {
+		return err
+	}
+	err = authorize(scope, acc, request)
+	if err != nil {
+		return err
+	}
+	if _, found := handler.operations.operations[operation]; !found {
+		return fmt.Errorf("unknown operation %q", operation)
+	}
+	if operation == OperationPropose || operation == OperationApprove {
+		return errors.New("proposals can't be proposed")
+	}
+	if lifetime < 1 {
+		return errors.New("proposal lifetime must be positive")
+	}
+
+	data, err := storage.Request{
+		Method:    request.Method,
+		Operation: operation,
+		Signer:    request.Signer,
+		Params:    request.Params[2:]}.Encode()
+	if err != nil {
+		return err
+	}
+	id, err := scope.ExecuteTransaction(
+		"insert into Proposals (operation, request, proposer, deadline, status, error) values (?, ?, ?, ?, ?, ?)",
+		operation, data, acc.Address, scope.height+lifetime, ProposalPending, "")
+	if err != nil {
+		return err
+	}
+	_, err = scope.ExecuteTransaction("insert into ProposalApprovals (proposal, admin) values (?, ?)", id, acc.Address)
+	if err != nil {
+		return err
+	}
+	return handler.executeIfApproved(scope, id)
+}
+
+// ApproveParams parameters for approving a proposal
+type ApproveParams struct {
+	ProposalID int64
+	From       Address // who sends the transaction
+	Nonce      uint64  // next nonce of the sender
+	Signature  []byte
+}
+
+// Approve adds the approval of the sender to the proposal
+func (handler *ProposalHandler) Approve(params ApproveParams, txID *string) error {
+	return handler.Submit(storage.Request{
+		Method:    "ProposalHandler.Approve",
+		Operation: OperationApprove,
+		Signer:    string(params.From),
+		Nonce:     params.Nonce,
+		Params:    []interface{}{params.ProposalID},
+		Signature: params.Signature}, txID)
+}
+
+func (handler *ProposalHandler) approve(scope *TransactionScope, request storage.Request) error {
+	params := readParams(request, 1)
+	id := params.integer(0)
+	if params.err != nil {
+		return params.err
+	}
+
+	acc, err := handler.admin(scope, Address(request.Signer))
+	if err != nil {
+		return err
+	}
+	err = authorize(scope, acc, request)
+	if err != nil {
+		return err
+	}
+	proposal, err := queryProposal(scope, id)
+	if err != nil {
+		return err
+	}
+	if proposal.Status != ProposalPending {
+		return errors.New("proposal is already closed")
+	}
+	if scope.height > proposal.Deadline {
+		return errors.New("proposal expired")
+	}
+	for _, admin := range proposal.Approvals {
+		if admin == acc.Address {
+			return errors.New("proposal already approved by the account")
+		}
+	}
+
+	_, err = scope.ExecuteTransaction("insert into ProposalApprovals (proposal, admin) values (?, ?)", id, acc.Address)
+	if err != nil {
+		return err
+	}
+	return handler.executeIfApproved(scope, id)
+}
+
+// executeIfApproved applies the operation of the proposal once it has enough approvals.
+// A rejected operation closes the proposal as failed, the approval itself is kept.
+func (handler *ProposalHandler) executeIfApproved(scope *TransactionScope, id int64) error {
+	proposal, err := queryProposal(scope, id)
+	if err != nil {
+		return err
+	}
+	threshold, err := approvalThreshold(scope, proposal.Operation)
+	if err != nil {
+		return err
+	}
+	// approvals of admins who were demoted or disabled since don't count
+	approvals := 0
+	for _, address := range proposal.Approvals {
+		acc, err := handler.Accounts.getAccountByAddress(scope, address)
+		if err != nil {
+			return err
+		}
+		if acc.AccessLevel == AdminAccountAccess && !acc.Disabled {
+			approvals++
+		}
+	}
+	if approvals < threshold {
+		return nil
+	}
+
+	request, err := queryProposalRequest(scope, id)
+	if err != nil {
+		return err
+	}
+	scope.approved = true
+	err = scope.savepoint(func(scope *TransactionScope) error {
+		return handler.operations.apply(scope, request)
+	})
+	scope.approved = false
+
+	status, message := ProposalExecuted, ""
+	if err != nil {
+		status, message = ProposalFailed, err.Error()
+	}
+	_, err = scope.ExecuteTransaction("update Proposals set status=?, error=? where rowid=?", status, message, id)
+	return err
+}
+
+// ThresholdParams parameters for setting the amount of approvals an operation needs
+type ThresholdParams struct {
+	From      Address // who sends the transaction
+	Operation string  // operation tag, e.g. OperationCreateAccount
+	Threshold int     // amount of admin approvals, 1 applies the operation directly
+	Nonce     uint64  // next nonce of the sender
+	Signature []byte
+}
+
+// SetThreshold sets the amount of admin approvals the operation needs. Once set for OperationSetThreshold
+// itself, thresholds can only be changed through a proposal.
+func (handler *ProposalHandler) SetThreshold(params ThresholdParams, txID *string) error {
+	return handler.Submit(storage.Request{
+		Method:    "ProposalHandler.SetThreshold",
+		Operation: OperationSetThreshold,
+		Signer:    string(params.From),
+		Nonce:     params.Nonce,
+		Params:    []interface{}{params.Operation, params.Threshold},
+		Signature: params.Signature}, txID)
+}
+
+func (handler *ProposalHandler) setThreshold(scope *TransactionScope, request storage.Request) error {
+	params := readParams(request, 2)
+	operation, threshold := params.text(0), int(params.integer(1))
+	if params.err != nil {
+		return params.err
+	}
+
+	acc, err := handler.admin(scope, Address(request.Signer))
+	if err != nil {
+		return err
+	}
+	err = authorize(scope, acc, request)
+	if err != nil {
+		return err
+	}
+	if _, found := handler.operations.operations[operation]; !found {
+		return fmt.Errorf("unknown operation %q", operation)
+	}
+	if operation == OperationPropose || operation == OperationApprove {
+		return errors.New("proposals can't need approvals")
+	}
+	if threshold < 1 {
+		return errors.New("threshold must be positive")
+	}
+
+	_, err = scope.ExecuteTransaction("delete from ApprovalThresholds where operation=?", operation)
+	if err != nil {
+		return err
+	}
+	_, err = scope.ExecuteTransaction("insert into ApprovalThresholds (operation, threshold) values (?, ?)", operation, threshold)
+	return err
+}
+
+// admin returns the account, only admins can propose and approve operations
+func (handler *ProposalHandler) admin(db queryer, addr Address) (Account, error) {
+	acc, err := handler.Accounts.getAccountByAddress(db, addr)
+	if err != nil {
+		return acc, err
+	}
+	if acc.AccessLevel != AdminAccountAccess {
+		return acc, errors.New("invalid access level")
+	}
+	return acc, nil
+}
+
+// ListProposals lists all proposals with their approvals
+func (handler *ProposalHandler) ListProposals() ([]Proposal, error) {
+	rows, err := handler.Sp.StateDb.Query("select rowid from Proposals order by rowid")
+	if err != nil {
+		return nil, err
+	}
+	var ids []int64
+	var id int64
+	for rows.Next() {
+		err = rows.Scan(&id)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	proposals := make([]Proposal, 0, len(ids))
+	for _, id := range ids {
+		proposal, err := queryProposal(&handler.Sp.StateDb, id)
+		if err != nil {
+			return nil, err
+		}
+		request, err := queryProposalRequest(&handler.Sp.StateDb, id)
+		if err != nil {
+			return nil, err
+		}
+		proposal.Params = request.Params
+		proposals = append(proposals, proposal)
+	}
+	return proposals, nil
+}
+
+func queryProposal(db queryer, id int64) (Proposal, error) {
+	proposal := Proposal{ID: id}
+	rows, err := db.Query("select operation, proposer, deadline, status, error from Proposals where rowid=?", id)
+	if err != nil {
+		return proposal, err
+	}
+	if !rows.Next() {
+		rows.Close()
+		return proposal, errors.New("proposal not found")
+	}
+	err = rows.Scan(&proposal.Operation, &proposal.Proposer, &proposal.Deadline, &proposal.Status, &proposal.Error)
+	rows.Close()
+	if err != nil {
+		return proposal, err
+	}
+
+	rows, err = db.Query("select admin from ProposalApprovals where proposal=? order by rowid", id)
+	if err != nil {
+		return proposal, err
+	}
+	defer rows.Close()
+	var admin Address
+	for rows.Next() {
+		err = rows.Scan(&admin)
+		if err != nil {
+			return proposal, err
+		}
+		proposal.Approvals = append(proposal.Approvals, admin)
+	}
+	return proposal, rows.Err()
+}
+
+func queryProposalRequest(db queryer, id int64) (storage.Request, error) {
+	rows, err := db.Query("select request from Proposals where rowid=?", id)
+	if err != nil {
+		return storage.Request{}, err
+	}
+	defer rows.Close()
+
+	var data string
+	if !rows.Next() {
+		return storage.Request{}, errors.New("proposal not found")
+	}
+	err = rows.Scan(&data)
+	if err != nil {
+		return storage.Request{}, err
+	}
+	return storage.DecodeRequest(data)
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"AdminBlockchain/utils"
+	"testing"
+)
+
+// setThreshold sets the amount of approvals the operation needs, signed by the sender
+func (node *testNode) setThreshold(t *testing.T, sender utils.SignatureCreator, operation string, threshold int) error {
+	t.Helper()
+	from := GetAddressFromPubKey(sender.PublicKey())
+	nonce := node.nonce(t, from)
+	var txID string
+	return node.proposals.SetThreshold(ThresholdParams{
+		From:      from,
+		Operation: operation,
+		Threshold: threshold,
+		Nonce:     nonce,
+		Signature: node.sign(t, sender, "ProposalHandler.SetThreshold", OperationSetThreshold, nonce, operation, threshold)}, &txID)
+}
+
+// proposeAccount proposes creating an account for the key, signed by the sender. Returns the id of the proposal.
+func (node *testNode) proposeAccount(t *testing.T, sender utils.SignatureCreator, key utils.SignatureValidator, lifetime int) int64 {
+	t.Helper()
+	pubKey, err := key.Store()
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := GetAddressFromPubKey(sender.PublicKey())
+	nonce := node.nonce(t, from)
+	var txID string
+	err = node.proposals.Propose(ProposeParams{
+		From:      from,
+		Operation: OperationCreateAccount,
+		Params:    []interface{}{"test", BasicAccountAccess, pubKey},
+		Lifetime:  lifetime,
+		Nonce:     nonce,
+		Signature: node.sign(t, sender, "ProposalHandler.Propose", OperationPropose, nonce,
+			OperationCreateAccount, lifetime, "test", BasicAccountAccess, pubKey)}, &txID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proposals, err := node.proposals.ListProposals()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return proposals[len(proposals)-1].ID
+}
+
+// approve approves the proposal, signed by the sender
+func (node *testNode) approve(t *testing.T, sender utils.SignatureCreator, id int64) error {
+	t.Helper()
+	from := GetAddressFromPubKey(sender.PublicKey())
+	nonce := node.nonce(t, from)
+	var txID string
+	return node.proposals.Approve(ApproveParams{
+		ProposalID: id,
+		From:       from,
+		Nonce:      nonce,
+		Signature:  node.sign(t, sender, "ProposalHandler.Approve", OperationApprove, nonce, id)}, &txID)
+}
+
+func proposalStatus(t *testing.T, node *testNode, id int64) int {
+	t.Helper()
+	proposal, err := queryProposal(&node.Sp.StateDb, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return proposal.Status
+}
+
+// newAdmins creates a chain with the amount of admins
+func newAdmins(t *testing.T, count int) (*testNode, []utils.SignatureCreator) {
+	producer := newKey(t)
+	admins := []utils.SignatureCreator{newKey(t)}
+	node := newTestChain(t, producer, admins[0].PublicKey())
+	for len(admins) < count {
+		admin := newKey(t)
+		node.createAccount(t, admins[0], admin.PublicKey(), AdminAccountAccess)
+		admins = append(admins, admin)
+	}
+	return node, admins
+}
+
+// Check if an operation needing two of three admins is applied once the second admin approves it
+func TestProposalThresholdReached(t *testing.T) {
+	node, admins := newAdmins(t, 3)
+	assertEq(t, nil, node.setThreshold(t, admins[0], OperationCreateAccount, 2))
+
+	user := newKey(t).PublicKey()
+	var txID string
+	nonce := node.nonce(t, GetAddressFromPubKey(admins[0].PublicKey()))
+	assertErr(t, node.accounts.CreateAccount(createAccountParams(t, node, admins[0], user, nonce), &txID))
+
+	id := node.proposeAccount(t, admins[0], user, 10)
+	assertEq(t, ProposalPending, proposalStatus(t, node, id))
+	assertErr(t, node.approve(t, admins[0], id))
+	exists, err := accountExists(&node.Sp.StateDb, GetAddressFromPubKey(user))
+	assertEq(t, nil, err)
+	assertEq(t, false, exists)
+
+	assertEq(t, nil, node.approve(t, admins[2], id))
+	assertEq(t, ProposalExecuted, proposalStatus(t, node, id))
+	exists, err = accountExists(&node.Sp.StateDb, GetAddressFromPubKey(user))
+	assertEq(t, nil, err)
+	assertEq(t, true, exists)
+	assertErr(t, node.approve(t, admins[1], id))
+}
+
+// Check if a proposal missing its threshold until the deadline is closed as expired by the next block
+func TestProposalThresholdMissed(t *testing.T) {
+	node, admins := newAdmins(t, 3)
+	assertEq(t, nil, node.setThreshold(t, admins[0], OperationCreateAccount, 3))
+	user := newKey(t).PublicKey()
+	id := node.proposeAccount(t, admins[0], user, 2)
+	assertEq(t, nil, node.approve(t, admins[1], id))
+
+	// blocks produced by other operations pass the deadline
+	adminAddress := GetAddressFromPubKey(admins[0].PublicKey())
+	assertEq(t, nil, node.updateAccount(t, admins[0], adminAddress, AdminAccountAccess))
+	assertEq(t, ProposalPending, proposalStatus(t, node, id))
+	assertEq(t, nil, node.updateAccount(t, admins[0], adminAddress, AdminAccountAccess))
+	assertEq(t, ProposalExpired, proposalStatus(t, node, id))
+
+	assertErr(t, node.approve(t, admins[2], id))
+	exists, err := accountExists(&node.Sp.StateDb, GetAddressFromPubKey(user))
+	assertEq(t, nil, err)
+	assertEq(t, false, exists)
+
+	// the expiry is part of the replayed state
+	replica := newTestNode(t, nil)
+	assertEq(t, nil, replica.syncFrom(node, nil))
+	assertEq(t, ProposalExpired, proposalStatus(t, replica, id))
+}
+
+// Check if approvals of admins disabled since don't count towards the threshold
+func TestProposalDisabledApprover(t *testing.T) {
+	node, admins := newAdmins(t, 4)
+	assertEq(t, nil, node.setThreshold(t, admins[0], OperationCreateAccount, 3))
+	user := newKey(t).PublicKey()
+	id := node.proposeAccount(t, admins[0], user, 10)
+	assertEq(t, nil, node.approve(t, admins[1], id))
+	assertEq(t, nil, node.setDisabled(t, admins[0], GetAddressFromPubKey(admins[1].PublicKey()), true))
+
+	assertEq(t, nil, node.approve(t, admins[2], id))
+	assertEq(t, ProposalPending, proposalStatus(t, node, id))
+	assertEq(t, nil, node.approve(t, admins[3], id))
+	assertEq(t, ProposalExecuted, proposalStatus(t, node, id))
+	exists, err := accountExists(&node.Sp.StateDb, GetAddressFromPubKey(user))
+	assertEq(t, nil, err)
+	assertEq(t, true, exists)
+}
@@ -0,0 +1,385 @@
+package handlers
+
+import (
+	"AdminBlockchain/storage"
+	"errors"
+	"fmt"
+)
+
+// Roles created with the chain. Admins can change their permissions and define new roles.
+const (
+	// RoleEveryone implicit role of every account
+	RoleEveryone = "everyone"
+	// RoleAccountManager manages user accounts
+	RoleAccountManager = "account-manager"
+	// RoleContractor works on contracts
+	RoleContractor = "contractor"
+)
+
+// Role a named set of permitted operations
+type Role struct {
+	Name       string
+	Operations []string  // operations the role permits
+	Members    []Address // accounts holding the role, empty for RoleEveryone
+}
+
+// RoleHandler manages roles and the operations they permit. Admin accounts are permitted every operation.
+type RoleHandler struct {
+	*BaseQueryHandler
+	Accounts *AccountHandler
+}
+
+// NewRoleHandler creates a role handler and registers its operations
+func NewRoleHandler(base *BaseQueryHandler, accounts *AccountHandler) *RoleHandler {
+	handler := &RoleHandler{BaseQueryHandler: base, Accounts: accounts}
+	base.RegisterOperation(OperationGrantPermission, handler.grant)
+	base.RegisterOperation(OperationRevokePermission, handler.revoke)
+	base.RegisterOperation(OperationAssignRole, handler.assign)
+	base.RegisterOperation(OperationUnassignRole, handler.unassign)
+	return handler
+}
+
+// defaultPermissions permissions of the roles created with the chain
+var defaultPermissions = map[string][]string{
+	RoleEveryone: {
+		OperationCreateContract,
+		OperationUpdateContract,
+		OperationSignContract,
+		OperationStartContract,
+		OperationResolveContract,
+		OperationAcceptContract,
+		OperationRotateKey},
+	RoleAccountManager: {
+		OperationCreateAccount,
+		OperationUpdateAccount,
+		OperationDisableAccount,
+		OperationEnableAccount},
+	RoleContractor: {
+		OperationSignContract,
+		OperationStartContract,
+		OperationResolveContract},
+}
+
+// Module declares the role state. Every account keeps the permissions it had before roles existed.
+func (handler *RoleHandler) Module() Module {
+	return Module{
+		Name:    "roles",
+		Version: 2,
+		Schema: []string{
+			"create table RolePermissions (role text, operation text)",
+			"create table AccountRoles (address text, role text)"},
+		Genesis: func(scope *TransactionScope) error {
+			for _, role := range []string{RoleEveryone, RoleAccountManager, RoleContractor} {
+				err := grantPermissions(scope, role, defaultPermissions[role]...)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Migrations: []Migration{handler.addKeyPermissions},
+	}
+}
+
+// addKeyPermissions permits key rotation to every account and disabling accounts to account managers
+func (handler *RoleHandler) addKeyPermissions(scope *TransactionScope) error {
+	err := grantPermissions(scope, RoleEveryone, OperationRotateKey)
+	if err != nil {
+		return err
+	}
+	return grantPermissions(scope, RoleAccountManager, OperationDisableAccount, OperationEnableAccount)
+}
+
+func grantPermissions(scope *TransactionScope, role string, operations ...string) error {
+	for _, operation := range operations {
+		_, err := scope.ExecuteTransaction("insert into RolePermissions (role, operation) values (?, ?)", role, operation)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// legacyAdminOperations operations which required admin access before roles existed
+var legacyAdminOperations = map[string]bool{
+	OperationCreateAccount: true,
+	OperationUpdateAccount: true,
+}
+
+// checkPermission checks that the account may perform the operation, either as an admin or through one of its roles
+func checkPermission(db queryer, acc Account, operation string) error {
+	if acc.AccessLevel == AdminAccountAccess {
+		return nil
+	}
+	found, err := hasTable(db, "RolePermissions")
+	if err != nil {
+		return err
+	}
+	if !found {
+		// blocks produced before the roles module was set up
+		if legacyAdminOperations[operation] {
+			return errors.New("invalid access level")
+		}
+		return nil
+	}
+
+	rows, err := db.Query(
+		"select 1 from RolePermissions where operation=? and (role=? or role in (select role from AccountRoles where address=?))",
+		operation, RoleEveryone, acc.Address)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return fmt.Errorf("operation %s not permitted", operation)
+	}
+	return nil
+}
+
+// PermissionParams parameters for granting or revoking a permission of a role
+type PermissionParams struct {
+	From      Address // who sends the transaction
+	Role      string  // role to change
+	Operation string  // operation tag, e.g. OperationCreateAccount
+	Nonce     uint64  // next nonce of the sender
+	Signature []byte
+}
+
+// Grant permits the operation to the role, creating the role if it has no permissions yet
+func (handler *RoleHandler) Grant(params PermissionParams, txID *string) error {
+	return handler.Submit(permissionRequest("RoleHandler.Grant", OperationGrantPermission, params), txID)
+}
+
+func (handler *RoleHandler) grant(scope *TransactionScope, request storage.Request) error {
+	params := readParams(request, 2)
+	role, operation := params.text(0), params.text(1)
+	if params.err != nil {
+		return params.err
+	}
+
+	err := handler.authorizeSigner(scope, request)
+	if err != nil {
+		return err
+	}
+	if _, found := handler.operations.operations[operation]; !found {
+		return fmt.Errorf("unknown operation %q", operation)
+	}
+	permitted, err := roleHasPermission(scope, role, operation)
+	if err != nil || permitted {
+		return err
+	}
+	_, err = scope.ExecuteTransaction("insert into RolePermissions (role, operation) values (?, ?)", role, operation)
+	return err
+}
+
+// Revoke removes the permission of the role to perform the operation
+func (handler *RoleHandler) Revoke(params PermissionParams, txID *string) error {
+	return handler.Submit(permissionRequest("RoleHandler.Revoke", OperationRevokePermission, params), txID)
+}
+
+func (handler *RoleHandler) revoke(scope *TransactionScope, request storage.Request) error {
+	params := readParams(request, 2)
+	role, operation := params.text(0), params.text(1)
+	if params.err != nil {
+		return params.err
+	}
+
+	err := handler.authorizeSigner(scope, request)
+	if err != nil {
+		return err
+	}
+	permitted, err := roleHasPermission(scope, role, operation)
+	if err != nil {
+		return err
+	}
+	if !permitted {
+		return errors.New("role doesn't have the permission")
+	}
+	_, err = scope.ExecuteTransaction("delete from RolePermissions where role=? and operation=?", role, operation)
+	return err
+}
+
+func permissionRequest(method string, operation string, params PermissionParams) storage.Request {
+	return storage.Request{
+		Method:    method,
+		Operation: operation,
+		Signer:    string(params.From),
+		Nonce:     params.Nonce,
+		Params:    []interface{}{params.Role, params.Operation},
+		Signature: params.Signature}
+}
+
+// RoleParams parameters for assigning a role to an account or removing it
+type RoleParams struct {
+	From      Address // who sends the transaction
+	Account   Address // account to change
+	Role      string
+	Nonce     uint64 // next nonce of the sender
+	Signature []byte
+}
+
+// Assign gives the role to the account
+func (handler *RoleHandler) Assign(params RoleParams, txID *string) error {
+	return handler.Submit(roleRequest("RoleHandler.Assign", OperationAssignRole, params), txID)
+}
+
+func (handler *RoleHandler) assign(scope *TransactionScope, request storage.Request) error {
+	params := readParams(request, 2)
+	account, role := Address(params.text(0)), params.text(1)
+	if params.err != nil {
+		return params.err
+	}
+
+	err := handler.authorizeSigner(scope, request)
+	if err != nil {
+		return err
+	}
+	if role == RoleEveryone {
+		return errors.New("every account holds the everyone role")
+	}
+	_, err = handler.Accounts.getAccountByAddress(scope, account)
+	if err != nil {
+		return err
+	}
+	roles, err := queryAccountRoles(scope, account)
+	if err != nil {
+		return err
+	}
+	for _, item := range roles {
+		if item == role {
+			return errors.New("account already holds the role")
+		}
+	}
+	_, err = scope.ExecuteTransaction("insert into AccountRoles (address, role) values (?, ?)", account, role)
+	return err
+}
+
+// Unassign removes the role from the account
+func (handler *RoleHandler) Unassign(params RoleParams, txID *string) error {
+	return handler.Submit(roleRequest("RoleHandler.Unassign", OperationUnassignRole, params), txID)
+}
+
+func (handler *RoleHandler) unassign(scope *TransactionScope, request storage.Request) error {
+	params := readParams(request, 2)
+	account, role := Address(params.text(0)), params.text(1)
+	if params.err != nil {
+		return params.err
+	}
+
+	err := handler.authorizeSigner(scope, request)
+	if err != nil {
+		return err
+	}
+	roles, err := queryAccountRoles(scope, account)
+	if err != nil {
+		return err
+	}
+	for _, item := range roles {
+		if item == role {
+			_, err = scope.ExecuteTransaction("delete from AccountRoles where address=? and role=?", account, role)
+			return err
+		}
+	}
+	return errors.New("account doesn't hold the role")
+}
+
+func roleRequest(method string, operation string, params RoleParams) storage.Request {
+	return storage.Request{
+		Method:    method,
+		Operation: operation,
+		Signer:    string(params.From),
+		Nonce:     params.Nonce,
+		Params:    []interface{}{params.Account, params.Role},
+		Signature: params.Signature}
+}
+
+// authorizeSigner authorizes a request signed by the account sending it
+func (handler *RoleHandler) authorizeSigner(scope *TransactionScope, request storage.Request) error {
+	acc, err := handler.Accounts.getAccountByAddress(scope, Address(request.Signer))
+	if err != nil {
+		return err
+	}
+	return authorize(scope, acc, request)
+}
+
+// ListRoles lists all roles with their permissions and members
+func (handler *RoleHandler) ListRoles() ([]Role, error) {
+	rows, err := handler.Sp.StateDb.Query(
+		"select role, operation from RolePermissions union select role, null from AccountRoles order by 1")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []Role
+	index := make(map[string]int)
+	var name string
+	var operation *string
+	for rows.Next() {
+		err = rows.Scan(&name, &operation)
+		if err != nil {
+			return nil, err
+		}
+		if _, found := index[name]; !found {
+			index[name] = len(roles)
+			roles = append(roles, Role{Name: name})
+		}
+		if operation != nil {
+			role := &roles[index[name]]
+			role.Operations = append(role.Operations, *operation)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	members, err := handler.Sp.StateDb.Query("select address, role from AccountRoles order by address")
+	if err != nil {
+		return nil, err
+	}
+	defer members.Close()
+	var address Address
+	for members.Next() {
+		err = members.Scan(&address, &name)
+		if err != nil {
+			return nil, err
+		}
+		role := &roles[index[name]]
+		role.Members = append(role.Members, address)
+	}
+	return roles, members.Err()
+}
+
+// GetRolesOfAccount lists the roles assigned to the account, RoleEveryone is not included
+func (handler *RoleHandler) GetRolesOfAccount(addr Address) ([]string, error) {
+	return queryAccountRoles(&handler.Sp.StateDb, addr)
+}
+
+func queryAccountRoles(db queryer, addr Address) ([]string, error) {
+	rows, err := db.Query("select role from AccountRoles where address=? order by role", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []string
+	var role string
+	for rows.Next() {
+		err = rows.Scan(&role)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, rows.Err()
+}
+
+func roleHasPermission(db queryer, role string, operation string) (bool, error) {
+	rows, err := db.Query("select 1 from RolePermissions where role=? and operation=?", role, operation)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	return rows.Next(), rows.Err()
+}
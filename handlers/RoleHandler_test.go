@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"AdminBlockchain/utils"
+	"testing"
+)
+
+// assignRole gives the role to the account, signed by the sender
+func (node *testNode) assignRole(t *testing.T, sender utils.SignatureCreator, account Address, role string) error {
+	t.Helper()
+	from := GetAddressFromPubKey(sender.PublicKey())
+	nonce := node.nonce(t, from)
+	var txID string
+	return node.roles.Assign(RoleParams{
+		From:      from,
+		Account:   account,
+		Role:      role,
+		Nonce:     nonce,
+		Signature: node.sign(t, sender, "RoleHandler.Assign", OperationAssignRole, nonce, account, role)}, &txID)
+}
+
+// Check if an account is only permitted the operations of its roles
+func TestRoleDenied(t *testing.T) {
+	producer, admin := newKey(t), newKey(t)
+	node := newTestChain(t, producer, admin.PublicKey())
+	user := newKey(t)
+	userAddress := node.createAccount(t, admin, user.PublicKey(), BasicAccountAccess)
+
+	var txID string
+	nonce := node.nonce(t, userAddress)
+	err := node.accounts.CreateAccount(createAccountParams(t, node, user, newKey(t).PublicKey(), nonce), &txID)
+	assertErr(t, err)
+	if err != nil {
+		assertEq(t, "operation "+OperationCreateAccount+" not permitted", err.Error())
+	}
+	assertEq(t, nonce, node.nonce(t, userAddress))
+
+	// roles are only assigned by admins
+	assertErr(t, node.assignRole(t, user, userAddress, RoleAccountManager))
+	assertEq(t, nil, node.assignRole(t, admin, userAddress, RoleAccountManager))
+	roles, err := node.roles.GetRolesOfAccount(userAddress)
+	assertEq(t, nil, err)
+	assertEq(t, 1, len(roles))
+	assertEq(t, RoleAccountManager, roles[0])
+
+	assertEq(t, nil, node.accounts.CreateAccount(createAccountParams(t, node, user, newKey(t).PublicKey(), nonce), &txID))
+	// the role doesn't permit giving admin access
+	params := createAccountParams(t, node, user, newKey(t).PublicKey(), nonce+1)
+	params.AccessLevel = AdminAccountAccess
+	params.Signature = node.sign(t, user, "AccountHandler.CreateAccount", OperationCreateAccount, nonce+1,
+		"test", AdminAccountAccess, params.PubKey)
+	assertErr(t, node.accounts.CreateAccount(params, &txID))
+}
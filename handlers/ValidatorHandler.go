@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"AdminBlockchain/storage"
+	"AdminBlockchain/utils"
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ProposerTimeout time the validator in turn has to produce a block, afterwards the turn passes to the next validator
+const ProposerTimeout = 3 * DefaultBlockInterval
+
+// MaxClockSkew how far the timestamp of a received block may be ahead of the clock of the node
+const MaxClockSkew = 2 * time.Second
+
+// Validator a key permitted to produce blocks
+type Validator struct {
+	Address Address // address of the key, stored as the producer of its blocks
+	PubKey  utils.SignatureValidator
+	Since   int // first block height the validator produces at
+	Until   int // block height the validator was removed at, 0 while it is part of the set
+}
+
+// ValidatorHandler manages the set of validators producing blocks. The validators take turns in the order of
+// their addresses, a block at height h is produced by validator (h + skipped turns) modulo the set size.
+// A turn is skipped every ProposerTimeout passing after the previous block, so an offline validator doesn't stop the chain.
+// Two validators may produce a block at the same height that way, nodes keep the block skipping fewer turns.
+type ValidatorHandler struct {
+	*BaseQueryHandler
+	Accounts *AccountHandler
+}
+
+// NewValidatorHandler creates a validator handler and registers its operations
+func NewValidatorHandler(base *BaseQueryHandler, accounts *AccountHandler) *ValidatorHandler {
+	handler := &ValidatorHandler{BaseQueryHandler: base, Accounts: accounts}
+	base.RegisterOperation(OperationAddValidator, handler.add)
+	base.RegisterOperation(OperationRemoveValidator, handler.remove)
+	return handler
+}
+
+// Module declares the validator state, the key producing the chain so far is the first validator
+func (handler *ValidatorHandler) Module(producer utils.SignatureValidator) Module {
+	return Module{
+		Name:    "validators",
+		Version: 1,
+		Schema:  []string{"create table Validators (address text, pkey blob, algorithm text, since int, until int default 0)"},
+		Genesis: func(scope *TransactionScope) error {
+			pubKey, err := producer.Store()
+			if err != nil {
+				return err
+			}
+			return insertValidator(scope, producer, pubKey)
+		},
+	}
+}
+
+// insertValidator adds the key to the set, it produces blocks starting with the block after the scope
+func insertValidator(scope *TransactionScope, key utils.SignatureValidator, pubKey []byte) error {
+	_, err := scope.ExecuteTransaction(
+		"insert into Validators (address, pkey, algorithm, since) values (?, ?, ?, ?)",
+		GetAddressFromPubKey(key),
+		pubKey,
+		key.Algorithm(),
+		scope.height+1)
+	return err
+}
+
+// ValidatorParams parameters for adding or removing a validator
+type ValidatorParams struct {
+	From      Address // who sends the transaction
+	PubKey    []byte  // PKIX encoded key of the added validator
+	Validator Address // address of the removed validator
+	Nonce     uint64  // next nonce of the sender
+	Signature []byte
+}
+
+// AddValidator adds a key to the validator set
+func (handler *ValidatorHandler) AddValidator(params ValidatorParams, txID *string) error {
+	return handler.Submit(storage.Request{
+		Method:    "ValidatorHandler.AddValidator",
+		Operation: OperationAddValidator,
+		Signer:    string(params.From),
+		Nonce:     params.Nonce,
+		Params:    []interface{}{params.PubKey},
+		Signature: params.Signature,
+	}, txID)
+}
+
+func (handler *ValidatorHandler) add(scope *TransactionScope, request storage.Request) error {
+	params := readParams(request, 1)
+	pubKey := params.bytes(0)
+	if params.err != nil {
+		return params.err
+	}
+
+	err := handler.authorizeSigner(scope, request)
+	if err != nil {
+		return err
+	}
+	key, err := utils.ParsePublicKey(pubKey)
+	if err != nil {
+		return err
+	}
+	validators, err := queryValidators(scope, scope.height+1)
+	if err != nil {
+		return err
+	}
+	for _, validator := range validators {
+		if validator.Address == GetAddressFromPubKey(key) {
+			return errors.New("already a validator")
+		}
+	}
+	return insertValidator(scope, key, pubKey)
+}
+
+// RemoveValidator removes a validator from the set, the set keeps at least one validator
+func (handler *ValidatorHandler) RemoveValidator(params ValidatorParams, txID *string) error {
+	return handler.Submit(storage.Request{
+		Method:    "ValidatorHandler.RemoveValidator",
+		Operation: OperationRemoveValidator,
+		Signer:    string(params.From),
+		Nonce:     params.Nonce,
+		Params:    []interface{}{params.Validator},
+		Signature: params.Signature,
+	}, txID)
+}
+
+func (handler *ValidatorHandler) remove(scope *TransactionScope, request storage.Request) error {
+	params := readParams(request, 1)
+	address := Address(params.text(0))
+	if params.err != nil {
+		return params.err
+	}
+
+	err := handler.authorizeSigner(scope, request)
+	if err != nil {
+		return err
+	}
+	validators, err := queryValidators(scope, scope.height+1)
+	if err != nil {
+		return err
+	}
+	for _, validator := range validators {
+		if validator.Address != address {
+			continue
+		}
+		if len(validators) == 1 {
+			return errors.New("the chain needs at least one validator")
+		}
+		_, err = scope.ExecuteTransaction(
+			"update Validators set until=? where address=? and until=0", scope.height+1, address)
+		return err
+	}
+	return errors.New("not a validator")
+}
+
+// authorizeSigner authorizes a request signed by the account sending it
+func (handler *ValidatorHandler) authorizeSigner(scope *TransactionScope, request storage.Request) error {
+	acc, err := handler.Accounts.getAccountByAddress(scope, Address(request.Signer))
+	if err != nil {
+		return err
+	}
+	return authorize(scope, acc, request)
+}
+
+// ListValidators lists the validators producing the next block, in the order they take turns
+func (handler *ValidatorHandler) ListValidators() ([]Validator, error) {
+	return queryValidators(&handler.Sp.StateDb, len(handler.Sp.Chain))
+}
+
+// queryValidators returns the validators producing blocks at the height, ordered by address.
+// Removed validators are kept in the state, so the set of every past height can be queried.
+func queryValidators(db queryer, height int) ([]Validator, error) {
+	found, err := hasTable(db, "Validators")
+	if err != nil || !found {
+		return nil, err
+	}
+
+	rows, err := db.Query(
+		"select address, pkey, algorithm, since, until from Validators where since<=? and (until=0 or until>?) order by address",
+		height, height)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var validators []Validator
+	var validator Validator
+	var pubKey []byte
+	var algorithm string
+	for rows.Next() {
+		err = rows.Scan(&validator.Address, &pubKey, &algorithm, &validator.Since, &validator.Until)
+		if err != nil {
+			return nil, err
+		}
+		validator.PubKey, err = utils.ParsePublicKeyWithAlgorithm(algorithm, pubKey)
+		if err != nil {
+			return nil, err
+		}
+		validators = append(validators, validator)
+	}
+	return validators, rows.Err()
+}
+
+// proposer returns the validator in turn at the time on top of the previous block, the turn passes to the next
+// validator every ProposerTimeout. Nodes only produce blocks in their turn, blocks of other validators are
+// verified by blockValidator.
+func proposer(validators []Validator, previous storage.Block, now int64) (Validator, error) {
+	elapsed := now - previous.Timestamp
+	if elapsed < 0 {
+		return Validator{}, errors.New("the previous block is newer than the clock")
+	}
+	turn := previous.ID + 1 + int(elapsed/int64(ProposerTimeout/time.Second))
+	return validators[turn%len(validators)], nil
+}
+
+// skippedTurns returns how many turns pass at the height before the validator with the address is in turn,
+// -1 if the address is not a validator
+func skippedTurns(validators []Validator, height int, address Address) int {
+	for i, validator := range validators {
+		if validator.Address == address {
+			return ((i-height)%len(validators) + len(validators)) % len(validators)
+		}
+	}
+	return -1
+}
+
+// blockValidator returns the key the block must be signed with, blocks produced before the chain had a validator
+// set are signed by the fallback key. The validator in turn at the height of the block may produce it right away,
+// the next validators after ProposerTimeout passed once for every skipped turn. The turn is taken from the previous
+// block and the clock of the receiving node, the block timestamp is chosen by the producer and is only trusted
+// up to MaxClockSkew ahead of the clock.
+func blockValidator(db queryer, chain storage.Blockchain, block storage.Block, fallback utils.SignatureValidator, now time.Time) (utils.SignatureValidator, error) {
+	validators, err := queryValidators(db, block.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(validators) == 0 {
+		return fallback, nil
+	}
+	if block.ID == 0 || block.ID > len(chain) {
+		return nil, errors.New("the previous block is missing")
+	}
+	previous := chain[block.ID-1]
+	if block.Timestamp < previous.Timestamp {
+		return nil, errors.New("block is older than the previous block")
+	}
+	if block.Timestamp > now.Add(MaxClockSkew).Unix() {
+		return nil, errors.New("block timestamp is in the future")
+	}
+
+	skipped := skippedTurns(validators, block.ID, Address(block.Producer))
+	if skipped < 0 {
+		return nil, fmt.Errorf("block %d is produced by %s, which is not a validator", block.ID, block.Producer)
+	}
+	wait := int64(skipped) * int64(ProposerTimeout/time.Second)
+	if block.Timestamp-previous.Timestamp < wait || now.Unix()-previous.Timestamp < wait {
+		return nil, fmt.Errorf("block %d is produced by %s before the validators in turn timed out", block.ID, block.Producer)
+	}
+	return validators[(block.ID+skipped)%len(validators)].PubKey, nil
+}
+
+// preferBlock decides between two valid blocks at the same height. The block skipping fewer turns wins,
+// if both skip as many turns the one with the lower hash. Every node decides the same, so the nodes
+// of a forked chain agree on the branch they keep.
+func preferBlock(db queryer, block storage.Block, other storage.Block) (bool, error) {
+	validators, err := queryValidators(db, block.ID)
+	if err != nil {
+		return false, err
+	}
+	if len(validators) > 0 {
+		skipped := skippedTurns(validators, block.ID, Address(block.Producer))
+		otherSkipped := skippedTurns(validators, other.ID, Address(other.Producer))
+		if skipped != otherSkipped {
+			return skipped < otherSkipped, nil
+		}
+	}
+	return bytes.Compare(block.Hash(), other.Hash()) < 0, nil
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"AdminBlockchain/storage"
+	"AdminBlockchain/utils"
+	"bytes"
+	"testing"
+	"time"
+)
+
+// addValidator adds the key to the validator set, signed by the admin
+func (node *testNode) addValidator(t *testing.T, admin utils.SignatureCreator, key utils.SignatureValidator) {
+	t.Helper()
+	pubKey, err := key.Store()
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := GetAddressFromPubKey(admin.PublicKey())
+	nonce := node.nonce(t, from)
+	var txID string
+	err = node.validators.AddValidator(ValidatorParams{
+		From:      from,
+		PubKey:    pubKey,
+		Nonce:     nonce,
+		Signature: node.sign(t, admin, "ValidatorHandler.AddValidator", OperationAddValidator, nonce, pubKey)}, &txID)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// blockAt builds a block on top of the chain of the node, produced by the key at the timestamp
+func blockAt(t *testing.T, node *testNode, key utils.SignatureCreator, timestamp int64) storage.Block {
+	t.Helper()
+	block := node.Sp.Chain.NextBlock()
+	block.Timestamp = timestamp
+	block.StateRoot = node.Sp.Chain[len(node.Sp.Chain)-1].StateRoot
+	block.Producer = string(GetAddressFromPubKey(key.PublicKey()))
+	err := block.Sign(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return block
+}
+
+// newValidatorChain creates a chain produced by two validators, returns the admin and the validator in turn at the next height first
+func newValidatorChain(t *testing.T) (*testNode, utils.SignatureCreator, utils.SignatureCreator, utils.SignatureCreator) {
+	producer, admin, other := newKey(t), newKey(t), newKey(t)
+	node := newTestChain(t, producer, admin.PublicKey())
+	node.addValidator(t, admin, other.PublicKey())
+
+	validators, err := node.validators.ListValidators()
+	assertEq(t, nil, err)
+	assertEq(t, 2, len(validators))
+	if validators[len(node.Sp.Chain)%2].Address == GetAddressFromPubKey(producer.PublicKey()) {
+		return node, admin, producer, other
+	}
+	return node, admin, other, producer
+}
+
+// Check if the validators take turns in the order of their addresses
+func TestValidatorRotation(t *testing.T) {
+	node, _, inTurn, next := newValidatorChain(t)
+	previous := node.Sp.Chain[len(node.Sp.Chain)-1]
+	now := time.Unix(previous.Timestamp+1, 0)
+
+	validators, err := node.validators.ListValidators()
+	assertEq(t, nil, err)
+	assertEq(t, true, bytes.Compare([]byte(validators[0].Address), []byte(validators[1].Address)) < 0)
+
+	block := blockAt(t, node, inTurn, now.Unix())
+	key, err := blockValidator(&node.Sp.StateDb, node.Sp.Chain, block, nil, now)
+	assertEq(t, nil, err)
+	assertEq(t, GetAddressFromPubKey(inTurn.PublicKey()), GetAddressFromPubKey(key))
+
+	_, err = blockValidator(&node.Sp.StateDb, node.Sp.Chain, blockAt(t, node, next, now.Unix()), nil, now)
+	assertErr(t, err)
+	_, err = blockValidator(&node.Sp.StateDb, node.Sp.Chain, blockAt(t, node, newKey(t), now.Unix()), nil, now)
+	assertErr(t, err)
+
+	// the turn passes to the other validator at the next height
+	err = node.Sp.AppendBlock(block)
+	assertEq(t, nil, err)
+	now = now.Add(time.Second)
+	_, err = blockValidator(&node.Sp.StateDb, node.Sp.Chain, blockAt(t, node, next, now.Unix()), nil, now)
+	assertEq(t, nil, err)
+	_, err = blockValidator(&node.Sp.StateDb, node.Sp.Chain, blockAt(t, node, inTurn, now.Unix()), nil, now)
+	assertErr(t, err)
+}
+
+// Check if the next validator may produce the block once the validator in turn timed out on the clock of the receiver
+func TestValidatorTimeout(t *testing.T) {
+	node, _, inTurn, next := newValidatorChain(t)
+	previous := node.Sp.Chain[len(node.Sp.Chain)-1]
+	timeout := previous.Timestamp + int64(ProposerTimeout/time.Second)
+
+	block := blockAt(t, node, next, timeout)
+	_, err := blockValidator(&node.Sp.StateDb, node.Sp.Chain, block, nil, time.Unix(timeout-1, 0))
+	assertErr(t, err)
+	key, err := blockValidator(&node.Sp.StateDb, node.Sp.Chain, block, nil, time.Unix(timeout, 0))
+	assertEq(t, nil, err)
+	assertEq(t, GetAddressFromPubKey(next.PublicKey()), GetAddressFromPubKey(key))
+
+	// the validator in turn may still produce the block, its block is preferred
+	late := blockAt(t, node, inTurn, timeout)
+	_, err = blockValidator(&node.Sp.StateDb, node.Sp.Chain, late, nil, time.Unix(timeout, 0))
+	assertEq(t, nil, err)
+	preferred, err := preferBlock(&node.Sp.StateDb, late, block)
+	assertEq(t, nil, err)
+	assertEq(t, true, preferred)
+	preferred, err = preferBlock(&node.Sp.StateDb, block, late)
+	assertEq(t, nil, err)
+	assertEq(t, false, preferred)
+}
+
+// Check if a validator can't take the turn by moving the timestamp of its block ahead of the clock of the receiver
+func TestValidatorForgedTimestamp(t *testing.T) {
+	node, _, inTurn, next := newValidatorChain(t)
+	previous := node.Sp.Chain[len(node.Sp.Chain)-1]
+	now := time.Unix(previous.Timestamp+1, 0)
+
+	forged := blockAt(t, node, next, previous.Timestamp+int64(ProposerTimeout/time.Second))
+	_, err := blockValidator(&node.Sp.StateDb, node.Sp.Chain, forged, nil, now)
+	assertErr(t, err)
+
+	// only a small clock skew is tolerated
+	skewed := blockAt(t, node, inTurn, now.Add(MaxClockSkew).Unix())
+	_, err = blockValidator(&node.Sp.StateDb, node.Sp.Chain, skewed, nil, now)
+	assertEq(t, nil, err)
+	future := blockAt(t, node, inTurn, now.Add(MaxClockSkew+time.Second).Unix())
+	_, err = blockValidator(&node.Sp.StateDb, node.Sp.Chain, future, nil, now)
+	assertErr(t, err)
+	old := blockAt(t, node, inTurn, previous.Timestamp-1)
+	_, err = blockValidator(&node.Sp.StateDb, node.Sp.Chain, old, nil, now)
+	assertErr(t, err)
+}
+
+// Check if a removed validator no longer produces blocks and the last validator is kept
+func TestValidatorRemove(t *testing.T) {
+	node, admin, inTurn, next := newValidatorChain(t)
+	from := GetAddressFromPubKey(admin.PublicKey())
+	remove := func(validator Address) error {
+		nonce := node.nonce(t, from)
+		var txID string
+		return node.validators.RemoveValidator(ValidatorParams{
+			From:      from,
+			Validator: validator,
+			Nonce:     nonce,
+			Signature: node.sign(t, admin, "ValidatorHandler.RemoveValidator", OperationRemoveValidator, nonce, validator)}, &txID)
+	}
+
+	// a block of the next validator wouldn't be accepted before the validator in turn timed out
+	node.SetSigner(next)
+	assertEq(t, ErrNotInTurn, remove(GetAddressFromPubKey(next.PublicKey())))
+
+	node.SetSigner(inTurn)
+	assertErr(t, remove(GetAddressFromPubKey(newKey(t).PublicKey())))
+	assertEq(t, nil, remove(GetAddressFromPubKey(next.PublicKey())))
+	validators, err := node.validators.ListValidators()
+	assertEq(t, nil, err)
+	assertEq(t, 1, len(validators))
+	assertEq(t, GetAddressFromPubKey(inTurn.PublicKey()), validators[0].Address)
+
+	previous := node.Sp.Chain[len(node.Sp.Chain)-1]
+	now := time.Unix(previous.Timestamp+int64(ProposerTimeout/time.Second), 0)
+	_, err = blockValidator(&node.Sp.StateDb, node.Sp.Chain, blockAt(t, node, next, now.Unix()), nil, now)
+	assertErr(t, err)
+	_, err = blockValidator(&node.Sp.StateDb, node.Sp.Chain, blockAt(t, node, inTurn, now.Unix()), nil, now)
+	assertEq(t, nil, err)
+
+	assertErr(t, remove(GetAddressFromPubKey(inTurn.PublicKey())))
+}
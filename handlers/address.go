@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"AdminBlockchain/utils"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Address layout: 0x, the first addressHashLength bytes of the key hash and addressChecksumLength bytes of checksum, hex encoded
+const (
+	addressHashLength     = 20
+	addressChecksumLength = 4
+	// legacyAddressLength hash bytes of addresses created before checksummed addresses
+	legacyAddressLength = 5
+)
+
+// GetAddressFromPubKey retrieves address from public key
+func GetAddressFromPubKey(key utils.SignatureValidator) Address {
+	rawData, _ := key.Store()
+	hash := utils.Hash(rawData)[:addressHashLength]
+	return Address(fmt.Sprintf("0x%x%x", hash, addressChecksum(hash)))
+}
+
+// legacyAddressFromPubKey retrieves the address accounts created before checksummed addresses have
+func legacyAddressFromPubKey(key utils.SignatureValidator) Address {
+	rawData, _ := key.Store()
+	return Address(fmt.Sprintf("0x%x", utils.Hash(rawData)[:legacyAddressLength]))
+}
+
+func addressChecksum(hash []byte) []byte {
+	checksum := sha256.Sum256(hash)
+	return checksum[:addressChecksumLength]
+}
+
+// ParseAddress validates an address typed by a user, the checksum detects typos.
+// Addresses of accounts created before checksummed addresses carry no checksum and are only checked for their format.
+func ParseAddress(text string) (Address, error) {
+	text = strings.ToLower(strings.TrimSpace(text))
+	if !strings.HasPrefix(text, "0x") {
+		return "", errors.New("address must start with 0x")
+	}
+	data, err := hex.DecodeString(text[2:])
+	if err != nil {
+		return "", errors.New("address must be hexadecimal")
+	}
+
+	switch len(data) {
+	case legacyAddressLength:
+		return Address(text), nil
+	case addressHashLength + addressChecksumLength:
+		if !bytes.Equal(addressChecksum(data[:addressHashLength]), data[addressHashLength:]) {
+			return "", errors.New("invalid address checksum, check the address for typos")
+		}
+		return Address(text), nil
+	default:
+		return "", errors.New("invalid address length")
+	}
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+// Check if addresses of keys parse back and typos are detected by the checksum
+func TestParseAddress(t *testing.T) {
+	key := newKey(t).PublicKey()
+	address := GetAddressFromPubKey(key)
+	assertEq(t, 2+2*(addressHashLength+addressChecksumLength), len(address))
+
+	parsed, err := ParseAddress(" 0x" + strings.ToUpper(string(address[2:])) + " ")
+	assertEq(t, nil, err)
+	assertEq(t, address, parsed)
+
+	// a single changed digit breaks the checksum
+	typo := []byte(address)
+	if typo[5] == '0' {
+		typo[5] = '1'
+	} else {
+		typo[5] = '0'
+	}
+	_, err = ParseAddress(string(typo))
+	assertErr(t, err)
+	if err != nil {
+		assertEq(t, "invalid address checksum, check the address for typos", err.Error())
+	}
+
+	for _, text := range []string{string(address[2:]), string(address) + "00", "0xzz", string(address[:len(address)-1])} {
+		_, err = ParseAddress(text)
+		assertErr(t, err)
+	}
+}
+
+// Check if addresses of accounts created before checksummed addresses are still accepted
+func TestParseLegacyAddress(t *testing.T) {
+	key := newKey(t).PublicKey()
+	legacy := legacyAddressFromPubKey(key)
+	parsed, err := ParseAddress(string(legacy))
+	assertEq(t, nil, err)
+	assertEq(t, legacy, parsed)
+	assertEq(t, false, legacy == GetAddressFromPubKey(key))
+}
@@ -3,55 +3,206 @@ package handlers
 import (
 	"AdminBlockchain/storage"
 	"AdminBlockchain/utils"
-	"encoding/base64"
+	"errors"
 	"fmt"
-	"os"
-	"strings"
+	"log"
+	"sync"
+	"time"
 )
 
+// ErrNotInTurn the node isn't the validator in turn to produce the block
+var ErrNotInTurn = errors.New("not the validator in turn")
+
 // BaseQueryHandler a pass-through for acessing the database.
 type BaseQueryHandler struct {
-	Sp storage.Provider
+	Sp         storage.Provider
+	Pool       *TransactionPool // queues client transactions for the block producer, applied right away if not set
+	builder    storage.BlockBuilder
+	operations dispatcher
+	modules    []Module
+	scopeMutex sync.Mutex
+	validator  utils.SignatureValidator // key of the block producer before the chain had a validator set
 }
 
-// NewBaseHandler creates a new handler for the specified path
-func NewBaseHandler(path string) *BaseQueryHandler {
+// NewBaseHandler creates a new handler. Block signatures are verified with the validator key if it is set,
+// blocks produced after the chain got a validator set are verified with the key of the validator in turn.
+// The chain is loaded by Load, after the handlers replaying its operations are created.
+func NewBaseHandler(validator utils.SignatureValidator) *BaseQueryHandler {
 	var handler BaseQueryHandler
-	handler.Load(path)
+	handler.validator = validator
 	return &handler
 }
 
+// NewBaseHandlerWithBackend creates a new handler keeping its chain and state in the specified storage backend
+func NewBaseHandlerWithBackend(validator utils.SignatureValidator, backend storage.Backend) *BaseQueryHandler {
+	handler := NewBaseHandler(validator)
+	handler.Sp.Backend = backend
+	return handler
+}
+
+// SetSigner sets the key used to sign produced blocks
+func (handler *BaseQueryHandler) SetSigner(signer utils.SignatureCreator) {
+	handler.builder.Signer = signer
+	handler.builder.Producer = string(GetAddressFromPubKey(signer.PublicKey()))
+}
+
+// Locker returns the lock held by transaction scopes, blocks synchronized from other validators are appended under it
+func (handler *BaseQueryHandler) Locker() sync.Locker {
+	return &handler.scopeMutex
+}
+
+// InTurn checks if the node is the validator in turn to produce the next block. The end of a turn is left
+// to synchronize the blocks of the node, so the next validator doesn't produce a block at the same height.
+func (handler *BaseQueryHandler) InTurn() (bool, error) {
+	handler.scopeMutex.Lock()
+	defer handler.scopeMutex.Unlock()
+
+	height := len(handler.Sp.Chain)
+	validators, err := queryValidators(&handler.Sp.StateDb, height)
+	if err != nil || len(validators) == 0 || height == 0 {
+		return true, err
+	}
+	now := time.Now()
+	for _, at := range []time.Time{now, now.Add(DefaultBlockInterval)} {
+		validator, err := proposer(validators, handler.Sp.Chain[height-1], at.Unix())
+		if err != nil || validator.Address != Address(handler.builder.Producer) {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// inTurn checks if the other nodes accept a block of the node at the height at the time, see blockValidator.
+// Any node is in turn if the chain has no validator set or no blocks.
+func (handler *BaseQueryHandler) inTurn(db queryer, height int, now int64) (bool, error) {
+	validators, err := queryValidators(db, height)
+	if err != nil || len(validators) == 0 || height == 0 {
+		return true, err
+	}
+	skipped := skippedTurns(validators, height, Address(handler.builder.Producer))
+	if skipped < 0 {
+		return false, nil
+	}
+	return now-handler.Sp.Chain[height-1].Timestamp >= int64(skipped)*int64(ProposerTimeout/time.Second), nil
+}
+
+// checkProducer verifies that the block is signed by the validator in turn at its height
+func (handler *BaseQueryHandler) checkProducer(db queryer, block storage.Block) error {
+	validator, err := blockValidator(db, handler.Sp.Chain, block, handler.validator, time.Now())
+	if err == nil && validator != nil && block.Version >= storage.SignedBlockVersion {
+		err = block.CheckSignature(validator)
+	}
+	if err != nil {
+		return fmt.Errorf("block %d: %v", block.ID, err)
+	}
+	return nil
+}
+
 //Load loads the chain state from the specified path
 func (handler *BaseQueryHandler) Load(path string) {
 	handler.Close()
 	handler.Sp.LoadChain(path)
+	utils.LogErrorF(handler.Sp.OpenState(false))
+	utils.LogErrorF(handler.Recover())
+}
 
-	os.Remove(storage.StateDbPath)
-	handler.Sp.StateDb.OpenDb(storage.StateDbPath)
+// Recover reconciles the state database with the chain. Blocks missing in the state are replayed,
+// a state that doesn't match the chain is restored from the newest valid snapshot or rebuilt from scratch.
+func (handler *BaseQueryHandler) Recover() error {
+	info, found, err := storage.ReadStateInfo(&handler.Sp.StateDb)
+	if err != nil || !found || !info.Matches(handler.Sp.Chain) {
+		handler.Sp.StateDb.Close()
+		info = storage.StateInfo{}
+
+		reset := true
+		snapshot, found := handler.Sp.LatestSnapshot()
+		if found && storage.RestoreSnapshot(snapshot, storage.StateDbPath) == nil {
+			log.Printf("Restored state snapshot at block height %d", snapshot.Height)
+			info = snapshot.StateInfo
+			reset = false
+		} else if len(handler.Sp.Chain) > 0 {
+			log.Print("State database doesn't match the chain, rebuilding...")
+		}
+		err = handler.Sp.OpenState(reset)
+		if err != nil {
+			return err
+		}
+	}
 
-	for _, block := range handler.Sp.Chain {
-		handler.AcceptBlock(block)
+	// applied blocks are verified against the validator sets kept in the state, replayed blocks before they are applied
+	for _, block := range handler.Sp.Chain[:info.Height] {
+		err = handler.checkProducer(&handler.Sp.StateDb, block)
+		if err != nil {
+			return err
+		}
+	}
+	if info.Height < len(handler.Sp.Chain) {
+		log.Printf("Replaying %d blocks...", len(handler.Sp.Chain)-info.Height)
 	}
+	for _, block := range handler.Sp.Chain[info.Height:] {
+		err = handler.checkProducer(&handler.Sp.StateDb, block)
+		if err != nil {
+			return err
+		}
+		err = handler.AcceptBlock(block)
+		if err != nil {
+			return fmt.Errorf("block %d: %v", block.ID, err)
+		}
+	}
+	return nil
 }
 
-// AcceptBlock at the top of chain
-func (handler *BaseQueryHandler) AcceptBlock(block storage.Block) {
-	params := strings.Split(block.Data, ";")
-	if len(params) > 0 {
-		args := make([]interface{}, len(params[1:]))
-		for i := 0; i < len(args); i++ {
-			var rawData string
-			n, _ := fmt.Sscanf(params[i+1], "{raw}%s{raw}", &rawData)
-			if n == 1 {
-				data, err := base64.StdEncoding.DecodeString(rawData[:len(rawData)-5])
-				utils.LogErrorF(err)
-				args[i] = data
+// AcceptBlock applies the block at the top of chain to the state database. Client requests are applied by the
+// operations registered for them. Nothing is applied if the resulting state doesn't match the state root of the block
+// or a request of the block is rejected.
+func (handler *BaseQueryHandler) AcceptBlock(block storage.Block) error {
+	tx, err := handler.Sp.StateDb.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// the scope only runs the operations, the block is already part of the chain
+	scope := &TransactionScope{handler: handler, tx: tx, applying: true, height: block.ID, version: block.Version}
+	for _, data := range block.Transactions {
+		if storage.IsRequest(data) {
+			request, err := storage.DecodeRequest(data)
+			if err != nil {
+				return err
+			}
+			if block.Version >= storage.OperationBlockVersion {
+				err = handler.operations.apply(scope, request)
 			} else {
-				args[i] = params[i+1]
+				err = verifyRequest(tx, request)
+			}
+			if err != nil {
+				return fmt.Errorf("request %s: %v", request.Method, err)
 			}
+			continue
 		}
-		handler.Sp.StateDb.Transact(params[0], args...)
+		decoded, err := storage.DecodeTransaction(data)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Transact(decoded.Query, decoded.Params...)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = handler.operations.finishBlock(scope)
+	if err != nil {
+		return err
+	}
+	err = storage.VerifyStateRoot(tx, block)
+	if err != nil {
+		return err
+	}
+	err = storage.WriteStateInfo(tx, block)
+	if err != nil {
+		return err
 	}
+	return tx.Commit()
 }
 
 //ExecuteQuery performs a query on the database
@@ -86,29 +237,55 @@ func (handler *BaseQueryHandler) ExecuteQuery(query string, params ...interface{
 	return cols, rowText, nil
 }
 
-//ExecuteTransaction performs a transaction and stores it in the blockchain
+//ExecuteTransaction performs a single statement and stores it in a new block
 func (handler *BaseQueryHandler) ExecuteTransaction(query string, params ...interface{}) (int64, error) {
-	inserted, err := handler.Sp.StateDb.Transact(query, params...)
+	scope, err := handler.Begin()
 	if err != nil {
 		return -1, err
 	}
+	defer scope.Rollback()
 
-	txData := query
-	for _, param := range params {
-		switch param.(type) {
-		case []byte:
-			bytes := param.([]byte)
-			txData += fmt.Sprintf(";{raw}%v{raw}", base64.StdEncoding.EncodeToString(bytes))
-		default:
-			txData += fmt.Sprintf(";%v", param)
-		}
+	inserted, err := scope.ExecuteTransaction(query, params...)
+	if err != nil {
+		return -1, err
 	}
-
-	handler.Sp.Chain.AddBlock(txData)
-	return inserted, nil
+	return inserted, scope.Commit()
 }
 
 //Close saves the state database and closes the connection
 func (handler *BaseQueryHandler) Close() {
 	handler.Sp.Close()
 }
+
+// hasTable checks if the state has the table
+func hasTable(db queryer, table string) (bool, error) {
+	rows, err := db.Query("select name from sqlite_master where type='table' and name=?", table)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	return rows.Next(), rows.Err()
+}
+
+// hasColumn checks if a table of the state has the column
+func hasColumn(db queryer, table string, column string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	var cid, notNull, pk int
+	var name, columnType string
+	var defaultValue interface{}
+	for rows.Next() {
+		err = rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &pk)
+		if err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
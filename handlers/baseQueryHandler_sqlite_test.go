@@ -0,0 +1,50 @@
+//go:build cgo
+// +build cgo
+
+package handlers
+
+import (
+	"AdminBlockchain/storage"
+	"bytes"
+	"testing"
+)
+
+// Check if a block persisted before its state was committed is replayed when the node restarts
+func TestRecoverUncommittedBlock(t *testing.T) {
+	producer, admin := newKey(t), newKey(t)
+	dir := t.TempDir()
+	node := setupTestChain(t, loadTestNode(t, producer.PublicKey(), storage.SQLiteBackend{}, dir), producer, admin.PublicKey())
+	node.createAccount(t, admin, newKey(t).PublicKey(), BasicAccountAccess)
+
+	// the node stops after the block is stored, before the state changes are committed
+	adminAddress := GetAddressFromPubKey(admin.PublicKey())
+	user := newKey(t).PublicKey()
+	request := createAccountRequest(createAccountParams(t, node, admin, user, node.nonce(t, adminAddress)))
+	scope, err := node.Begin()
+	assertEq(t, nil, err)
+	assertEq(t, nil, scope.apply(request))
+	stateRoot, err := storage.ComputeStateRoot(scope.tx)
+	assertEq(t, nil, err)
+	block, err := node.builder.Build(&node.Sp.Chain, stateRoot, scope.transactions...)
+	assertEq(t, nil, err)
+	assertEq(t, nil, node.Sp.AppendBlock(block))
+	assertEq(t, nil, scope.Rollback())
+	exists, err := accountExists(&node.Sp.StateDb, GetAddressFromPubKey(user))
+	assertEq(t, nil, err)
+	assertEq(t, false, exists)
+	node.Close()
+
+	restarted := loadTestNode(t, producer.PublicKey(), storage.SQLiteBackend{}, dir)
+	assertEq(t, block.ID+1, len(restarted.Sp.Chain))
+	exists, err = accountExists(&restarted.Sp.StateDb, GetAddressFromPubKey(user))
+	assertEq(t, nil, err)
+	assertEq(t, true, exists)
+	info, found, err := storage.ReadStateInfo(&restarted.Sp.StateDb)
+	assertEq(t, nil, err)
+	assertEq(t, true, found)
+	assertEq(t, true, info.Matches(restarted.Sp.Chain))
+	assertEq(t, len(restarted.Sp.Chain), info.Height)
+	root, err := storage.ComputeStateRoot(&restarted.Sp.StateDb)
+	assertEq(t, nil, err)
+	assertEq(t, true, bytes.Equal(block.StateRoot, root))
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"AdminBlockchain/storage"
+	"AdminBlockchain/utils"
+	"errors"
+	"testing"
+)
+
+// appendSignedBlock appends a block signed by the producer to the chain of the node without applying it
+func appendSignedBlock(t *testing.T, node *testNode, producer utils.SignatureCreator, transactions ...string) {
+	t.Helper()
+	builder := storage.BlockBuilder{Signer: producer, Producer: string(GetAddressFromPubKey(producer.PublicKey()))}
+	chain := node.Sp.Chain
+	block, err := builder.Build(&chain, chain[len(chain)-1].StateRoot, transactions...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = node.Sp.AppendBlock(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Check if a replaying node rejects a block holding a request the signer didn't sign, even if the producer signed the block
+func TestReplayForgedRequest(t *testing.T) {
+	producer, admin := newKey(t), newKey(t)
+	node := newTestChain(t, producer, admin.PublicKey())
+	node.createAccount(t, admin, newKey(t).PublicKey(), BasicAccountAccess)
+
+	adminAddress := GetAddressFromPubKey(admin.PublicKey())
+	user := newKey(t).PublicKey()
+	forged := createAccountParams(t, node, newKey(t), user, node.nonce(t, adminAddress))
+	forged.From = adminAddress
+	data, err := createAccountRequest(forged).Encode()
+	assertEq(t, nil, err)
+	appendSignedBlock(t, node, producer, data)
+
+	replica := newTestNode(t, producer.PublicKey())
+	assertErr(t, replica.syncFrom(node, producer.PublicKey()))
+	assertEq(t, len(node.Sp.Chain)-1, len(replica.Sp.Chain))
+	exists, err := accountExists(&replica.Sp.StateDb, GetAddressFromPubKey(user))
+	assertEq(t, nil, err)
+	assertEq(t, false, exists)
+}
+
+// Check if a block with a failing statement is rejected instead of being applied partially
+func TestReplayFailedStatement(t *testing.T) {
+	producer, admin := newKey(t), newKey(t)
+	node := newTestChain(t, producer, admin.PublicKey())
+
+	var transactions []string
+	for _, query := range []string{"create table Notes (text text)", "insert into Notes values ('note')", "insert into Missing values (1)"} {
+		data, err := storage.Transaction{Query: query}.Encode()
+		assertEq(t, nil, err)
+		transactions = append(transactions, data)
+	}
+	appendSignedBlock(t, node, producer, transactions...)
+
+	replica := newTestNode(t, producer.PublicKey())
+	var statementErr *storage.StatementError
+	assertEq(t, true, errors.As(replica.syncFrom(node, producer.PublicKey()), &statementErr))
+	assertEq(t, len(node.Sp.Chain)-1, len(replica.Sp.Chain))
+	found, err := hasTable(&replica.Sp.StateDb, "Notes")
+	assertEq(t, nil, err)
+	assertEq(t, false, found)
+}
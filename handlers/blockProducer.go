@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"AdminBlockchain/utils"
+	"log"
+	"time"
+)
+
+// DefaultBlockInterval time between produced blocks
+const DefaultBlockInterval = 5 * time.Second
+
+// BlockProducer seals pooled transactions into blocks on an interval, or earlier once the pool holds enough transactions
+type BlockProducer struct {
+	Pool     *TransactionPool
+	Interval time.Duration
+	stop     chan bool
+	stopped  chan bool
+}
+
+// Start starts producing blocks in the background
+func (producer *BlockProducer) Start() {
+	if producer.Interval <= 0 {
+		producer.Interval = DefaultBlockInterval
+	}
+	producer.stop = make(chan bool)
+	producer.stopped = make(chan bool)
+	go producer.run()
+}
+
+func (producer *BlockProducer) run() {
+	ticker := time.NewTicker(producer.Interval)
+	defer ticker.Stop()
+	defer close(producer.stopped)
+
+	for {
+		select {
+		case <-producer.stop:
+			producer.seal()
+			return
+		case <-ticker.C:
+		case <-producer.Pool.full:
+		}
+		producer.seal()
+	}
+}
+
+// seal seals a block if the node is the validator in turn, otherwise the transactions wait for its next turn
+func (producer *BlockProducer) seal() {
+	inTurn, err := producer.Pool.handler.InTurn()
+	if err != nil || !inTurn {
+		utils.LogError(err)
+		return
+	}
+	count, err := producer.Pool.Seal()
+	utils.LogError(err)
+	if count > 0 {
+		log.Printf("Sealed %d transactions into a block", count)
+	}
+}
+
+// Stop seals the remaining transactions and stops producing blocks
+func (producer *BlockProducer) Stop() {
+	if producer.stop == nil {
+		return
+	}
+	producer.stop <- true
+	<-producer.stopped
+	producer.stop = nil
+}
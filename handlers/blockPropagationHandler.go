@@ -5,12 +5,14 @@ import (
 	"AdminBlockchain/utils"
 	"errors"
 	"log"
+	"sync"
 )
 
 // BlockPropagationHandler for syncing clients with the blockchain.
 type BlockPropagationHandler struct {
-	Signer  utils.SignatureCreator
+	Signer  utils.SignatureCreator // signs blocks produced before signatures were persisted, they are served unsigned if not set
 	Storage *storage.Provider
+	Lock    sync.Locker // held while the chain is read, the lock blocks are added and removed under
 }
 
 // SignedBlockData block data signed with private key of the server
@@ -27,11 +29,22 @@ func (bp *BlockPropagationHandler) checkState() error {
 	return nil
 }
 
+// lock locks the chain if the handler has a lock, returns the function unlocking it
+func (bp *BlockPropagationHandler) lock() func() {
+	if bp.Lock == nil {
+		return func() {}
+	}
+	bp.Lock.Lock()
+	return bp.Lock.Unlock
+}
+
 // GetBlockHeight rpc method, returns the current block height
 func (bp *BlockPropagationHandler) GetBlockHeight(_, height *int) error {
 	var err = bp.checkState()
 	if err == nil {
+		unlock := bp.lock()
 		*height = len(bp.Storage.Chain)
+		unlock()
 	}
 	return err
 }
@@ -39,17 +52,31 @@ func (bp *BlockPropagationHandler) GetBlockHeight(_, height *int) error {
 // GetBlock rpc method, returns specified block
 func (bp *BlockPropagationHandler) GetBlock(index int, block *SignedBlockData) error {
 	var err = bp.checkState()
-	if err == nil && index > len(bp.Storage.Chain) {
-		err = errors.New("Invalid index")
+	if err != nil {
+		return err
 	}
 
-	if err == nil {
-		(*block).BlockData.ID = bp.Storage.Chain[index].ID
-		(*block).BlockData.Data = bp.Storage.Chain[index].Data
-		(*block).BlockData.PrevHash = make([]byte, len(bp.Storage.Chain[index].PrevHash))
-		for i, item := range bp.Storage.Chain[index].PrevHash {
-			(*block).BlockData.PrevHash[i] = item
-		}
+	unlock := bp.lock()
+	if index < 0 || index >= len(bp.Storage.Chain) {
+		unlock()
+		return errors.New("Invalid index")
+	}
+	stored := bp.Storage.Chain[index]
+	unlock()
+
+	(*block).BlockData.Version = stored.Version
+	(*block).BlockData.ID = stored.ID
+	(*block).BlockData.PrevHash = append([]byte{}, stored.PrevHash...)
+	(*block).BlockData.MerkleRoot = append([]byte{}, stored.MerkleRoot...)
+	(*block).BlockData.StateRoot = append([]byte{}, stored.StateRoot...)
+	(*block).BlockData.Timestamp = stored.Timestamp
+	(*block).BlockData.Producer = stored.Producer
+	(*block).BlockData.Signature = append([]byte{}, stored.Signature...)
+	(*block).BlockData.Transactions = append([]string{}, stored.Transactions...)
+	if len((*block).BlockData.Signature) > 0 {
+		(*block).Signature = (*block).BlockData.Signature
+	} else if bp.Signer != nil {
+		// blocks produced before signatures were persisted are signed on request
 		(*block).Signature, err = bp.Signer.Sign((*block).BlockData.Hash())
 		utils.LogError(err)
 	}
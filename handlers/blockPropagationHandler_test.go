@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"AdminBlockchain/network"
+	"AdminBlockchain/storage"
+	"AdminBlockchain/utils"
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+// Check if propagated blocks carry the state root and signature of the stored blocks
+func TestGetBlockStateRoot(t *testing.T) {
+	producer, admin := newKey(t), newKey(t)
+	node := newTestChain(t, producer, admin.PublicKey())
+	node.createAccount(t, admin, newKey(t).PublicKey(), BasicAccountAccess)
+
+	propagation := BlockPropagationHandler{Storage: &node.Sp}
+	for index, stored := range node.Sp.Chain {
+		var block SignedBlockData
+		assertEq(t, nil, propagation.GetBlock(index, &block))
+		assertEq(t, true, len(block.BlockData.StateRoot) > 0)
+		assertEq(t, true, bytes.Equal(block.BlockData.StateRoot, stored.StateRoot))
+		assertEq(t, true, bytes.Equal(block.BlockData.Hash(), stored.Hash()))
+		assertEq(t, true, bytes.Equal(block.Signature, stored.Signature))
+	}
+
+	var block SignedBlockData
+	assertErr(t, propagation.GetBlock(len(node.Sp.Chain), &block))
+	assertErr(t, propagation.GetBlock(-1, &block))
+}
+
+// Check if a synchronized node verifies the state roots of the blocks and reaches the state of the producer
+func TestSyncStateRoot(t *testing.T) {
+	producer, admin := newKey(t), newKey(t)
+	node := newTestChain(t, producer, admin.PublicKey())
+	node.createAccount(t, admin, newKey(t).PublicKey(), BasicAccountAccess)
+
+	replica := newTestNode(t, producer.PublicKey())
+	assertEq(t, nil, replica.syncFrom(node, producer.PublicKey()))
+	assertEq(t, len(node.Sp.Chain), len(replica.Sp.Chain))
+	root, err := storage.ComputeStateRoot(&replica.Sp.StateDb)
+	assertEq(t, nil, err)
+	assertEq(t, true, bytes.Equal(root, node.Sp.Chain[len(node.Sp.Chain)-1].StateRoot))
+}
+
+// Check if blocks are served while the node appends blocks, run with -race
+func TestGetBlockConcurrent(t *testing.T) {
+	producer, admin := newKey(t), newKey(t)
+	node := newTestChain(t, producer, admin.PublicKey())
+	propagation := BlockPropagationHandler{Storage: &node.Sp, Lock: node.Locker()}
+
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			var height int
+			propagation.GetBlockHeight(nil, &height)
+			var block SignedBlockData
+			if propagation.GetBlock(height-1, &block) != nil {
+				t.Errorf("block %d is missing", height-1)
+				return
+			}
+		}
+	}()
+	for i := 0; i < 5; i++ {
+		node.createAccount(t, admin, newKey(t).PublicKey(), BasicAccountAccess)
+	}
+	<-done
+}
+
+// newLegacyChain creates a node with unsigned legacy blocks, continued with blocks signed through a signer daemon
+func newLegacyChain(t *testing.T, producer utils.SignatureCreator) *testNode {
+	t.Helper()
+	node := newTestNode(t, producer.PublicKey())
+	create, err := storage.Transaction{Query: "create table Notes (text text)"}.Encode()
+	assertEq(t, nil, err)
+	insert, err := storage.Transaction{Query: "insert into Notes values (?)", Params: []interface{}{"legacy"}}.Encode()
+	assertEq(t, nil, err)
+	for _, data := range []string{create, insert} {
+		block := node.Sp.Chain.NextBlock(data)
+		block.Version = storage.MerkleBlockVersion
+		assertEq(t, nil, node.Sp.AppendBlock(block))
+		assertEq(t, nil, node.AcceptBlock(block))
+	}
+
+	dir := t.TempDir()
+	service, err := network.NewSignerService(producer, filepath.Join(dir, "signer.state"))
+	assertEq(t, nil, err)
+	listener, err := network.ListenSigner(filepath.Join(dir, "signer.sock"))
+	assertEq(t, nil, err)
+	t.Cleanup(func() { listener.Close() })
+	go network.ServeSigner(listener, service)
+	signer, err := network.DialSigner(filepath.Join(dir, "signer.sock"))
+	assertEq(t, nil, err)
+	node.SetSigner(signer)
+	node.RegisterModule(ChainModule("test"))
+	assertEq(t, nil, node.SetupModules())
+	return node
+}
+
+// Check if legacy blocks are served unsigned by a node using a signer daemon and synchronized once a signed block follows them
+func TestSyncLegacyBlocks(t *testing.T) {
+	producer := newKey(t)
+	node := newLegacyChain(t, producer)
+	assertEq(t, true, len(node.Sp.Chain) > 2)
+	assertEq(t, nil, node.Sp.Chain[2].CheckSignature(producer.PublicKey()))
+
+	// the daemon only signs block headers, legacy blocks aren't signed on request then
+	propagation := BlockPropagationHandler{Storage: &node.Sp, Lock: node.Locker()}
+	var block SignedBlockData
+	assertEq(t, nil, propagation.GetBlock(0, &block))
+	assertEq(t, 0, len(block.Signature))
+	propagation.Signer = producer
+	assertEq(t, nil, propagation.GetBlock(0, &block))
+	assertEq(t, nil, producer.PublicKey().CheckSignature(block.BlockData.Hash(), block.Signature))
+
+	replica := newTestNode(t, producer.PublicKey())
+	assertEq(t, nil, replica.syncFrom(node, producer.PublicKey()))
+	assertEq(t, len(node.Sp.Chain), len(replica.Sp.Chain))
+	root, err := storage.ComputeStateRoot(&replica.Sp.StateDb)
+	assertEq(t, nil, err)
+	assertEq(t, true, bytes.Equal(root, node.Sp.Chain[len(node.Sp.Chain)-1].StateRoot))
+
+	// the signed block following the legacy blocks must be signed by the producer
+	other := newTestNode(t, producer.PublicKey())
+	assertErr(t, other.syncFrom(node, newKey(t).PublicKey()))
+	assertEq(t, 0, len(other.Sp.Chain))
+}
+
+// Check if unsigned legacy blocks without a signed block after them aren't synchronized
+func TestSyncUnsignedLegacyBlocks(t *testing.T) {
+	producer := newKey(t)
+	node := newTestNode(t, producer.PublicKey())
+	block := node.Sp.Chain.NextBlock("legacy")
+	block.Version = storage.MerkleBlockVersion
+	assertEq(t, nil, node.Sp.AppendBlock(block))
+
+	replica := newTestNode(t, producer.PublicKey())
+	assertErr(t, replica.syncFrom(node, producer.PublicKey()))
+	assertEq(t, 0, len(replica.Sp.Chain))
+}
@@ -3,53 +3,199 @@ package handlers
 import (
 	"AdminBlockchain/storage"
 	"AdminBlockchain/utils"
+	"bytes"
 	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
 )
 
-// BlockSyncHandler handles fetching blocks
+// BlockSyncHandler handles fetching blocks. Blocks are verified against the validator set of the state at their height,
+// blocks produced before the chain had a validator set with SignValidator.
 type BlockSyncHandler struct {
 	StorageProvider *storage.Provider
 	QueryHandlers   []IHandler
 	SignValidator   utils.SignatureValidator
+	Lock            sync.Locker // held while a block is added, needed if the node produces blocks as well
 }
 
-// Sync loads new blocks from a blockProvider
+// ErrForkRejected the chain of the peer forked from the local chain, the local branch is kept
+var ErrForkRejected = errors.New("the peer is on a fork of the chain, keeping the local blocks")
+
+// Sync loads new blocks from a blockProvider. If the chain of the provider forked from the local chain
+// the branch preferred by every node is kept, see preferBlock.
 func (sync *BlockSyncHandler) Sync(blockProvider IBlockProvider) error {
 	if sync.StorageProvider == nil {
 		return errors.New("handler not initialized")
 	}
 
-	localHeight := len(sync.StorageProvider.Chain)
 	externalHeight := blockProvider.GetBlockHeight()
-	var err error
-	for ; localHeight != externalHeight && err == nil; localHeight++ {
-		block := blockProvider.GetBlock(localHeight)
-		err = sync.SignValidator.CheckSignature(block.BlockData.Hash(), block.Signature)
-		if err == nil {
-			err = sync.pushBlock(block.BlockData)
+	localHeight, err := sync.resolveFork(blockProvider, externalHeight)
+	for localHeight < externalHeight && err == nil {
+		signed := blockProvider.GetBlock(localHeight)
+		if signed.BlockData.Version < storage.SignedBlockVersion && len(signed.Signature) == 0 {
+			var pushed int
+			pushed, err = sync.pushLegacyBlocks(blockProvider, localHeight, externalHeight)
+			localHeight += pushed
+			continue
 		}
+		err = sync.pushBlock(signed, true)
+		localHeight++
 	}
 	return err
 }
 
+// pushLegacyBlocks adds the unsigned legacy blocks served by a provider without the key they are signed with on request.
+// They are only accepted once the hashes link them to the first signed block after them, which is verified first.
+// Returns the number of blocks added.
+func (sync *BlockSyncHandler) pushLegacyBlocks(blockProvider IBlockProvider, height int, externalHeight int) (int, error) {
+	var blocks []SignedBlockData
+	for ; ; height++ {
+		if height >= externalHeight {
+			return 0, errors.New("unsigned legacy blocks are not followed by a signed block")
+		}
+		signed := blockProvider.GetBlock(height)
+		blocks = append(blocks, signed)
+		if signed.BlockData.Version >= storage.SignedBlockVersion {
+			break
+		}
+	}
+	for i := 1; i < len(blocks); i++ {
+		if !bytes.Equal(blocks[i].BlockData.PrevHash, blocks[i-1].BlockData.Hash()) {
+			return 0, fmt.Errorf("block %d doesn't follow the previous block", blocks[i].BlockData.ID)
+		}
+	}
+	// legacy chains have no validator set when they are first signed
+	anchor := blocks[len(blocks)-1]
+	if sync.SignValidator != nil {
+		err := anchor.BlockData.CheckSignature(sync.SignValidator)
+		if err != nil {
+			return 0, fmt.Errorf("block %d: %v", anchor.BlockData.ID, err)
+		}
+	}
+
+	for i, signed := range blocks[:len(blocks)-1] {
+		err := sync.pushBlock(signed, false)
+		if err != nil {
+			return i, err
+		}
+	}
+	err := sync.pushBlock(anchor, true)
+	if err != nil {
+		return len(blocks) - 1, err
+	}
+	return len(blocks), nil
+}
+
+// resolveFork finds the height the local chain and the chain of the provider diverge at. The local blocks starting
+// at that height are removed if the first block of the provider branch is valid and preferred over the local one.
+// The chain is changed under the lock the chain is served under, returns the local height afterwards.
+func (sync *BlockSyncHandler) resolveFork(blockProvider IBlockProvider, externalHeight int) (int, error) {
+	if sync.Lock != nil {
+		sync.Lock.Lock()
+		defer sync.Lock.Unlock()
+	}
+
+	sp := sync.StorageProvider
+	fork := len(sp.Chain)
+	if externalHeight < fork {
+		fork = externalHeight
+	}
+	for fork > 0 && !bytes.Equal(blockProvider.GetBlock(fork-1).BlockData.Hash(), sp.Chain[fork-1].Hash()) {
+		fork--
+	}
+	if fork == len(sp.Chain) || fork == externalHeight {
+		// one chain continues the other
+		return len(sp.Chain), nil
+	}
+	if fork == 0 {
+		return len(sp.Chain), errors.New("the peer is on another chain")
+	}
+
+	signed := blockProvider.GetBlock(fork)
+	_, err := sync.verifyBlock(sp.Chain[:fork], signed, true)
+	if err != nil {
+		return len(sp.Chain), fmt.Errorf("fork at block %d: %v", fork, err)
+	}
+	preferred, err := preferBlock(&sp.StateDb, signed.BlockData, sp.Chain[fork])
+	if err != nil {
+		return len(sp.Chain), err
+	}
+	if !preferred {
+		return len(sp.Chain), ErrForkRejected
+	}
+
+	log.Printf("Replacing %d blocks starting at height %d with the branch of the peer", len(sp.Chain)-fork, fork)
+	err = sp.RemoveBlocks(fork)
+	if err != nil {
+		return len(sp.Chain), err
+	}
+	for _, handler := range sync.QueryHandlers {
+		if handler == nil {
+			continue
+		}
+		err = handler.Recover()
+		if err != nil {
+			return len(sp.Chain), err
+		}
+	}
+	return len(sp.Chain), nil
+}
+
+// verifyBlock checks that the block can be appended to the chain and returns the key it is signed with.
+// The signature of the provider is only skipped for legacy blocks linked to a verified signed block.
+func (sync *BlockSyncHandler) verifyBlock(chain storage.Blockchain, signed SignedBlockData, checkSignature bool) (utils.SignatureValidator, error) {
+	block := signed.BlockData
+	validator, err := blockValidator(&sync.StorageProvider.StateDb, chain, block, sync.SignValidator, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if validator != nil && checkSignature {
+		err = validator.CheckSignature(block.Hash(), signed.Signature)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !chain.IsValidNext(block, validator) {
+		return nil, errors.New("invalid block")
+	}
+	return validator, nil
+}
+
 // pushBlock validates and adds block to the blockchain
-func (sync *BlockSyncHandler) pushBlock(block storage.Block) error {
+func (sync *BlockSyncHandler) pushBlock(signed SignedBlockData, checkSignature bool) error {
 	if sync.StorageProvider == nil {
 		return errors.New("handler not initialized")
 	}
+	if sync.Lock != nil {
+		sync.Lock.Lock()
+		defer sync.Lock.Unlock()
+	}
 
+	block := signed.BlockData
 	if block.ID != len(sync.StorageProvider.Chain) {
 		return errors.New("invalid block id, push only at block height")
 	}
+	_, err := sync.verifyBlock(sync.StorageProvider.Chain, signed, checkSignature)
+	if err != nil {
+		return err
+	}
 
-	validationChain := append(sync.StorageProvider.Chain, block)
-	if validationChain.IsValid() {
-		sync.StorageProvider.Chain = validationChain
-		for _, handler := range sync.QueryHandlers {
-			if handler != nil {
-				handler.AcceptBlock(block)
-			}
+	err = sync.StorageProvider.AppendBlock(block)
+	if err != nil {
+		return err
+	}
+	for _, handler := range sync.QueryHandlers {
+		if handler == nil {
+			continue
+		}
+		err = handler.AcceptBlock(block)
+		if err != nil {
+			utils.LogError(sync.StorageProvider.RemoveLastBlock())
+			return err
 		}
 	}
+	sync.StorageProvider.SnapshotIfDue()
 	return nil
 }
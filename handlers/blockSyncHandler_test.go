@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"AdminBlockchain/utils"
+	"bytes"
+	"testing"
+)
+
+// forkedNodes creates two nodes the producer signed a different block at the same height on. The node
+// with the preferred block is returned first, followed by the accounts created in the forked blocks.
+// The producer key is the admin of the chain as well.
+func forkedNodes(t *testing.T) (*testNode, *testNode, utils.SignatureCreator, Address, Address) {
+	producer := newKey(t)
+	node := newTestChain(t, producer, producer.PublicKey())
+	replica := newTestNode(t, producer.PublicKey())
+	inTurn, err := replica.InTurn()
+	assertEq(t, nil, err)
+	assertEq(t, true, inTurn)
+	assertEq(t, nil, replica.syncFrom(node, producer.PublicKey()))
+	replica.SetSigner(producer)
+
+	nodeAddress := node.createAccount(t, producer, newKey(t).PublicKey(), BasicAccountAccess)
+	replicaAddress := replica.createAccount(t, producer, newKey(t).PublicKey(), BasicAccountAccess)
+	height := len(node.Sp.Chain)
+	if bytes.Compare(node.Sp.Chain[height-1].Hash(), replica.Sp.Chain[height-1].Hash()) < 0 {
+		return node, replica, producer, nodeAddress, replicaAddress
+	}
+	return replica, node, producer, replicaAddress, nodeAddress
+}
+
+// Check if two nodes producing different blocks at the same height agree on one branch
+func TestSyncFork(t *testing.T) {
+	winner, loser, producer, kept, removed := forkedNodes(t)
+	height := len(winner.Sp.Chain)
+
+	assertEq(t, ErrForkRejected, winner.syncFrom(loser, producer.PublicKey()))
+	assertEq(t, nil, loser.syncFrom(winner, producer.PublicKey()))
+	assertEq(t, height, len(loser.Sp.Chain))
+	assertEq(t, true, bytes.Equal(winner.Sp.Chain[height-1].Hash(), loser.Sp.Chain[height-1].Hash()))
+	assertEq(t, nil, winner.syncFrom(loser, producer.PublicKey()))
+
+	// the state of the removed block is gone
+	exists, err := accountExists(&loser.Sp.StateDb, kept)
+	assertEq(t, nil, err)
+	assertEq(t, true, exists)
+	exists, err = accountExists(&loser.Sp.StateDb, removed)
+	assertEq(t, nil, err)
+	assertEq(t, false, exists)
+
+	// both nodes keep producing on the same branch
+	loser.createAccount(t, producer, newKey(t).PublicKey(), BasicAccountAccess)
+	assertEq(t, nil, winner.syncFrom(loser, producer.PublicKey()))
+	assertEq(t, height+1, len(winner.Sp.Chain))
+}
+
+// Check if the blocks of a node are served while a fork removes them, run with -race
+func TestSyncForkConcurrentReads(t *testing.T) {
+	winner, loser, producer, _, _ := forkedNodes(t)
+	propagation := BlockPropagationHandler{Storage: &loser.Sp, Lock: loser.Locker()}
+
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			var height int
+			propagation.GetBlockHeight(nil, &height)
+			var block SignedBlockData
+			// the block may be removed in between
+			propagation.GetBlock(height-1, &block)
+		}
+	}()
+	assertEq(t, nil, loser.syncFrom(winner, producer.PublicKey()))
+	<-done
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+)
+
+// ChainModule declares the id of the chain, which is part of every signed client request so a signature
+// is only valid on a single chain. A random id is created with the chain if none is given.
+func ChainModule(chainID string) Module {
+	return Module{
+		Name:    "chain",
+		Version: 1,
+		Schema:  []string{"create table ChainInfo (id text)"},
+		Genesis: func(scope *TransactionScope) error {
+			id := chainID
+			if id == "" {
+				data := make([]byte, 16)
+				_, err := rand.Read(data)
+				if err != nil {
+					return err
+				}
+				id = hex.EncodeToString(data)
+			}
+			_, err := scope.ExecuteTransaction("insert into ChainInfo (id) values (?)", id)
+			return err
+		},
+	}
+}
+
+// ChainID returns the id of the chain, clients sign their requests with it
+func (handler *BaseQueryHandler) ChainID() (string, error) {
+	return queryChainID(&handler.Sp.StateDb)
+}
+
+func queryChainID(db queryer) (string, error) {
+	found, err := hasTable(db, "ChainInfo")
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", errors.New("the chain has no id")
+	}
+	rows, err := db.Query("select id from ChainInfo")
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	var id string
+	if !rows.Next() {
+		return "", errors.New("the chain has no id")
+	}
+	err = rows.Scan(&id)
+	return id, err
+}
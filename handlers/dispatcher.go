@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"AdminBlockchain/storage"
+	"fmt"
+)
+
+// OperationFunc applies a signed client request to the state. It is run when the request is submitted
+// and again by every node replaying the block, so it may only depend on the request and the state.
+type OperationFunc func(scope *TransactionScope, request storage.Request) error
+
+// BlockFunc applies the changes every block makes to the state after its requests, e.g. closing what expired at its height.
+// It is run when the block is produced and again by every node replaying it, so it may only depend on the state and the height.
+type BlockFunc func(scope *TransactionScope) error
+
+// dispatcher routes client requests to the function applying their operation
+type dispatcher struct {
+	operations map[string]OperationFunc
+	blockFuncs []BlockFunc
+}
+
+// register sets the function applying the operation
+func (d *dispatcher) register(operation string, apply OperationFunc) {
+	if d.operations == nil {
+		d.operations = make(map[string]OperationFunc)
+	}
+	d.operations[operation] = apply
+}
+
+// apply runs the function registered for the operation of the request
+func (d *dispatcher) apply(scope *TransactionScope, request storage.Request) error {
+	apply, found := d.operations[request.Operation]
+	if !found {
+		return fmt.Errorf("unknown operation %q", request.Operation)
+	}
+	return apply(scope, request)
+}
+
+// finishBlock runs the block functions in their registration order, their statements are not stored in the block
+func (d *dispatcher) finishBlock(scope *TransactionScope) error {
+	applying := scope.applying
+	scope.applying = true
+	defer func() { scope.applying = applying }()
+	for _, apply := range d.blockFuncs {
+		err := apply(scope)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RegisterOperation registers the function applying an operation of submitted and replayed client requests
+func (handler *BaseQueryHandler) RegisterOperation(operation string, apply OperationFunc) {
+	handler.operations.register(operation, apply)
+}
+
+// RegisterBlockFunc registers a function run at the end of every produced and replayed block
+func (handler *BaseQueryHandler) RegisterBlockFunc(apply BlockFunc) {
+	handler.operations.blockFuncs = append(handler.operations.blockFuncs, apply)
+}
+
+// requestParams reads the typed parameters of a request. The first error is kept, so all
+// parameters can be read before it is checked.
+type requestParams struct {
+	values []interface{}
+	err    error
+}
+
+// readParams checks that the request has the expected amount of parameters
+func readParams(request storage.Request, count int) *requestParams {
+	params := &requestParams{values: request.Params}
+	if len(request.Params) != count {
+		params.err = fmt.Errorf("operation %s expects %d parameters, got %d", request.Operation, count, len(request.Params))
+	}
+	return params
+}
+
+func (params *requestParams) value(index int) interface{} {
+	if params.err != nil || index >= len(params.values) {
+		return nil
+	}
+	return params.values[index]
+}
+
+func (params *requestParams) fail(index int, expected string) {
+	if params.err == nil {
+		params.err = fmt.Errorf("parameter %d must be %s", index, expected)
+	}
+}
+
+func (params *requestParams) text(index int) string {
+	value, ok := params.value(index).(string)
+	if !ok {
+		params.fail(index, "a string")
+	}
+	return value
+}
+
+func (params *requestParams) integer(index int) int64 {
+	value, ok := params.value(index).(int64)
+	if !ok {
+		params.fail(index, "an integer")
+	}
+	return value
+}
+
+func (params *requestParams) flag(index int) bool {
+	value, ok := params.value(index).(bool)
+	if !ok {
+		params.fail(index, "a boolean")
+	}
+	return value
+}
+
+func (params *requestParams) bytes(index int) []byte {
+	value, ok := params.value(index).([]byte)
+	if !ok {
+		params.fail(index, "binary data")
+	}
+	return value
+}
@@ -6,5 +6,8 @@ import (
 
 //IHandler interface for rpc handlers
 type IHandler interface {
-	AcceptBlock(storage.Block)
+	// AcceptBlock applies the block to the state, fails if the resulting state doesn't match the block state root
+	AcceptBlock(storage.Block) error
+	// Recover reconciles the state with the chain, called after blocks were removed from the chain
+	Recover() error
 }
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"AdminBlockchain/storage"
+	"AdminBlockchain/utils"
+	"testing"
+)
+
+func assertEq(t *testing.T, expected interface{}, actual interface{}) {
+	t.Helper()
+	if expected != actual {
+		t.Errorf("%v != %v", expected, actual)
+	}
+}
+
+func assertErr(t *testing.T, err error) {
+	t.Helper()
+	if err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func newKey(t *testing.T) utils.SignatureCreator {
+	t.Helper()
+	key, err := utils.GenerateKey(utils.KeyAlgorithmEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// testNode a node keeping its chain and state in memory, usable without cgo
+type testNode struct {
+	*BaseQueryHandler
+	accounts   *AccountHandler
+	contracts  *ContractHandler
+	roles      *RoleHandler
+	proposals  *ProposalHandler
+	validators *ValidatorHandler
+}
+
+// newTestNode creates a node verifying blocks produced before the chain had validators with the producer key
+func newTestNode(t *testing.T, producer utils.SignatureValidator) *testNode {
+	return loadTestNode(t, producer, storage.MemoryBackend{}, "")
+}
+
+// loadTestNode creates a node loading the chain kept by the backend at the path
+func loadTestNode(t *testing.T, producer utils.SignatureValidator, backend storage.Backend, path string) *testNode {
+	base := NewBaseHandlerWithBackend(producer, backend)
+	node := &testNode{BaseQueryHandler: base}
+	node.accounts = NewAccountHandler(base)
+	node.contracts = NewContractHandler(base, node.accounts)
+	node.roles = NewRoleHandler(base, node.accounts)
+	node.proposals = NewProposalHandler(base, node.accounts)
+	node.validators = NewValidatorHandler(base, node.accounts)
+	base.Load(path)
+	t.Cleanup(base.Close)
+	return node
+}
+
+// newTestChain creates a node producing a new chain signed by the producer, admin is the key of the first admin account
+func newTestChain(t *testing.T, producer utils.SignatureCreator, admin utils.SignatureValidator) *testNode {
+	return setupTestChain(t, newTestNode(t, producer.PublicKey()), producer, admin)
+}
+
+// setupTestChain creates the modules of a new chain on the node, see newTestChain
+func setupTestChain(t *testing.T, node *testNode, producer utils.SignatureCreator, admin utils.SignatureValidator) *testNode {
+	node.SetSigner(producer)
+	node.RegisterModule(ChainModule("test"))
+	node.RegisterModule(node.accounts.Module(admin))
+	node.RegisterModule(node.contracts.Module())
+	node.RegisterModule(node.roles.Module())
+	node.RegisterModule(node.proposals.Module())
+	node.RegisterModule(node.validators.Module(producer.PublicKey()))
+	err := node.SetupModules()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return node
+}
+
+// sign signs the request payload of the operation on the chain of the node
+func (node *testNode) sign(t *testing.T, key utils.SignatureCreator, method string, operation string, nonce uint64, params ...interface{}) []byte {
+	t.Helper()
+	chainID, err := node.ChainID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := SignedPayload(chainID, method, operation, nonce, params...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := key.Sign(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signature
+}
+
+// nonce returns the next nonce of the account
+func (node *testNode) nonce(t *testing.T, address Address) uint64 {
+	t.Helper()
+	var nonce uint64
+	err := node.accounts.NextNonce(address, &nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return nonce
+}
+
+// createAccount creates an account for the key, signed by the sender
+func (node *testNode) createAccount(t *testing.T, sender utils.SignatureCreator, key utils.SignatureValidator, accessLevel int) Address {
+	t.Helper()
+	pubKey, err := key.Store()
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := GetAddressFromPubKey(sender.PublicKey())
+	nonce := node.nonce(t, from)
+	var txID string
+	err = node.accounts.CreateAccount(CreateAccountParams{
+		From:         from,
+		PersonalInfo: "test",
+		AccessLevel:  accessLevel,
+		PubKey:       pubKey,
+		Nonce:        nonce,
+		Signature: node.sign(t, sender, "AccountHandler.CreateAccount", OperationCreateAccount, nonce,
+			"test", accessLevel, pubKey)}, &txID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return GetAddressFromPubKey(key)
+}
+
+// localBlockProvider serves the blocks of another node without rpc
+type localBlockProvider struct {
+	handler *BlockPropagationHandler
+}
+
+func (provider localBlockProvider) GetBlockHeight() int {
+	var height int
+	provider.handler.GetBlockHeight(nil, &height)
+	return height
+}
+
+func (provider localBlockProvider) GetBlock(index int) SignedBlockData {
+	var block SignedBlockData
+	provider.handler.GetBlock(index, &block)
+	return block
+}
+
+// syncFrom appends the blocks of the source node the node is missing
+func (node *testNode) syncFrom(source *testNode, validator utils.SignatureValidator) error {
+	sync := BlockSyncHandler{
+		StorageProvider: &node.Sp,
+		QueryHandlers:   []IHandler{node.BaseQueryHandler},
+		SignValidator:   validator,
+		Lock:            node.Locker(),
+	}
+	return sync.Sync(localBlockProvider{&BlockPropagationHandler{Storage: &source.Sp, Lock: source.Locker()}})
+}
+
+// Check if a chain is created in memory with the state of every module
+func TestMemoryChain(t *testing.T) {
+	producer, admin := newKey(t), newKey(t)
+	node := newTestChain(t, producer, admin.PublicKey())
+
+	assertEq(t, 1, len(node.Sp.Chain))
+	assertEq(t, false, node.Sp.Backend.Persistent())
+	chainID, err := node.ChainID()
+	assertEq(t, nil, err)
+	assertEq(t, "test", chainID)
+	version, err := moduleVersion(&node.Sp.StateDb, "validators")
+	assertEq(t, nil, err)
+	assertEq(t, 1, version)
+
+	user := newKey(t)
+	address := node.createAccount(t, admin, user.PublicKey(), BasicAccountAccess)
+	found, err := node.accounts.FindAddress(user.PublicKey())
+	assertEq(t, nil, err)
+	assertEq(t, address, found)
+	assertEq(t, 2, len(node.Sp.Chain))
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Migration upgrades the state of a module by a single version
+type Migration func(scope *TransactionScope) error
+
+// Module declares the part of the state owned by a handler. The registry creates and upgrades it
+// with statements stored on the chain, so every node replaying the chain gets the same state.
+type Module struct {
+	Name       string
+	Version    int                                 // version of the schema, starting at 1
+	Schema     []string                            // statements creating the current version of the schema
+	Genesis    func(scope *TransactionScope) error // fills the initial state once the schema is created, optional
+	Migrations []Migration                         // Migrations[i] upgrades the state from version i+1 to i+2
+	Legacy     bool                                // the module existed before the registry
+}
+
+// RegisterModule adds a module to the registry, its state is set up by SetupModules
+func (handler *BaseQueryHandler) RegisterModule(module Module) {
+	handler.modules = append(handler.modules, module)
+}
+
+// SetupModules creates the state of modules new to the chain and migrates modules stored with an older version.
+// All changes are stored in a single block, no block is produced if the state is up to date.
+// Chains created before the registry are assumed to hold version 1 of every legacy module.
+func (handler *BaseQueryHandler) SetupModules() error {
+	scope, err := handler.Begin()
+	if err != nil {
+		return err
+	}
+	defer scope.Rollback()
+
+	installed, found, err := installedModules(scope)
+	if err != nil {
+		return err
+	}
+	if !found {
+		_, err = scope.ExecuteTransaction("create table Modules (name text, version int)")
+		if err != nil {
+			return err
+		}
+		if len(handler.Sp.Chain) > 0 {
+			for _, module := range handler.modules {
+				if !module.Legacy {
+					continue
+				}
+				err = setModuleVersion(scope, module.Name, 1, false)
+				if err != nil {
+					return err
+				}
+				installed[module.Name] = 1
+			}
+		}
+	}
+
+	names := make(map[string]bool)
+	for _, module := range handler.modules {
+		if names[module.Name] {
+			return fmt.Errorf("module %s registered twice", module.Name)
+		}
+		names[module.Name] = true
+
+		version, found := installed[module.Name]
+		if found {
+			err = migrateModule(scope, module, version)
+		} else {
+			err = installModule(scope, module)
+		}
+		if err != nil {
+			return fmt.Errorf("module %s: %v", module.Name, err)
+		}
+	}
+	return scope.Commit()
+}
+
+// installModule creates the current version of the module state
+func installModule(scope *TransactionScope, module Module) error {
+	if module.Version != len(module.Migrations)+1 {
+		return errors.New("module version doesn't match its migrations")
+	}
+	for _, statement := range module.Schema {
+		_, err := scope.ExecuteTransaction(statement)
+		if err != nil {
+			return err
+		}
+	}
+	if module.Genesis != nil {
+		err := module.Genesis(scope)
+		if err != nil {
+			return err
+		}
+	}
+	return setModuleVersion(scope, module.Name, module.Version, false)
+}
+
+// migrateModule runs the migrations from the stored version up to the current version of the module
+func migrateModule(scope *TransactionScope, module Module, version int) error {
+	if module.Version != len(module.Migrations)+1 {
+		return errors.New("module version doesn't match its migrations")
+	}
+	if version > module.Version {
+		return fmt.Errorf("state version %d is newer than the supported version %d", version, module.Version)
+	}
+	if version == module.Version {
+		return nil
+	}
+	for _, migrate := range module.Migrations[version-1:] {
+		err := migrate(scope)
+		if err != nil {
+			return err
+		}
+	}
+	return setModuleVersion(scope, module.Name, module.Version, true)
+}
+
+func setModuleVersion(scope *TransactionScope, name string, version int, update bool) error {
+	var err error
+	if update {
+		_, err = scope.ExecuteTransaction("update Modules set version=? where name=?", version, name)
+	} else {
+		_, err = scope.ExecuteTransaction("insert into Modules (name, version) values (?, ?)", name, version)
+	}
+	return err
+}
+
+// installedModules returns the stored versions of the modules, found is false if the chain predates the registry
+func installedModules(db queryer) (map[string]int, bool, error) {
+	installed := make(map[string]int)
+	found, err := hasTable(db, "Modules")
+	if err != nil || !found {
+		return installed, false, err
+	}
+
+	rows, err := db.Query("select name, version from Modules")
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	var name string
+	var version int
+	for rows.Next() {
+		err = rows.Scan(&name, &version)
+		if err != nil {
+			return nil, false, err
+		}
+		installed[name] = version
+	}
+	return installed, true, rows.Err()
+}
+
+// moduleVersion returns the version of the module stored in the state, 0 if it isn't installed
+func moduleVersion(db queryer, name string) (int, error) {
+	installed, _, err := installedModules(db)
+	if err != nil {
+		return 0, err
+	}
+	return installed[name], nil
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"testing"
+)
+
+// newModuleNode creates a node producing its own blocks without any registered module
+func newModuleNode(t *testing.T) *testNode {
+	producer := newKey(t)
+	node := newTestNode(t, producer.PublicKey())
+	node.SetSigner(producer)
+	return node
+}
+
+func notesModule(migrations ...Migration) Module {
+	return Module{
+		Name:       "notes",
+		Version:    len(migrations) + 1,
+		Schema:     []string{"create table Notes (text text)"},
+		Migrations: migrations,
+		Genesis: func(scope *TransactionScope) error {
+			_, err := scope.ExecuteTransaction("insert into Notes values ('genesis')")
+			return err
+		},
+	}
+}
+
+// Check if a new module is installed once and no block is produced while the state is up to date
+func TestModuleInstall(t *testing.T) {
+	node := newModuleNode(t)
+	node.RegisterModule(notesModule())
+	assertEq(t, nil, node.SetupModules())
+	assertEq(t, 1, len(node.Sp.Chain))
+	version, err := moduleVersion(&node.Sp.StateDb, "notes")
+	assertEq(t, nil, err)
+	assertEq(t, 1, version)
+
+	assertEq(t, nil, node.SetupModules())
+	assertEq(t, 1, len(node.Sp.Chain))
+	_, rows, err := node.ExecuteQuery("select text from Notes")
+	assertEq(t, nil, err)
+	assertEq(t, 1, len(rows))
+}
+
+// Check if a module stored with an older version is migrated in a block replayed by other nodes
+func TestModuleMigrate(t *testing.T) {
+	node := newModuleNode(t)
+	node.RegisterModule(notesModule())
+	assertEq(t, nil, node.SetupModules())
+
+	node.modules = nil
+	node.RegisterModule(notesModule(func(scope *TransactionScope) error {
+		_, err := scope.ExecuteTransaction("alter table Notes add column author text default ''")
+		return err
+	}))
+	assertEq(t, nil, node.SetupModules())
+	assertEq(t, 2, len(node.Sp.Chain))
+	version, err := moduleVersion(&node.Sp.StateDb, "notes")
+	assertEq(t, nil, err)
+	assertEq(t, 2, version)
+	found, err := hasColumn(&node.Sp.StateDb, "Notes", "author")
+	assertEq(t, nil, err)
+	assertEq(t, true, found)
+
+	replica := newTestNode(t, nil)
+	assertEq(t, nil, replica.syncFrom(node, nil))
+	found, err = hasColumn(&replica.Sp.StateDb, "Notes", "author")
+	assertEq(t, nil, err)
+	assertEq(t, true, found)
+}
+
+// Check if invalid registrations fail without producing a block
+func TestModuleInvalid(t *testing.T) {
+	node := newModuleNode(t)
+	node.RegisterModule(notesModule())
+	node.RegisterModule(notesModule())
+	assertErr(t, node.SetupModules())
+	assertEq(t, 0, len(node.Sp.Chain))
+
+	node.modules = nil
+	module := notesModule()
+	module.Version = 2
+	node.RegisterModule(module)
+	assertErr(t, node.SetupModules())
+	assertEq(t, 0, len(node.Sp.Chain))
+
+	// a state written by a newer version of the node isn't downgraded
+	node.modules = nil
+	node.RegisterModule(notesModule(func(scope *TransactionScope) error { return nil }))
+	assertEq(t, nil, node.SetupModules())
+	node.modules = nil
+	node.RegisterModule(notesModule())
+	assertErr(t, node.SetupModules())
+	assertEq(t, 1, len(node.Sp.Chain))
+}
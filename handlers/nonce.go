@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"AdminBlockchain/storage"
+	"AdminBlockchain/utils"
+	"errors"
+)
+
+// Operation tags, part of every signed payload so a signature is only valid for a single kind of operation
+const (
+	OperationCreateAccount    = "account.create"
+	OperationUpdateAccount    = "account.update"
+	OperationRotateKey        = "account.rotate"
+	OperationDisableAccount   = "account.disable"
+	OperationEnableAccount    = "account.enable"
+	OperationCreateContract   = "contract.create"
+	OperationUpdateContract   = "contract.update"
+	OperationSignContract     = "contract.sign"
+	OperationStartContract    = "contract.start"
+	OperationResolveContract  = "contract.resolve"
+	OperationAcceptContract   = "contract.accept"
+	OperationGrantPermission  = "role.grant"
+	OperationRevokePermission = "role.revoke"
+	OperationAssignRole       = "role.assign"
+	OperationUnassignRole     = "role.unassign"
+	OperationPropose          = "proposal.create"
+	OperationApprove          = "proposal.approve"
+	OperationSetThreshold     = "proposal.threshold"
+	OperationAddValidator     = "validator.add"
+	OperationRemoveValidator  = "validator.remove"
+)
+
+// SignedPayload returns the message a client signs to authorize an operation through the rpc method.
+// The nonce must be the next nonce of the signing account, the chain id is returned by ChainID.
+func SignedPayload(chainID string, method string, operation string, nonce uint64, params ...interface{}) ([]byte, error) {
+	return storage.SigningPayload(chainID, method, append([]interface{}{operation, nonce}, params...)...)
+}
+
+// legacySignedPayload returns the hash signed by requests stored in blocks older than DomainSignatureBlockVersion
+func legacySignedPayload(operation string, nonce uint64, params ...interface{}) []byte {
+	return utils.HashFields(append([]interface{}{operation, nonce}, params...)...)
+}
+
+// requestPayload returns the message the signature of the request covers in a block of the version
+func requestPayload(db queryer, version int, request storage.Request) ([]byte, error) {
+	if version < storage.DomainSignatureBlockVersion {
+		return legacySignedPayload(request.Operation, request.Nonce, request.Params...), nil
+	}
+	chainID, err := queryChainID(db)
+	if err != nil {
+		return nil, err
+	}
+	return SignedPayload(chainID, request.Method, request.Operation, request.Nonce, request.Params...)
+}
+
+// useNonce checks that the nonce is the next nonce of the account and stores it, so the same signed payload can't be applied twice
+func useNonce(scope *TransactionScope, acc Account, nonce uint64) error {
+	if nonce <= acc.Nonce {
+		return errors.New("nonce already used")
+	}
+	if nonce != acc.Nonce+1 {
+		return errors.New("nonce out of order")
+	}
+	_, err := scope.ExecuteTransaction("update Accounts set nonce=? where address=?", nonce, acc.Address)
+	return err
+}
+
+// authorize checks that the request is signed by the account, the account is permitted the operation and consumes the nonce.
+// Operations requiring several approvals are only authorized through a proposal.
+func authorize(scope *TransactionScope, acc Account, request storage.Request) error {
+	if Address(request.Signer) != acc.Address {
+		return errors.New("request is not signed by the authorized account")
+	}
+	if acc.Disabled {
+		return errors.New("account is disabled")
+	}
+	if scope.approved {
+		// the admins approving the proposal authorized the request
+		return checkPermission(scope, acc, request.Operation)
+	}
+	payload, err := requestPayload(scope, scope.version, request)
+	if err != nil {
+		return err
+	}
+	err = acc.PubKey.CheckSignature(payload, request.Signature)
+	if err != nil {
+		return errors.New("invalid user signature")
+	}
+	err = checkPermission(scope, acc, request.Operation)
+	if err != nil {
+		return err
+	}
+	err = checkThreshold(scope, request.Operation)
+	if err != nil {
+		return err
+	}
+	return useNonce(scope, acc, request.Nonce)
+}
+
+// verifyRequest checks a signed request stored in a block against the state it is applied to.
+// Used for blocks older than OperationBlockVersion, which store the statements of the request as well.
+func verifyRequest(db queryer, request storage.Request) error {
+	acc, err := queryAccount(db, Address(request.Signer))
+	if err != nil {
+		return err
+	}
+	if request.Nonce != acc.Nonce+1 {
+		return errors.New("nonce doesn't match the signer account")
+	}
+	err = acc.PubKey.CheckSignature(
+		legacySignedPayload(request.Operation, request.Nonce, request.Params...),
+		request.Signature)
+	if err != nil {
+		return errors.New("invalid user signature")
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"AdminBlockchain/utils"
+	"testing"
+)
+
+// createAccountParams builds a signed request of the sender creating an account for the key
+func createAccountParams(t *testing.T, node *testNode, sender utils.SignatureCreator, key utils.SignatureValidator, nonce uint64) CreateAccountParams {
+	t.Helper()
+	pubKey, err := key.Store()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return CreateAccountParams{
+		From:         GetAddressFromPubKey(sender.PublicKey()),
+		PersonalInfo: "test",
+		AccessLevel:  BasicAccountAccess,
+		PubKey:       pubKey,
+		Nonce:        nonce,
+		Signature: node.sign(t, sender, "AccountHandler.CreateAccount", OperationCreateAccount, nonce,
+			"test", BasicAccountAccess, pubKey)}
+}
+
+// Check if a signed request can't be applied twice
+func TestNonceReplay(t *testing.T) {
+	producer, admin := newKey(t), newKey(t)
+	node := newTestChain(t, producer, admin.PublicKey())
+	adminAddress := GetAddressFromPubKey(admin.PublicKey())
+	nonce := node.nonce(t, adminAddress)
+
+	user := newKey(t).PublicKey()
+	params := createAccountParams(t, node, admin, user, nonce)
+	var txID string
+	assertEq(t, nil, node.accounts.CreateAccount(params, &txID))
+	assertEq(t, nonce+1, node.nonce(t, adminAddress))
+
+	// the account was removed in the meantime, so only the nonce prevents the replay
+	_, err := node.Sp.StateDb.Transact("delete from Accounts where address=?", GetAddressFromPubKey(user))
+	assertEq(t, nil, err)
+	err = node.accounts.CreateAccount(params, &txID)
+	assertErr(t, err)
+	if err != nil {
+		assertEq(t, "nonce already used", err.Error())
+	}
+	assertEq(t, 2, len(node.Sp.Chain))
+}
+
+// Check if nonces are used in order
+func TestNonceOrder(t *testing.T) {
+	producer, admin := newKey(t), newKey(t)
+	node := newTestChain(t, producer, admin.PublicKey())
+	adminAddress := GetAddressFromPubKey(admin.PublicKey())
+	nonce := node.nonce(t, adminAddress)
+
+	var txID string
+	err := node.accounts.CreateAccount(createAccountParams(t, node, admin, newKey(t).PublicKey(), nonce+1), &txID)
+	assertErr(t, err)
+	if err != nil {
+		assertEq(t, "nonce out of order", err.Error())
+	}
+	assertEq(t, nonce, node.nonce(t, adminAddress))
+
+	for i := uint64(0); i < 2; i++ {
+		assertEq(t, nil, node.accounts.CreateAccount(createAccountParams(t, node, admin, newKey(t).PublicKey(), nonce+i), &txID))
+	}
+	assertEq(t, nonce+2, node.nonce(t, adminAddress))
+}
+
+// Check if a signature only authorizes the operation it was made for
+func TestNonceOperationTag(t *testing.T) {
+	producer, admin := newKey(t), newKey(t)
+	node := newTestChain(t, producer, admin.PublicKey())
+	adminAddress := GetAddressFromPubKey(admin.PublicKey())
+	nonce := node.nonce(t, adminAddress)
+
+	params := createAccountParams(t, node, admin, newKey(t).PublicKey(), nonce)
+	params.Signature = node.sign(t, admin, "AccountHandler.CreateAccount", OperationUpdateAccount, nonce,
+		"test", BasicAccountAccess, params.PubKey)
+	var txID string
+	assertErr(t, node.accounts.CreateAccount(params, &txID))
+	assertEq(t, nonce, node.nonce(t, adminAddress))
+}
@@ -2,10 +2,8 @@ package sample
 
 import (
 	"AdminBlockchain/storage"
-	"fmt"
 	"log"
 	"os"
-	"strings"
 )
 
 // SimpleQueryHandler a pass-through for acessing the database. Provides simple logic for storing each executed transaction on the blockchain.
@@ -39,24 +37,41 @@ func (handler *SimpleQueryHandler) Load(path string) {
 	handler.Close()
 	handler.Sp.LoadChain(path)
 
+	err := handler.Recover()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Recover rebuilds the state from the chain
+func (handler *SimpleQueryHandler) Recover() error {
+	handler.Sp.StateDb.Close()
 	os.Remove(stateDbPath)
 	handler.Sp.StateDb.OpenDb(stateDbPath)
 
 	for _, block := range handler.Sp.Chain {
-		handler.AcceptBlock(block)
+		err := handler.AcceptBlock(block)
+		if err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
 // AcceptBlock at the top of chain
-func (handler *SimpleQueryHandler) AcceptBlock(block storage.Block) {
-	params := strings.Split(block.Data, ";")
-	if len(params) > 0 {
-		args := make([]interface{}, len(params[1:]))
-		for i := range params[1:] {
-			args[i] = params[i]
+func (handler *SimpleQueryHandler) AcceptBlock(block storage.Block) error {
+	for _, data := range block.Transactions {
+		if storage.IsRequest(data) {
+			// client requests are replayed by the operations of the base handler, this handler only applies the statements
+			continue
 		}
-		handler.Sp.StateDb.Transact(params[0], args...)
+		tx, err := storage.DecodeTransaction(data)
+		if err != nil {
+			return err
+		}
+		handler.Sp.StateDb.Transact(tx.Query, tx.Params...)
 	}
+	return storage.VerifyStateRoot(&handler.Sp.StateDb, block)
 }
 
 //ExecuteQuery performs a query on the database
@@ -99,27 +114,33 @@ func (handler *SimpleQueryHandler) ExecuteQuery(request SimpleHandlerRequest, re
 func (handler *SimpleQueryHandler) ExecuteTransaction(request SimpleHandlerRequest, responce *bool) error {
 	log.Printf("ExecuteTransaction called with request %v", request.Query)
 	*responce = false
-	err := handler.Sp.StateDb.Transact(request.Query, request.Params...)
+	txData, err := storage.Transaction{Query: request.Query, Params: request.Params}.Encode()
 	if err != nil {
 		return err
 	}
 
-	txData := request.Query
-	for _, param := range request.Params {
-		txData += fmt.Sprintf(";%v", param)
+	_, err = handler.Sp.StateDb.Transact(request.Query, request.Params...)
+	if err != nil {
+		return err
 	}
 
-	handler.Sp.Chain.AddBlock(txData)
+	block := handler.Sp.Chain.NextBlock(txData)
+	block.StateRoot, err = storage.ComputeStateRoot(&handler.Sp.StateDb)
+	if err != nil {
+		return err
+	}
+	err = handler.Sp.AppendBlock(block)
+	if err != nil {
+		return err
+	}
 	*responce = true
 	return nil
 }
 
 //Close saves the state database and closes the connection
 func (handler *SimpleQueryHandler) Close() {
-	if handler.Sp.ChainDb.IsOpen() {
+	if handler.Sp.IsOpen() {
 		log.Print("Handler closing...")
-		handler.Sp.UpdateChainState()
-		handler.Sp.ChainDb.Close()
-		handler.Sp.StateDb.Close()
+		handler.Sp.Close()
 	}
 }
@@ -0,0 +1,330 @@
+package handlers
+
+import (
+	"AdminBlockchain/storage"
+	"AdminBlockchain/utils"
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Transaction states
+const (
+	//TransactionUnknown the transaction was never submitted to this node
+	TransactionUnknown = 0
+	//TransactionPending the transaction is waiting in the pool
+	TransactionPending = 1
+	//TransactionCommitted the transaction is part of a block
+	TransactionCommitted = 2
+	//TransactionRejected the transaction failed when the block was produced
+	TransactionRejected = 3
+)
+
+// DefaultMaxBlockTransactions amount of pooled transactions that triggers sealing a block
+const DefaultMaxBlockTransactions = 100
+
+// DefaultStatusRetention amount of blocks the status of a committed or rejected transaction is kept for
+const DefaultStatusRetention = 1000
+
+// PendingTransaction a signed client transaction waiting to be sealed into a block
+type PendingTransaction struct {
+	ID        string  // hash of the method and the client signature
+	Method    string  // rpc method which received the transaction
+	From      Address // who sent the transaction
+	Submitted int64   // unix time of submission
+}
+
+// TransactionStatus status of a submitted transaction
+type TransactionStatus struct {
+	ID      string
+	State   int    // one of the transaction states
+	BlockID int    // block holding the transaction, if committed
+	Error   string // reason of the rejection, if rejected
+}
+
+type pooledTransaction struct {
+	PendingTransaction
+	request storage.Request
+}
+
+// settledTransaction a committed or rejected transaction and the chain height it was settled at
+type settledTransaction struct {
+	id     string
+	height int
+}
+
+// TransactionPool holds submitted transactions until the block producer seals them into a block.
+// Transactions are validated against the state including all pending transactions and sealed in submission order.
+// The pending state is a copy of the state with the pending transactions applied, it is copied again only after
+// the chain grows, so every submitted transaction is applied once per block.
+type TransactionPool struct {
+	MaxBlockTransactions int // amount of pending transactions that triggers sealing a block
+	StatusRetention      int // amount of blocks the status of a settled transaction is kept for
+
+	handler     *BaseQueryHandler
+	pending     []pooledTransaction
+	state       storage.Database // copy of the state with the pending transactions applied
+	stateHeight int              // chain height the pending state was copied at, -1 if it has to be copied again
+	stateTip    []byte           // hash of the top block the pending state was copied at, the chain may be replaced by a fork
+	statuses    map[string]TransactionStatus
+	settled     []settledTransaction // settled transactions in the order their statuses expire
+	full        chan bool
+	mutex       sync.Mutex
+}
+
+// NewTransactionPool creates a pool producing blocks with the handler
+func NewTransactionPool(handler *BaseQueryHandler) *TransactionPool {
+	return &TransactionPool{
+		MaxBlockTransactions: DefaultMaxBlockTransactions,
+		StatusRetention:      DefaultStatusRetention,
+		handler:              handler,
+		stateHeight:          -1,
+		statuses:             make(map[string]TransactionStatus),
+		full:                 make(chan bool, 1),
+	}
+}
+
+// transactionID derives the id of a client transaction
+func transactionID(method string, signature []byte) string {
+	return fmt.Sprintf("%x", utils.Hash(method, signature))
+}
+
+// Submit runs a signed client request. With a transaction pool the request is validated and queued,
+// otherwise it is applied in its own block right away.
+func (handler *BaseQueryHandler) Submit(request storage.Request, txID *string) error {
+	// the request is applied with the values it is decoded to from the block, like on every other node
+	data, err := request.Encode()
+	if err != nil {
+		return err
+	}
+	request, err = storage.DecodeRequest(data)
+	if err != nil {
+		return err
+	}
+
+	id := transactionID(request.Method, request.Signature)
+	if handler.Pool != nil {
+		err := handler.Pool.add(pooledTransaction{
+			PendingTransaction: PendingTransaction{ID: id, Method: request.Method, From: Address(request.Signer), Submitted: time.Now().Unix()},
+			request:            request})
+		if err != nil {
+			return err
+		}
+		*txID = id
+		return nil
+	}
+
+	scope, err := handler.Begin()
+	if err != nil {
+		return err
+	}
+	defer scope.Rollback()
+
+	err = scope.apply(request)
+	if err != nil {
+		return err
+	}
+	err = scope.Commit()
+	if err != nil {
+		return err
+	}
+	*txID = id
+	return nil
+}
+
+// ReadPending runs read queries against the state including all pending transactions
+func (handler *BaseQueryHandler) ReadPending(read func(db queryer) error) error {
+	if handler.Pool == nil {
+		return read(&handler.Sp.StateDb)
+	}
+
+	pool := handler.Pool
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	err := pool.updateState()
+	if err != nil {
+		return err
+	}
+	return read(&pool.state)
+}
+
+// updateState copies the state again if the chain changed since the pending state was copied. The pending transactions
+// are applied to the new copy, transactions failing against the new state are rejected.
+func (pool *TransactionPool) updateState() error {
+	handler := pool.handler
+	handler.scopeMutex.Lock()
+	height := len(handler.Sp.Chain)
+	var tip []byte
+	if height > 0 {
+		tip = handler.Sp.Chain[height-1].Hash()
+	}
+	if pool.stateHeight == height && bytes.Equal(pool.stateTip, tip) && pool.state.IsOpen() {
+		handler.scopeMutex.Unlock()
+		return nil
+	}
+	pool.stateHeight = -1
+	err := handler.Sp.StateDb.CopyInMemory(&pool.state)
+	handler.scopeMutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	var kept []pooledTransaction
+	for _, tx := range pool.pending {
+		err = pool.applyPending(tx.request, height)
+		if err != nil {
+			pool.settle(TransactionStatus{ID: tx.ID, State: TransactionRejected, Error: err.Error()}, height)
+			continue
+		}
+		kept = append(kept, tx)
+	}
+	pool.pending = kept
+	pool.stateHeight = height
+	pool.stateTip = tip
+	return nil
+}
+
+// applyPending applies the request to the pending state, nothing is changed if it fails
+func (pool *TransactionPool) applyPending(request storage.Request, height int) error {
+	tx, err := pool.state.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// the scope is not committed, it would produce a block
+	scope := &TransactionScope{handler: pool.handler, tx: tx, height: height, version: storage.CurrentBlockVersion}
+	err = scope.apply(request)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// settle records the final status of a transaction. Statuses settled StatusRetention blocks ago are forgotten.
+func (pool *TransactionPool) settle(status TransactionStatus, height int) {
+	pool.statuses[status.ID] = status
+	pool.settled = append(pool.settled, settledTransaction{id: status.ID, height: height})
+
+	expired := 0
+	for _, settled := range pool.settled {
+		if height-settled.height < pool.StatusRetention {
+			break
+		}
+		// a rejected transaction may have been submitted again since
+		if current, found := pool.statuses[settled.id]; found && current.State != TransactionPending {
+			delete(pool.statuses, settled.id)
+		}
+		expired++
+	}
+	pool.settled = pool.settled[expired:]
+}
+
+// add validates the transaction on top of the pending ones and queues it
+func (pool *TransactionPool) add(tx pooledTransaction) error {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	if status, found := pool.statuses[tx.ID]; found && status.State != TransactionRejected {
+		return errors.New("transaction already submitted")
+	}
+
+	err := pool.updateState()
+	if err != nil {
+		return err
+	}
+	err = pool.applyPending(tx.request, pool.stateHeight)
+	if err != nil {
+		return err
+	}
+
+	pool.pending = append(pool.pending, tx)
+	pool.statuses[tx.ID] = TransactionStatus{ID: tx.ID, State: TransactionPending}
+	if len(pool.pending) >= pool.MaxBlockTransactions {
+		select {
+		case pool.full <- true:
+		default:
+		}
+	}
+	return nil
+}
+
+// Seal applies pending transactions in submission order and stores them in a single block.
+// Transactions that fail against the current state are rejected. Returns the amount of committed transactions.
+func (pool *TransactionPool) Seal() (int, error) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	count := len(pool.pending)
+	if count == 0 {
+		return 0, nil
+	}
+	if pool.MaxBlockTransactions > 0 && count > pool.MaxBlockTransactions {
+		count = pool.MaxBlockTransactions
+	}
+	batch := pool.pending[:count]
+
+	scope, err := pool.handler.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer scope.Rollback()
+
+	var included []pooledTransaction
+	rejected := make(map[string]error)
+	for _, tx := range batch {
+		err = scope.apply(tx.request)
+		if err != nil {
+			rejected[tx.ID] = err
+			continue
+		}
+		included = append(included, tx)
+	}
+
+	if len(included) > 0 {
+		err = scope.Commit()
+		if err != nil {
+			return 0, err
+		}
+	}
+	height := len(pool.handler.Sp.Chain)
+	for _, tx := range batch {
+		if err, found := rejected[tx.ID]; found {
+			pool.settle(TransactionStatus{ID: tx.ID, State: TransactionRejected, Error: err.Error()}, height)
+		} else {
+			pool.settle(TransactionStatus{ID: tx.ID, State: TransactionCommitted, BlockID: scope.blockID}, height)
+		}
+	}
+	pool.pending = append([]pooledTransaction{}, pool.pending[count:]...)
+	// rejected transactions are part of the pending state
+	pool.stateHeight = -1
+	return len(included), nil
+}
+
+// Pending rpc method, lists the transactions waiting in the pool
+func (pool *TransactionPool) Pending(_ int, pending *[]PendingTransaction) error {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	*pending = make([]PendingTransaction, 0, len(pool.pending))
+	for _, tx := range pool.pending {
+		*pending = append(*pending, tx.PendingTransaction)
+	}
+	return nil
+}
+
+// Status rpc method, returns the status of a submitted transaction
+func (pool *TransactionPool) Status(id string, status *TransactionStatus) error {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	var found bool
+	*status, found = pool.statuses[id]
+	if !found {
+		*status = TransactionStatus{ID: id, State: TransactionUnknown}
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"testing"
+)
+
+// newTestPool queues the transactions of the node in a pool
+func newTestPool(node *testNode) *TransactionPool {
+	node.Pool = NewTransactionPool(node.BaseQueryHandler)
+	return node.Pool
+}
+
+func transactionStatus(t *testing.T, pool *TransactionPool, id string) TransactionStatus {
+	t.Helper()
+	var status TransactionStatus
+	err := pool.Status(id, &status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return status
+}
+
+// Check if pending transactions are validated on top of each other and sealed in a single block
+func TestPoolSeal(t *testing.T) {
+	producer, admin := newKey(t), newKey(t)
+	node := newTestChain(t, producer, admin.PublicKey())
+	pool := newTestPool(node)
+	adminAddress := GetAddressFromPubKey(admin.PublicKey())
+	nonce := node.nonce(t, adminAddress)
+
+	first := node.createAccount(t, admin, newKey(t).PublicKey(), BasicAccountAccess)
+	second := node.createAccount(t, admin, newKey(t).PublicKey(), BasicAccountAccess)
+	assertEq(t, nonce+2, node.nonce(t, adminAddress))
+	assertEq(t, 1, len(node.Sp.Chain))
+
+	var pending []PendingTransaction
+	assertEq(t, nil, pool.Pending(0, &pending))
+	assertEq(t, 2, len(pending))
+	assertEq(t, TransactionPending, transactionStatus(t, pool, pending[0].ID).State)
+
+	count, err := pool.Seal()
+	assertEq(t, nil, err)
+	assertEq(t, 2, count)
+	assertEq(t, 2, len(node.Sp.Chain))
+	for _, address := range []Address{first, second} {
+		exists, err := accountExists(&node.Sp.StateDb, address)
+		assertEq(t, nil, err)
+		assertEq(t, true, exists)
+	}
+	for _, tx := range pending {
+		status := transactionStatus(t, pool, tx.ID)
+		assertEq(t, TransactionCommitted, status.State)
+		assertEq(t, 1, status.BlockID)
+	}
+}
+
+// Check if a transaction invalidated after it was queued is rejected and the rest of the batch is sealed
+func TestPoolSealRejected(t *testing.T) {
+	producer, admin := newKey(t), newKey(t)
+	node := newTestChain(t, producer, admin.PublicKey())
+	pool := newTestPool(node)
+
+	rejected := newKey(t).PublicKey()
+	node.createAccount(t, admin, rejected, BasicAccountAccess)
+	committed := node.createAccount(t, admin, newKey(t).PublicKey(), BasicAccountAccess)
+	var pending []PendingTransaction
+	assertEq(t, nil, pool.Pending(0, &pending))
+
+	// a block produced past the pool uses the nonce of the first pending transaction
+	node.Pool = nil
+	node.createAccount(t, admin, newKey(t).PublicKey(), BasicAccountAccess)
+	node.Pool = pool
+
+	count, err := pool.Seal()
+	assertEq(t, nil, err)
+	assertEq(t, 1, count)
+	assertEq(t, 3, len(node.Sp.Chain))
+	assertEq(t, TransactionRejected, transactionStatus(t, pool, pending[0].ID).State)
+	assertEq(t, "nonce already used", transactionStatus(t, pool, pending[0].ID).Error)
+	assertEq(t, TransactionCommitted, transactionStatus(t, pool, pending[1].ID).State)
+
+	exists, err := accountExists(&node.Sp.StateDb, GetAddressFromPubKey(rejected))
+	assertEq(t, nil, err)
+	assertEq(t, false, exists)
+	exists, err = accountExists(&node.Sp.StateDb, committed)
+	assertEq(t, nil, err)
+	assertEq(t, true, exists)
+}
+
+// Check if pending transactions failing against a new block are rejected before they are sealed
+func TestPoolPendingStateUpdate(t *testing.T) {
+	producer, admin := newKey(t), newKey(t)
+	node := newTestChain(t, producer, admin.PublicKey())
+	pool := newTestPool(node)
+	adminAddress := GetAddressFromPubKey(admin.PublicKey())
+	nonce := node.nonce(t, adminAddress)
+
+	node.createAccount(t, admin, newKey(t).PublicKey(), BasicAccountAccess)
+	var pending []PendingTransaction
+	assertEq(t, nil, pool.Pending(0, &pending))
+
+	node.Pool = nil
+	node.createAccount(t, admin, newKey(t).PublicKey(), BasicAccountAccess)
+	node.Pool = pool
+
+	// the pending state is copied again for the new block
+	assertEq(t, nonce+1, node.nonce(t, adminAddress))
+	assertEq(t, TransactionRejected, transactionStatus(t, pool, pending[0].ID).State)
+	assertEq(t, nil, pool.Pending(0, &pending))
+	assertEq(t, 0, len(pending))
+	node.createAccount(t, admin, newKey(t).PublicKey(), BasicAccountAccess)
+	assertEq(t, nil, pool.Pending(0, &pending))
+	assertEq(t, 1, len(pending))
+}
+
+// Check if a transaction can't be queued twice
+func TestPoolDuplicate(t *testing.T) {
+	producer, admin := newKey(t), newKey(t)
+	node := newTestChain(t, producer, admin.PublicKey())
+	pool := newTestPool(node)
+	user := newKey(t)
+	pubKey, err := user.PublicKey().Store()
+	assertEq(t, nil, err)
+
+	adminAddress := GetAddressFromPubKey(admin.PublicKey())
+	nonce := node.nonce(t, adminAddress)
+	params := CreateAccountParams{
+		From:         adminAddress,
+		PersonalInfo: "test",
+		AccessLevel:  BasicAccountAccess,
+		PubKey:       pubKey,
+		Nonce:        nonce,
+		Signature:    node.sign(t, admin, "AccountHandler.CreateAccount", OperationCreateAccount, nonce, "test", BasicAccountAccess, pubKey)}
+	var txID string
+	assertEq(t, nil, node.accounts.CreateAccount(params, &txID))
+	assertErr(t, node.accounts.CreateAccount(params, &txID))
+
+	count, err := pool.Seal()
+	assertEq(t, nil, err)
+	assertEq(t, 1, count)
+	// a committed transaction can't be replayed either
+	assertErr(t, node.accounts.CreateAccount(params, &txID))
+}
+
+// Check if the statuses of settled transactions are forgotten after the retention
+func TestPoolStatusRetention(t *testing.T) {
+	producer, admin := newKey(t), newKey(t)
+	node := newTestChain(t, producer, admin.PublicKey())
+	pool := newTestPool(node)
+	pool.StatusRetention = 2
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		node.createAccount(t, admin, newKey(t).PublicKey(), BasicAccountAccess)
+		var pending []PendingTransaction
+		assertEq(t, nil, pool.Pending(0, &pending))
+		ids = append(ids, pending[0].ID)
+		_, err := pool.Seal()
+		assertEq(t, nil, err)
+	}
+
+	assertEq(t, TransactionUnknown, transactionStatus(t, pool, ids[0]).State)
+	assertEq(t, TransactionCommitted, transactionStatus(t, pool, ids[1]).State)
+	assertEq(t, TransactionCommitted, transactionStatus(t, pool, ids[2]).State)
+	assertEq(t, 2, len(pool.settled))
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"AdminBlockchain/storage"
+	"AdminBlockchain/utils"
+	"time"
+)
+
+// queryer runs read queries, either on the state database or inside a transaction scope
+type queryer interface {
+	Query(query string, params ...interface{}) (*storage.Rows, error)
+}
+
+// TransactionScope groups several statements into a single block.
+// Statements are applied atomically, a block is only produced if the scope is committed.
+type TransactionScope struct {
+	handler      *BaseQueryHandler
+	tx           *storage.Tx
+	transactions []string
+	done         bool
+	applying     bool // a client request is being applied, its statements are not recorded
+	approved     bool // the request is authorized by an approved proposal instead of its signature
+	height       int  // id of the block the scope produces or replays
+	version      int  // version of the block the scope produces or replays
+	blockID      int  // id of the produced block, set by Commit
+}
+
+// Begin starts a new transaction scope. Only one scope can be open at a time, the scope must be committed or rolled back.
+func (handler *BaseQueryHandler) Begin() (*TransactionScope, error) {
+	handler.scopeMutex.Lock()
+	tx, err := handler.Sp.StateDb.Begin()
+	if err != nil {
+		handler.scopeMutex.Unlock()
+		return nil, err
+	}
+	return &TransactionScope{handler: handler, tx: tx, height: len(handler.Sp.Chain), version: storage.CurrentBlockVersion}, nil
+}
+
+// ExecuteTransaction performs a statement within the scope. Statements executed by client requests are
+// not stored in the block, the request is replayed instead.
+func (scope *TransactionScope) ExecuteTransaction(query string, params ...interface{}) (int64, error) {
+	if scope.done {
+		return -1, storage.ErrTxDone
+	}
+	if scope.applying {
+		return scope.tx.Transact(query, params...)
+	}
+	txData, err := storage.Transaction{Query: query, Params: params}.Encode()
+	if err != nil {
+		return -1, err
+	}
+
+	inserted, err := scope.tx.Transact(query, params...)
+	if err != nil {
+		return -1, err
+	}
+
+	scope.transactions = append(scope.transactions, txData)
+	return inserted, nil
+}
+
+// Query performs a query within the scope, it sees all changes made in the scope
+func (scope *TransactionScope) Query(query string, params ...interface{}) (*storage.Rows, error) {
+	if scope.done {
+		return nil, storage.ErrTxDone
+	}
+	return scope.tx.Query(query, params...)
+}
+
+// apply applies a signed client request inside a savepoint and stores the request in the block
+func (scope *TransactionScope) apply(request storage.Request) error {
+	return scope.savepoint(func(scope *TransactionScope) error {
+		scope.applying = true
+		err := scope.handler.operations.apply(scope, request)
+		scope.applying = false
+		if err != nil {
+			return err
+		}
+
+		data, err := request.Encode()
+		if err != nil {
+			return err
+		}
+		scope.transactions = append(scope.transactions, data)
+		return nil
+	})
+}
+
+// savepoint runs apply inside a savepoint. If it fails its changes are discarded and the scope stays usable.
+func (scope *TransactionScope) savepoint(apply func(scope *TransactionScope) error) error {
+	if scope.done {
+		return storage.ErrTxDone
+	}
+	_, err := scope.tx.Transact("SAVEPOINT pooled")
+	if err != nil {
+		return err
+	}
+
+	count := len(scope.transactions)
+	err = apply(scope)
+	if err != nil {
+		scope.transactions = scope.transactions[:count]
+		_, rollbackErr := scope.tx.Transact("ROLLBACK TO pooled")
+		utils.LogError(rollbackErr)
+	}
+	_, releaseErr := scope.tx.Transact("RELEASE pooled")
+	utils.LogError(releaseErr)
+	return err
+}
+
+// Commit applies the changes and stores all executed statements in a single block
+func (scope *TransactionScope) Commit() error {
+	if scope.done {
+		return storage.ErrTxDone
+	}
+	if len(scope.transactions) == 0 {
+		return scope.Rollback()
+	}
+	err := scope.handler.operations.finishBlock(scope)
+	if err != nil {
+		scope.Rollback()
+		return err
+	}
+	scope.done = true
+	defer scope.handler.scopeMutex.Unlock()
+
+	sp := &scope.handler.Sp
+	stateRoot, err := storage.ComputeStateRoot(scope.tx)
+	if err != nil {
+		scope.tx.Rollback()
+		return err
+	}
+	// the turn is checked before the block is signed, a signer doesn't sign another block at the same height
+	inTurn, err := scope.handler.inTurn(scope.tx, len(sp.Chain), time.Now().Unix())
+	if err == nil && !inTurn {
+		err = ErrNotInTurn
+	}
+	var block storage.Block
+	if err == nil {
+		block, err = scope.handler.builder.Build(&sp.Chain, stateRoot, scope.transactions...)
+	}
+	if err == nil {
+		err = storage.WriteStateInfo(scope.tx, block)
+	}
+	if err == nil {
+		// the block is persisted first, if the node stops before the state is committed it is replayed on startup
+		err = sp.AppendBlock(block)
+	}
+	if err != nil {
+		scope.tx.Rollback()
+		return err
+	}
+
+	err = scope.tx.Commit()
+	if err != nil {
+		utils.LogError(sp.RemoveLastBlock())
+		return err
+	}
+	scope.blockID = block.ID
+	sp.SnapshotIfDue()
+	return nil
+}
+
+// Rollback discards all changes made in the scope. Does nothing if the scope is already finished.
+func (scope *TransactionScope) Rollback() error {
+	if scope.done {
+		return nil
+	}
+	scope.done = true
+	defer scope.handler.scopeMutex.Unlock()
+	return scope.tx.Rollback()
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"AdminBlockchain/storage"
+	"bytes"
+	"testing"
+)
+
+// Check if a block stores the signed client request instead of the statements it caused
+func TestBlockStoresSignedRequest(t *testing.T) {
+	producer, admin := newKey(t), newKey(t)
+	node := newTestChain(t, producer, admin.PublicKey())
+	adminAddress := GetAddressFromPubKey(admin.PublicKey())
+	nonce := node.nonce(t, adminAddress)
+	node.createAccount(t, admin, newKey(t).PublicKey(), BasicAccountAccess)
+
+	block := node.Sp.Chain[len(node.Sp.Chain)-1]
+	assertEq(t, 1, len(block.Transactions))
+	assertEq(t, true, storage.IsRequest(block.Transactions[0]))
+	request, err := storage.DecodeRequest(block.Transactions[0])
+	assertEq(t, nil, err)
+	assertEq(t, "AccountHandler.CreateAccount", request.Method)
+	assertEq(t, OperationCreateAccount, request.Operation)
+	assertEq(t, adminAddress, Address(request.Signer))
+	assertEq(t, nonce, request.Nonce)
+
+	// anyone can check who authorized the block content
+	payload, err := requestPayload(&node.Sp.StateDb, block.Version, request)
+	assertEq(t, nil, err)
+	assertEq(t, nil, admin.PublicKey().CheckSignature(payload, request.Signature))
+}
+
+// Check if a failing request leaves the scope usable for the next one
+func TestScopeApplyFailed(t *testing.T) {
+	producer, admin := newKey(t), newKey(t)
+	node := newTestChain(t, producer, admin.PublicKey())
+	adminAddress := GetAddressFromPubKey(admin.PublicKey())
+	nonce := node.nonce(t, adminAddress)
+	height := len(node.Sp.Chain)
+
+	failed := createAccountParams(t, node, admin, newKey(t).PublicKey(), nonce)
+	failed.Signature[0] ^= 1
+	valid := createAccountParams(t, node, admin, newKey(t).PublicKey(), nonce)
+
+	scope, err := node.Begin()
+	assertEq(t, nil, err)
+	defer scope.Rollback()
+	assertErr(t, scope.apply(createAccountRequest(failed)))
+	assertEq(t, nil, scope.apply(createAccountRequest(valid)))
+	assertEq(t, nil, scope.Commit())
+	assertEq(t, height+1, len(node.Sp.Chain))
+	assertEq(t, 1, len(node.Sp.Chain[height].Transactions))
+}
+
+// Check if an operation failing at its second statement leaves neither state nor a block behind
+func TestScopeFailedStatement(t *testing.T) {
+	producer, admin := newKey(t), newKey(t)
+	node := newTestChain(t, producer, admin.PublicKey())
+	height := len(node.Sp.Chain)
+	root, err := storage.ComputeStateRoot(&node.Sp.StateDb)
+	assertEq(t, nil, err)
+
+	node.RegisterOperation("test.partial", func(scope *TransactionScope, request storage.Request) error {
+		_, err := scope.ExecuteTransaction("insert into Balances (owner, balance) values (?, ?)", request.Signer, 1)
+		if err != nil {
+			return err
+		}
+		_, err = scope.ExecuteTransaction("insert into Missing (owner) values (?)", request.Signer)
+		return err
+	})
+	var txID string
+	assertErr(t, node.Submit(storage.Request{Method: "Test.Partial", Operation: "test.partial", Signer: "partial"}, &txID))
+	assertEq(t, height, len(node.Sp.Chain))
+	_, found, err := node.contracts.queryBalance(&node.Sp.StateDb, "partial")
+	assertEq(t, nil, err)
+	assertEq(t, false, found)
+
+	// statements executed directly in a scope are discarded with it as well
+	scope, err := node.Begin()
+	assertEq(t, nil, err)
+	_, err = scope.ExecuteTransaction("insert into Balances (owner, balance) values (?, ?)", "direct", 1)
+	assertEq(t, nil, err)
+	_, err = scope.ExecuteTransaction("insert into Missing (owner) values (?)", "direct")
+	assertErr(t, err)
+	assertEq(t, nil, scope.Rollback())
+	assertEq(t, height, len(node.Sp.Chain))
+	_, found, err = node.contracts.queryBalance(&node.Sp.StateDb, "direct")
+	assertEq(t, nil, err)
+	assertEq(t, false, found)
+
+	after, err := storage.ComputeStateRoot(&node.Sp.StateDb)
+	assertEq(t, nil, err)
+	assertEq(t, true, bytes.Equal(root, after))
+}
+
+// createAccountRequest returns the request submitted by AccountHandler.CreateAccount
+func createAccountRequest(params CreateAccountParams) storage.Request {
+	return storage.Request{
+		Method:    "AccountHandler.CreateAccount",
+		Operation: OperationCreateAccount,
+		Signer:    string(params.From),
+		Nonce:     params.Nonce,
+		Params:    []interface{}{params.PersonalInfo, int64(params.AccessLevel), params.PubKey},
+		Signature: params.Signature}
+}
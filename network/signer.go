@@ -0,0 +1,210 @@
+package network
+
+import (
+	"AdminBlockchain/storage"
+	"AdminBlockchain/utils"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/rpc"
+	"os"
+	"sync"
+)
+
+// SignerService rpc service of the signer daemon, it signs block headers with a key held by the daemon.
+// Block heights only increase, a header at the height of the last signed block is only signed again if it is
+// the same block, so the daemon never signs two different blocks at a height.
+type SignerService struct {
+	key       utils.SignatureCreator
+	statePath string // file keeping the last signed block across restarts, not kept if empty
+	last      signerState
+	mutex     sync.Mutex
+}
+
+// signerState the last block signed by the daemon
+type signerState struct {
+	Height int
+	Hash   []byte
+}
+
+// NewSignerService creates the signer service of the key. The last signed block is read from the state file if it exists.
+func NewSignerService(key utils.SignatureCreator, statePath string) (*SignerService, error) {
+	service := &SignerService{key: key, statePath: statePath, last: signerState{Height: -1}}
+	if statePath == "" {
+		return service, nil
+	}
+	data, err := ioutil.ReadFile(statePath)
+	if os.IsNotExist(err) {
+		return service, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &service.last)
+	if err != nil {
+		return nil, fmt.Errorf("signer state %s: %v", statePath, err)
+	}
+	return service, nil
+}
+
+// SignBlock rpc method, signs the hash of a block header. Only headers with a canonical hash above the last
+// signed block are signed, so the daemon can't be used to sign client requests or conflicting blocks.
+func (service *SignerService) SignBlock(header storage.BlockHeader, signature *[]byte) error {
+	if header.Version < storage.CanonicalBlockVersion {
+		return errors.New("only blocks with a canonical header hash are signed")
+	}
+	header.Signature = nil
+	hash := storage.Block{BlockHeader: header}.Hash()
+
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+	if header.ID < service.last.Height || (header.ID == service.last.Height && !bytes.Equal(hash, service.last.Hash)) {
+		return fmt.Errorf("block %d is not above the last signed block %d", header.ID, service.last.Height)
+	}
+	// the height is kept before the signature is handed out
+	err := service.save(signerState{Height: header.ID, Hash: hash})
+	if err != nil {
+		return err
+	}
+	*signature, err = service.key.Sign(hash)
+	return err
+}
+
+// save replaces the state file with the last signed block
+func (service *SignerService) save(state signerState) error {
+	if service.statePath != "" {
+		data, err := json.Marshal(state)
+		if err != nil {
+			return err
+		}
+		tmpPath := service.statePath + ".tmp"
+		err = ioutil.WriteFile(tmpPath, data, 0600)
+		if err != nil {
+			return err
+		}
+		err = os.Rename(tmpPath, service.statePath)
+		if err != nil {
+			return err
+		}
+	}
+	service.last = state
+	return nil
+}
+
+// PublicKey rpc method, returns the PKIX encoded public key of the daemon
+func (service *SignerService) PublicKey(_ int, key *[]byte) error {
+	var err error
+	*key, err = service.key.PublicKey().Store()
+	return err
+}
+
+// ListenSigner creates the unix socket of the signer daemon, only the owner of the daemon can connect to it
+func ListenSigner(path string) (net.Listener, error) {
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		// left behind by a daemon which didn't shut down
+		os.Remove(path)
+	}
+	return listenPrivate(path)
+}
+
+// ServeSigner serves signatures of the service to the connections of the listener, until the listener is closed
+func ServeSigner(listener net.Listener, service *SignerService) error {
+	server := rpc.NewServer()
+	err := server.RegisterName("Signer", service)
+	if err != nil {
+		return err
+	}
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go server.ServeConn(conn)
+	}
+}
+
+// RemoteSigner signs with the key of a signer daemon, so the key doesn't have to be loaded by the server.
+// It implements utils.SignatureCreator and storage.HeaderSigner and reconnects if the daemon was restarted.
+type RemoteSigner struct {
+	path      string
+	mutex     sync.Mutex
+	client    *rpc.Client
+	publicKey utils.SignatureValidator
+}
+
+// DialSigner connects to the signer daemon listening on the unix socket
+func DialSigner(path string) (*RemoteSigner, error) {
+	signer := &RemoteSigner{path: path}
+	err := signer.connect()
+	if err != nil {
+		return nil, err
+	}
+
+	var keyData []byte
+	err = signer.client.Call("Signer.PublicKey", 0, &keyData)
+	if err != nil {
+		signer.client.Close()
+		return nil, err
+	}
+	signer.publicKey, err = utils.ParsePublicKey(keyData)
+	if err != nil {
+		signer.client.Close()
+		return nil, err
+	}
+	return signer, nil
+}
+
+func (signer *RemoteSigner) connect() error {
+	conn, err := net.Dial("unix", signer.path)
+	if err != nil {
+		return err
+	}
+	signer.client = rpc.NewClient(conn)
+	return nil
+}
+
+// Sign fails, the daemon only signs block headers
+func (signer *RemoteSigner) Sign(data []byte) ([]byte, error) {
+	return nil, errors.New("the signer daemon only signs block headers")
+}
+
+// SignHeader asks the daemon to sign the block header. The signature is checked, so a daemon holding another key is detected.
+func (signer *RemoteSigner) SignHeader(header storage.BlockHeader) ([]byte, error) {
+	signer.mutex.Lock()
+	defer signer.mutex.Unlock()
+
+	var signature []byte
+	err := signer.client.Call("Signer.SignBlock", header, &signature)
+	if _, rejected := err.(rpc.ServerError); err != nil && !rejected {
+		// the connection broke, the daemon may have been restarted
+		signer.client.Close()
+		err = signer.connect()
+		if err != nil {
+			return nil, err
+		}
+		err = signer.client.Call("Signer.SignBlock", header, &signature)
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = signer.publicKey.CheckSignature(storage.Block{BlockHeader: header}.Hash(), signature)
+	if err != nil {
+		return nil, errors.New("the signer daemon returned an invalid signature")
+	}
+	return signature, nil
+}
+
+// PublicKey returns the public key of the daemon
+func (signer *RemoteSigner) PublicKey() utils.SignatureValidator {
+	return signer.publicKey
+}
+
+// Close closes the connection to the daemon
+func (signer *RemoteSigner) Close() error {
+	signer.mutex.Lock()
+	defer signer.mutex.Unlock()
+	return signer.client.Close()
+}
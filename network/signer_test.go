@@ -0,0 +1,105 @@
+package network
+
+import (
+	"AdminBlockchain/storage"
+	"AdminBlockchain/utils"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// startSigner serves the key on a socket in a temporary directory, returns the directory
+func startSigner(t *testing.T, key utils.SignatureCreator, dir string) string {
+	t.Helper()
+	service, err := NewSignerService(key, filepath.Join(dir, "signer.state"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	socket := filepath.Join(dir, "signer.sock")
+	listener, err := ListenSigner(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go ServeSigner(listener, service)
+	return socket
+}
+
+func testBlock(chain storage.Blockchain, height int, transaction string) storage.Block {
+	for len(chain) < height {
+		chain.AddBlock("filler")
+	}
+	return chain.NextBlock(transaction)
+}
+
+// Check if blocks are signed through the daemon and only above the last signed block
+func TestSignerRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "signer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	key, err := utils.GenerateKey(utils.KeyAlgorithmEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	socket := startSigner(t, key, dir)
+
+	info, err := os.Stat(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		t.Errorf("socket is accessible by other users: %v", info.Mode())
+	}
+
+	signer, err := DialSigner(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signer.Close()
+	if _, err = signer.Sign(make([]byte, 32)); err == nil {
+		t.Error("daemon signed raw data")
+	}
+
+	var chain storage.Blockchain
+	block := testBlock(chain, 2, "block")
+	if err = block.Sign(signer); err != nil {
+		t.Fatal(err)
+	}
+	if err = block.CheckSignature(key.PublicKey()); err != nil {
+		t.Error(err)
+	}
+	// a retry of the same block is signed again, another block at the height isn't
+	if err = block.Sign(signer); err != nil {
+		t.Error(err)
+	}
+	other := testBlock(chain, 2, "other")
+	if err = other.Sign(signer); err == nil {
+		t.Error("daemon signed two blocks at a height")
+	}
+	lower := testBlock(chain, 1, "lower")
+	if err = lower.Sign(signer); err == nil {
+		t.Error("daemon signed a block below the last signed block")
+	}
+	legacy := testBlock(chain, 3, "legacy")
+	legacy.Version = storage.SignedBlockVersion
+	if err = legacy.Sign(signer); err == nil {
+		t.Error("daemon signed a block without a canonical hash")
+	}
+
+	// a restarted daemon keeps the height
+	service, err := NewSignerService(key, filepath.Join(dir, "signer.state"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var signature []byte
+	if err = service.SignBlock(other.BlockHeader, &signature); err == nil {
+		t.Error("restarted daemon signed two blocks at a height")
+	}
+	next := testBlock(chain, 3, "next")
+	if err = service.SignBlock(next.BlockHeader, &signature); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+// +build !windows
+
+package network
+
+import (
+	"net"
+	"syscall"
+)
+
+// listenPrivate creates the unix socket with a umask denying other users, so there is no moment it is open to them.
+// The umask is process wide, the daemon creates the socket before it creates any other file.
+func listenPrivate(path string) (net.Listener, error) {
+	mask := syscall.Umask(0177)
+	defer syscall.Umask(mask)
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,10 @@
+package network
+
+import (
+	"net"
+)
+
+// listenPrivate creates the unix socket, access to it is controlled by the directory holding it
+func listenPrivate(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
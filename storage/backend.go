@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"fmt"
+)
+
+// Backend opens the chain and state stores of a node
+type Backend interface {
+	// OpenChainStore opens the store holding the blocks of the chain located in dir
+	OpenChainStore(dir string) (ChainStore, error)
+	// OpenStateDb opens the state database of the chain located in dir. The existing state is discarded if reset is set.
+	OpenStateDb(db *Database, dir string, reset bool) error
+	// Persistent returns true if stored data survives a restart of the node
+	Persistent() bool
+}
+
+// ChainStore persists the blocks of a chain
+type ChainStore interface {
+	// LoadBlocks returns all stored blocks ordered by id
+	LoadBlocks() (Blockchain, error)
+	// Height returns the amount of stored blocks
+	Height() (int, error)
+	// AppendBlock stores the block at the top of the chain
+	AppendBlock(block Block) error
+	// RemoveBlocks removes all blocks starting at the height
+	RemoveBlocks(height int) error
+	// ReplaceBlocks overwrites all stored blocks
+	ReplaceBlocks(chain Blockchain) error
+	// Version reads the chain version marker, returns false if it was never set
+	Version() (int, bool, error)
+	// SetVersion writes the chain version marker
+	SetVersion(version int) error
+	// Close closes the store
+	Close() error
+}
+
+// Names of the available backends
+const (
+	SQLiteBackendName = "sqlite"
+	MemoryBackendName = "memory"
+)
+
+// BackendByName returns the backend selected in the configuration
+func BackendByName(name string) (Backend, error) {
+	switch name {
+	case SQLiteBackendName, "":
+		return SQLiteBackend{}, nil
+	case MemoryBackendName:
+		return MemoryBackend{}, nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", name)
+	}
+}
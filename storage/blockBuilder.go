@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"AdminBlockchain/utils"
+	"sync"
+)
+
+// BlockBuilder collects pending transactions and seals them into blocks
+type BlockBuilder struct {
+	Signer   utils.SignatureCreator // signs sealed blocks, blocks are left unsigned if not set
+	Producer string                 // address of the producer stored in sealed blocks
+	pending  []string
+	mutex    sync.Mutex
+}
+
+// AddTransaction queues an encoded transaction for the next block
+func (builder *BlockBuilder) AddTransaction(tx string) {
+	builder.mutex.Lock()
+	builder.pending = append(builder.pending, tx)
+	builder.mutex.Unlock()
+}
+
+// Pending returns the amount of transactions waiting for the next block
+func (builder *BlockBuilder) Pending() int {
+	builder.mutex.Lock()
+	defer builder.mutex.Unlock()
+	return len(builder.pending)
+}
+
+// Seal appends a block with all pending transactions and the resulting state root to the chain.
+// Returns false if there was nothing to seal.
+func (builder *BlockBuilder) Seal(chain *Blockchain, stateRoot []byte) (bool, error) {
+	builder.mutex.Lock()
+	defer builder.mutex.Unlock()
+	if len(builder.pending) == 0 {
+		return false, nil
+	}
+
+	block, err := builder.Build(chain, stateRoot, builder.pending...)
+	if err != nil {
+		return false, err
+	}
+
+	chain.InsertBlock(block)
+	builder.pending = nil
+	return true, nil
+}
+
+// Build creates a signed block with the transactions on top of the chain, without appending it
+func (builder *BlockBuilder) Build(chain *Blockchain, stateRoot []byte, transactions ...string) (Block, error) {
+	block := chain.NextBlock(transactions...)
+	block.StateRoot = stateRoot
+	block.Producer = builder.Producer
+	if builder.Signer != nil {
+		err := block.Sign(builder.Signer)
+		if err != nil {
+			return Block{}, err
+		}
+	}
+	return block, nil
+}
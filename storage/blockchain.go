@@ -1,65 +1,173 @@
 package storage
 
 import (
+	"AdminBlockchain/utils"
 	"bytes"
 	"crypto/sha256"
+	"errors"
+	"strconv"
+	"time"
 )
 
+// Block versions
+const (
+	// LegacyBlockVersion blocks holding a single transaction, hashed directly
+	LegacyBlockVersion = 0
+	// MerkleBlockVersion blocks holding a list of transactions, committed by a merkle root
+	MerkleBlockVersion = 1
+	// SignedBlockVersion blocks with a timestamp and an embedded producer signature
+	SignedBlockVersion = 2
+	// CanonicalBlockVersion blocks hashed over the canonical binary header encoding
+	CanonicalBlockVersion = 3
+	// StateRootBlockVersion blocks committing to the state after their transactions
+	StateRootBlockVersion = 4
+	// OperationBlockVersion blocks recording client requests, replayed by the handlers instead of their statements
+	OperationBlockVersion = 5
+	// DomainSignatureBlockVersion blocks recording client requests signed over the canonical signing payload
+	DomainSignatureBlockVersion = 6
+	// CurrentBlockVersion version of newly created blocks
+	CurrentBlockVersion = DomainSignatureBlockVersion
+)
+
+// BlockHeader describes a block and commits to its transactions
+type BlockHeader struct {
+	Version    int
+	ID         int
+	PrevHash   []byte
+	MerkleRoot []byte
+	StateRoot  []byte // hash of the state after applying the block, see ComputeStateRoot
+	Timestamp  int64  // unix time of block creation
+	Producer   string // address of the block producer
+	Signature  []byte // producer signature of the block hash
+}
+
 // Block is a basic block within a blockchain
 type Block struct {
-	ID       int
-	PrevHash []byte
-	Data     string
+	BlockHeader
+	Transactions []string
 }
 
-// Hash function, computes the hash of the block
+// NewBlock creates a block holding the specified transactions
+func NewBlock(id int, prevHash []byte, transactions ...string) Block {
+	return Block{
+		BlockHeader: BlockHeader{
+			Version:    CurrentBlockVersion,
+			ID:         id,
+			PrevHash:   prevHash,
+			MerkleRoot: MerkleRoot(transactions),
+			Timestamp:  time.Now().Unix(),
+		},
+		Transactions: transactions,
+	}
+}
+
+// Hash function, computes the hash of the block. The signature is not part of the hash.
 func (block Block) Hash() []byte {
+	if block.Version < CanonicalBlockVersion {
+		return block.legacyHash()
+	}
+
+	hash := sha256.Sum256(block.BlockHeader.Encode())
+	return hash[:]
+}
+
+// legacyHash computes the hash of blocks created before the canonical header encoding.
+// It is ambiguous and must only be kept to recognize old chains.
+func (block Block) legacyHash() []byte {
 	hash := sha256.New()
 
 	var buffer bytes.Buffer
-	buffer.WriteString(block.Data)
-	buffer.WriteString(string(block.ID))
+	if block.Version == LegacyBlockVersion {
+		if len(block.Transactions) > 0 {
+			buffer.WriteString(block.Transactions[0])
+		}
+	} else {
+		buffer.Write(block.MerkleRoot)
+	}
+	buffer.WriteString(string(rune(block.ID)))
 	buffer.Write(block.PrevHash)
+	if block.Version >= SignedBlockVersion {
+		buffer.WriteString(strconv.FormatInt(block.Timestamp, 10))
+		buffer.WriteString(block.Producer)
+	}
 
 	hash.Write(buffer.Bytes())
 	return hash.Sum(nil)
 }
 
+// HeaderSigner a signer which signs block headers instead of arbitrary data, so it can check what it signs
+type HeaderSigner interface {
+	// SignHeader returns the signature of the block hash of the header
+	SignHeader(header BlockHeader) ([]byte, error)
+}
+
+// Sign signs the block hash with the producer key, a HeaderSigner is given the header instead
+func (block *Block) Sign(signer utils.SignatureCreator) error {
+	var signature []byte
+	var err error
+	if headerSigner, ok := signer.(HeaderSigner); ok {
+		header := block.BlockHeader
+		header.Signature = nil
+		signature, err = headerSigner.SignHeader(header)
+	} else {
+		signature, err = signer.Sign(block.Hash())
+	}
+	if err != nil {
+		return err
+	}
+	block.Signature = signature
+	return nil
+}
+
+// CheckSignature verifies the embedded producer signature
+func (block Block) CheckSignature(validator utils.SignatureValidator) error {
+	if len(block.Signature) == 0 {
+		return errors.New("block is not signed")
+	}
+	return validator.CheckSignature(block.Hash(), block.Signature)
+}
+
+// isConsistent checks if the header matches the transactions of the block
+func (block Block) isConsistent() bool {
+	if block.Version == LegacyBlockVersion {
+		return len(block.Transactions) == 1
+	}
+	return bytes.Equal(block.MerkleRoot, MerkleRoot(block.Transactions))
+}
+
 // Blockchain is a chain of blocks
 type Blockchain []Block
 
-// AddBlock adds a block to the blockchain
-func (blockchain *Blockchain) AddBlock(data string) {
+// NextBlock creates an unsigned block with the specified transactions on top of the chain
+func (blockchain *Blockchain) NextBlock(transactions ...string) Block {
 	hash, blockHeight := []byte{0}, len(*blockchain)
 
 	if blockHeight > 0 {
 		hash = (*blockchain)[blockHeight-1].Hash()
 	}
 
-	*blockchain = append(*blockchain, Block{blockHeight, hash, data})
+	return NewBlock(blockHeight, hash, transactions...)
+}
+
+// AddBlock adds a block with the specified transactions to the blockchain
+func (blockchain *Blockchain) AddBlock(transactions ...string) {
+	blockchain.InsertBlock(blockchain.NextBlock(transactions...))
 }
 
 // AddBlockParams adds a block to the blockchain
 func (blockchain *Blockchain) AddBlockParams(params ...interface{}) {
-	hash, blockHeight := []byte{0}, len(*blockchain)
-
-	if blockHeight > 0 {
-		hash = (*blockchain)[blockHeight-1].Hash()
-	}
-
 	var buffer bytes.Buffer
 	for i, item := range params {
 		s, ok := item.(string)
 		if ok {
 			buffer.WriteString(s)
 		} else {
-			buffer.WriteString(string(i * 17))
+			buffer.WriteString(string(rune(i * 17)))
 		}
 		buffer.WriteString(";")
 	}
-	data := string(buffer.Bytes())
 
-	*blockchain = append(*blockchain, Block{blockHeight, hash, data})
+	blockchain.AddBlock(string(buffer.Bytes()))
 }
 
 //InsertBlock attempts to insert a block at the end of the blokchain. It doesn't check if the hash of the previous block is valid.
@@ -68,30 +176,39 @@ func (blockchain *Blockchain) InsertBlock(block Block) {
 	*blockchain = append(*blockchain, block)
 }
 
-// IsValid Checks if the blockchain is valid.
-func (blockchain *Blockchain) IsValid() bool {
-	blockHeight := len(*blockchain)
-	if blockHeight == 0 {
-		return true
+// IsValid Checks if the blockchain is valid. If a validator is specified the producer signatures of blocks are verified as well.
+func (blockchain *Blockchain) IsValid(validator utils.SignatureValidator) bool {
+	for i, block := range *blockchain {
+		prefix := (*blockchain)[:i]
+		if !prefix.IsValidNext(block, validator) {
+			return false
+		}
 	}
-	lastBlock := (*blockchain)[0]
+	return true
+}
 
-	// check if first block is valid
-	if len(lastBlock.PrevHash) != 1 || lastBlock.PrevHash[0] != 0 {
+// IsValidNext checks if the block can be appended at the top of the chain.
+// Blocks older than SignedBlockVersion carry no signature and are only accepted before the first signed block.
+func (blockchain *Blockchain) IsValidNext(block Block, validator utils.SignatureValidator) bool {
+	blockHeight := len(*blockchain)
+	if !block.isConsistent() {
 		return false
 	}
 
-	for i := 1; i < blockHeight; i++ {
-		nextBlock := (*blockchain)[i]
-		hash := lastBlock.Hash()
-		for j, item := range nextBlock.PrevHash {
-			if item != hash[j] {
-				return false
-			}
+	if blockHeight == 0 {
+		// check if first block is valid
+		if len(block.PrevHash) != 1 || block.PrevHash[0] != 0 {
+			return false
+		}
+	} else {
+		lastBlock := (*blockchain)[blockHeight-1]
+		if block.Version < lastBlock.Version || !bytes.Equal(block.PrevHash, lastBlock.Hash()) {
+			return false
 		}
-
-		lastBlock = nextBlock
 	}
 
+	if validator != nil && block.Version >= SignedBlockVersion {
+		return block.CheckSignature(validator) == nil
+	}
 	return true
 }
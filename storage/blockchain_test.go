@@ -1,6 +1,10 @@
 package storage
 
-import "testing"
+import (
+	"AdminBlockchain/utils"
+	"errors"
+	"testing"
+)
 
 func assertEq(t *testing.T, expected interface{}, actual interface{}) {
 	if expected != actual {
@@ -22,7 +26,7 @@ func TestAddBlock(t *testing.T) {
 	blockchain.AddBlock("hello")
 	lastBlock := blockchain[len(blockchain)-1]
 
-	assertEq(t, lastBlock.Data, "hello")
+	assertEq(t, lastBlock.Transactions[0], "hello")
 }
 
 // Check if the previous hash of first block is 0
@@ -52,7 +56,7 @@ func TestValidBlockchain(t *testing.T) {
 	blockchain.AddBlock("hello")
 	blockchain.AddBlock("data")
 
-	assertEq(t, blockchain.IsValid(), true)
+	assertEq(t, blockchain.IsValid(nil), true)
 }
 
 // Check if the previous hash is equal to the hash of previous block
@@ -61,26 +65,141 @@ func TestInvalidBlockchain(t *testing.T) {
 	blockchain.AddBlock("hello")
 	blockchain.AddBlock("data")
 
-	blockchain[len(blockchain)-2].Data = "fake"
+	blockchain[len(blockchain)-2].Transactions[0] = "fake"
 
-	assertEq(t, blockchain.IsValid(), false)
+	assertEq(t, blockchain.IsValid(nil), false)
 }
 
 func TestInsertOneBlock(t *testing.T) {
 	blockchain := Blockchain{}
-	var firstBlock = Block{0, []byte{0}, "first"}
+	var firstBlock = NewBlock(0, []byte{0}, "first")
 	blockchain.InsertBlock(firstBlock)
 
 	lastBlock := blockchain[len(blockchain)-1]
-	assertEq(t, lastBlock.Data, "first")
+	assertEq(t, lastBlock.Transactions[0], "first")
 }
 
 func TestInsertValidBlocks(t *testing.T) {
 	blockchain := Blockchain{}
-	var firstBlock = Block{1, []byte{0}, "first"}
+	var firstBlock = NewBlock(1, []byte{0}, "first")
 	blockchain.InsertBlock(firstBlock)
-	var secondBlock = Block{1, firstBlock.Hash(), "second"}
+	var secondBlock = NewBlock(1, firstBlock.Hash(), "second")
 	blockchain.InsertBlock(secondBlock)
 
-	assertEq(t, blockchain.IsValid(), true)
+	assertEq(t, blockchain.IsValid(nil), true)
+}
+
+// Check if a block can hold several transactions
+func TestAddMultiTransactionBlock(t *testing.T) {
+	blockchain := Blockchain{}
+	blockchain.AddBlock("first", "second", "third")
+	lastBlock := blockchain[len(blockchain)-1]
+
+	assertEq(t, 3, len(lastBlock.Transactions))
+	assertArrayEq(t, lastBlock.MerkleRoot, MerkleRoot([]string{"first", "second", "third"}))
+	assertEq(t, true, blockchain.IsValid(nil))
+}
+
+// Check if changing a transaction of the last block invalidates the chain
+func TestInvalidMerkleRoot(t *testing.T) {
+	blockchain := Blockchain{}
+	blockchain.AddBlock("hello", "data")
+
+	blockchain[0].Transactions[1] = "fake"
+
+	assertEq(t, false, blockchain.IsValid(nil))
+}
+
+// Check if blocks written before merkle roots were introduced are still valid
+func TestLegacyBlocks(t *testing.T) {
+	blockchain := Blockchain{}
+	first := Block{BlockHeader: BlockHeader{ID: 0, PrevHash: []byte{0}}, Transactions: []string{"first"}}
+	blockchain.InsertBlock(first)
+	second := Block{BlockHeader: BlockHeader{ID: 1, PrevHash: first.Hash()}, Transactions: []string{"second"}}
+	blockchain.InsertBlock(second)
+	blockchain.AddBlock("third", "fourth")
+
+	assertEq(t, true, blockchain.IsValid(nil))
+
+	blockchain[0].Transactions[0] = "fake"
+	assertEq(t, false, blockchain.IsValid(nil))
+}
+
+// testKey signs data with a shared secret
+type testKey struct {
+	secret string
+}
+
+func (key testKey) Sign(data []byte) ([]byte, error) {
+	return MerkleRoot([]string{key.secret, string(data)}), nil
+}
+
+func (key testKey) PublicKey() utils.SignatureValidator {
+	return key
+}
+
+func (key testKey) CheckSignature(data []byte, sig []byte) error {
+	expected, _ := key.Sign(data)
+	if string(expected) != string(sig) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+func (key testKey) Store() ([]byte, error) {
+	return []byte(key.secret), nil
+}
+
+func (key testKey) Algorithm() string {
+	return "test"
+}
+
+// Check if sealed blocks carry a valid producer signature
+func TestSignedBlocks(t *testing.T) {
+	blockchain := Blockchain{}
+	builder := BlockBuilder{Signer: testKey{"producer"}, Producer: "0x01"}
+	builder.AddTransaction("hello")
+	builder.Seal(&blockchain, nil)
+	builder.AddTransaction("data")
+	builder.Seal(&blockchain, nil)
+
+	lastBlock := blockchain[len(blockchain)-1]
+	assertEq(t, "0x01", lastBlock.Producer)
+	assertEq(t, nil, lastBlock.CheckSignature(testKey{"producer"}))
+	assertEq(t, true, blockchain.IsValid(testKey{"producer"}))
+	assertEq(t, false, blockchain.IsValid(testKey{"other"}))
+}
+
+// Check if changing the producer or timestamp invalidates the signature
+func TestForgedBlockHeader(t *testing.T) {
+	blockchain := Blockchain{}
+	builder := BlockBuilder{Signer: testKey{"producer"}, Producer: "0x01"}
+	builder.AddTransaction("hello")
+	builder.Seal(&blockchain, nil)
+
+	blockchain[0].Producer = "0x02"
+	assertEq(t, false, blockchain.IsValid(testKey{"producer"}))
+
+	blockchain[0].Producer = "0x01"
+	blockchain[0].Timestamp++
+	assertEq(t, false, blockchain.IsValid(testKey{"producer"}))
+}
+
+// Check if unsigned blocks are rejected when a validator is configured
+func TestUnsignedBlocks(t *testing.T) {
+	blockchain := Blockchain{}
+	blockchain.AddBlock("hello")
+
+	assertEq(t, true, blockchain.IsValid(nil))
+	assertEq(t, false, blockchain.IsValid(testKey{"producer"}))
+}
+
+// Check if a legacy block can't follow a signed block
+func TestLegacyAfterSignedBlock(t *testing.T) {
+	blockchain := Blockchain{}
+	blockchain.AddBlock("hello")
+	legacy := Block{BlockHeader: BlockHeader{ID: 1, PrevHash: blockchain[0].Hash()}, Transactions: []string{"data"}}
+	blockchain.InsertBlock(legacy)
+
+	assertEq(t, false, blockchain.IsValid(nil))
 }
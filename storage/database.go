@@ -1,68 +1,434 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"log"
+	"strings"
 	"sync"
+)
+
+// sqliteDriver name of the cgo sqlite driver, registered in sqlite.go
+const sqliteDriver = "sqlite3"
 
-	//blank import
-	_ "github.com/mattn/go-sqlite3"
+// Errors returned by the database wrapper
+var (
+	// ErrNotOpen the database is not open or was closed
+	ErrNotOpen = errors.New("database not loaded")
+	// ErrTxDone the transaction was already committed or rolled back
+	ErrTxDone = errors.New("transaction already finished")
 )
 
-// Database convinient wrapper for accessing sql DB
+// StatementError is returned when the database fails to run a statement
+type StatementError struct {
+	Statement string
+	Err       error
+}
+
+func (err *StatementError) Error() string {
+	return fmt.Sprintf("%v (in statement: %s)", err.Err, err.Statement)
+}
+
+// Unwrap returns the driver error
+func (err *StatementError) Unwrap() error {
+	return err.Err
+}
+
+// Database convinient wrapper for accessing sql DB. Queries share a read lock, statements and transactions hold
+// the write lock until they finish.
 type Database struct {
 	database *sql.DB
-	mutex    *sync.Mutex
+	mutex    *contextLock
+}
+
+// contextLock a read/write lock which can be acquired under a context, a caller whose context is done stops waiting.
+// The write token is held by a writer or by the readers as a group, the reader count is passed around in its channel.
+type contextLock struct {
+	write   chan struct{}
+	readers chan int
+}
+
+func newContextLock() *contextLock {
+	lock := &contextLock{write: make(chan struct{}, 1), readers: make(chan int, 1)}
+	lock.readers <- 0
+	return lock
+}
+
+// Lock waits for the write lock until the context is done
+func (lock *contextLock) Lock(ctx context.Context) error {
+	select {
+	case lock.write <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Unlock releases the write lock
+func (lock *contextLock) Unlock() {
+	<-lock.write
+}
+
+// RLock waits for a read lock until the context is done, the first reader takes the write token for all readers
+func (lock *contextLock) RLock(ctx context.Context) error {
+	var count int
+	select {
+	case count = <-lock.readers:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if count == 0 {
+		select {
+		case lock.write <- struct{}{}:
+		case <-ctx.Done():
+			lock.readers <- count
+			return ctx.Err()
+		}
+	}
+	lock.readers <- count + 1
+	return nil
+}
+
+// RUnlock releases a read lock, the last reader returns the write token
+func (lock *contextLock) RUnlock() {
+	count := <-lock.readers - 1
+	if count == 0 {
+		<-lock.write
+	}
+	lock.readers <- count
 }
 
-// OpenDb opens a specified database
+// OpenDb opens a specified sqlite database file
 func (db *Database) OpenDb(path string) {
-	database, err := sql.Open("sqlite3", path)
+	err := db.open(sqliteDriver, path)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	database.Exec("PRAGMA journal_mode=WAL;")
+	db.database.Exec("PRAGMA journal_mode=WAL;")
+}
+
+func (db *Database) open(driver string, dataSource string) error {
+	database, err := sql.Open(driver, dataSource)
+	if err != nil {
+		return err
+	}
 
 	db.database = database
-	db.mutex = &sync.Mutex{}
+	db.mutex = newContextLock()
+	return nil
 }
 
-// Close closes the database connection
+// Close closes the database connection. Waits until open rows and transactions are finished.
 func (db *Database) Close() {
-	db.mutex.Lock()
-	db.database.Close()
+	if db.mutex == nil {
+		return
+	}
+	db.mutex.Lock(context.Background())
+	if db.database != nil {
+		db.database.Close()
+		db.database = nil
+	}
 	db.mutex.Unlock()
 }
 
 // IsOpen returns true if the database connection has been established
 func (db *Database) IsOpen() bool {
+	if db.mutex == nil {
+		return false
+	}
+	db.mutex.RLock(context.Background())
+	defer db.mutex.RUnlock()
 	return db.database != nil
 }
 
+// lock acquires the write lock, or the read lock if shared is set. Fails if the database is not open
+// or the context is done before the lock is acquired.
+func (db *Database) lock(ctx context.Context, shared bool) (func(), error) {
+	if db.mutex == nil {
+		return nil, ErrNotOpen
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var err error
+	unlock := db.mutex.Unlock
+	if shared {
+		err = db.mutex.RLock(ctx)
+		unlock = db.mutex.RUnlock
+	} else {
+		err = db.mutex.Lock(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if db.database == nil {
+		unlock()
+		return nil, ErrNotOpen
+	}
+	return unlock, nil
+}
+
 // Transact performs a transaction on the database
 func (db *Database) Transact(statement string, params ...interface{}) (int64, error) {
-	if !db.IsOpen() {
-		return -1, errors.New("database not loaded")
-	}
-	db.mutex.Lock()
-	res, err := db.database.Exec(statement, params...)
+	return db.TransactContext(context.Background(), statement, params...)
+}
+
+// TransactContext performs a transaction on the database, the statement is aborted when the context is done
+func (db *Database) TransactContext(ctx context.Context, statement string, params ...interface{}) (int64, error) {
+	unlock, err := db.lock(ctx, false)
 	if err != nil {
 		return -1, err
 	}
-	last, err := res.LastInsertId()
-	db.mutex.Unlock()
-	return last, err
+	defer unlock()
+
+	return exec(ctx, db.database, statement, params...)
 }
 
 // Query performs a query on the database
-func (db *Database) Query(query string, params ...interface{}) (*sql.Rows, error) {
-	if db.database == nil {
-		return nil, errors.New("database not loaded")
+func (db *Database) Query(query string, params ...interface{}) (*Rows, error) {
+	return db.QueryContext(context.Background(), query, params...)
+}
+
+// QueryContext performs a query on the database. The read lock is held until the rows are closed,
+// the rows must not be kept open while writing to the same database.
+func (db *Database) QueryContext(ctx context.Context, query string, params ...interface{}) (*Rows, error) {
+	unlock, err := db.lock(ctx, true)
+	if err != nil {
+		return nil, err
 	}
-	db.mutex.Lock()
-	rows, err := db.database.Query(query, params...)
-	db.mutex.Unlock()
-	return rows, err
+
+	rows, err := db.database.QueryContext(ctx, query, params...)
+	if err != nil {
+		unlock()
+		return nil, &StatementError{Statement: query, Err: err}
+	}
+	return &Rows{Rows: rows, unlock: unlock}, nil
+}
+
+// execer runs statements on a database or a transaction
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func exec(ctx context.Context, db execer, statement string, params ...interface{}) (int64, error) {
+	res, err := db.ExecContext(ctx, statement, params...)
+	if err != nil {
+		return -1, &StatementError{Statement: statement, Err: err}
+	}
+	return res.LastInsertId()
+}
+
+// Rows is the result of a query, it holds the lock of the database until it is closed
+type Rows struct {
+	*sql.Rows
+	unlock func()
+	once   sync.Once
+}
+
+// Close closes the rows and releases the database lock. Safe to call on nil rows and more than once.
+func (rows *Rows) Close() error {
+	if rows == nil || rows.Rows == nil {
+		return nil
+	}
+	err := rows.Rows.Close()
+	if rows.unlock != nil {
+		rows.once.Do(rows.unlock)
+	}
+	return err
+}
+
+// Tx is a database transaction. It holds the database write lock until it is committed or rolled back.
+type Tx struct {
+	tx     *sql.Tx
+	unlock func()
+	ctx    context.Context
+	done   bool
+}
+
+// Begin starts a transaction on the database
+func (db *Database) Begin() (*Tx, error) {
+	return db.BeginContext(context.Background())
+}
+
+// BeginContext starts a transaction on the database. The transaction is rolled back if the context is done before it is committed.
+func (db *Database) BeginContext(ctx context.Context) (*Tx, error) {
+	unlock, err := db.lock(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := db.database.BeginTx(ctx, nil)
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+	return &Tx{tx: tx, unlock: unlock, ctx: ctx}, nil
+}
+
+// Transact performs a statement within the transaction
+func (tx *Tx) Transact(statement string, params ...interface{}) (int64, error) {
+	if tx.done {
+		return -1, ErrTxDone
+	}
+	return exec(tx.ctx, tx.tx, statement, params...)
+}
+
+// Query performs a query within the transaction, it sees all changes made by the transaction
+func (tx *Tx) Query(query string, params ...interface{}) (*Rows, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+	rows, err := tx.tx.QueryContext(tx.ctx, query, params...)
+	if err != nil {
+		return nil, &StatementError{Statement: query, Err: err}
+	}
+	return &Rows{Rows: rows}, nil
+}
+
+// Commit commits the transaction and releases the database lock
+func (tx *Tx) Commit() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+	defer tx.unlock()
+	return tx.tx.Commit()
+}
+
+// Rollback discards all changes of the transaction and releases the database lock. Does nothing if the transaction is already finished.
+func (tx *Tx) Rollback() error {
+	if tx.done {
+		return nil
+	}
+	tx.done = true
+	defer tx.unlock()
+	err := tx.tx.Rollback()
+	if err == sql.ErrTxDone {
+		// already rolled back because the context is done
+		return nil
+	}
+	return err
+}
+
+// ensureColumn adds a column to an existing table if it is missing
+func (db *Database) ensureColumn(table string, column string, definition string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+
+	var cid, notNull, pk int
+	var name, columnType string
+	var defaultValue interface{}
+	found := false
+	for rows.Next() {
+		err = rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &pk)
+		if err == nil && name == column {
+			found = true
+		}
+	}
+	rows.Close()
+
+	if found {
+		return nil
+	}
+	_, err = db.Transact(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// CopyInMemory copies the tables and indexes of the database into target, which is opened as a new in-memory database.
+// Row ids are kept, so the copy behaves like the original for statements referring to them.
+func (db *Database) CopyInMemory(target *Database) error {
+	source, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer source.Rollback()
+
+	target.Close()
+	err = target.open(memoryDriver, ":memory:")
+	if err != nil {
+		return err
+	}
+	// every connection to :memory: is a separate database
+	target.database.SetMaxOpenConns(1)
+
+	rows, err := source.Query("SELECT type, name, sql FROM sqlite_master WHERE sql IS NOT NULL AND name NOT LIKE 'sqlite_%' ORDER BY type DESC")
+	if err != nil {
+		return err
+	}
+	var tables []string
+	var statements []string
+	for rows.Next() {
+		var kind, name, statement string
+		err = rows.Scan(&kind, &name, &statement)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		if kind == "table" {
+			tables = append(tables, name)
+		}
+		statements = append(statements, statement)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return rows.Err()
+	}
+
+	tx, err := target.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, statement := range statements {
+		_, err = tx.Transact(statement)
+		if err != nil {
+			return err
+		}
+	}
+	for _, table := range tables {
+		err = copyTable(source, tx, table)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// copyTable copies the rows of a table including their row ids
+func copyTable(source *Tx, target *Tx, table string) error {
+	rows, err := source.Query(fmt.Sprintf("SELECT rowid, * FROM %s", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	columns[0] = "rowid"
+	statement := fmt.Sprintf("INSERT INTO %s (%s) VALUES (?%s)",
+		table, strings.Join(columns, ", "), strings.Repeat(", ?", len(columns)-1))
+
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		err = rows.Scan(pointers...)
+		if err != nil {
+			return err
+		}
+		_, err = target.Transact(statement, values...)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
 }
@@ -0,0 +1,249 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func openTestDb(t *testing.T) *Database {
+	var db Database
+	err := MemoryBackend{}.OpenStateDb(&db, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Transact("CREATE TABLE Items (worker int, value int)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &db
+}
+
+func countItems(t *testing.T, db queryer) int {
+	rows, err := db.Query("SELECT COUNT(*) FROM Items")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var count int
+	rows.Next()
+	rows.Scan(&count)
+	return count
+}
+
+// Check if a failing statement releases the lock and reports the statement
+func TestDatabaseStatementError(t *testing.T) {
+	db := openTestDb(t)
+	defer db.Close()
+
+	_, err := db.Transact("INSERT INTO Missing VALUES (1)")
+	var statementErr *StatementError
+	assertEq(t, true, errors.As(err, &statementErr))
+	assertEq(t, "INSERT INTO Missing VALUES (1)", statementErr.Statement)
+
+	_, err = db.Query("SELECT * FROM Missing")
+	assertEq(t, true, errors.As(err, &statementErr))
+
+	// the database must still be usable
+	_, err = db.Transact("INSERT INTO Items VALUES (0, 1)")
+	assertEq(t, nil, err)
+	assertEq(t, 1, countItems(t, db))
+}
+
+// Check if a closed database rejects all operations
+func TestDatabaseClosed(t *testing.T) {
+	db := openTestDb(t)
+	db.Close()
+
+	assertEq(t, false, db.IsOpen())
+	_, err := db.Transact("INSERT INTO Items VALUES (0, 1)")
+	assertEq(t, ErrNotOpen, err)
+	_, err = db.Query("SELECT * FROM Items")
+	assertEq(t, ErrNotOpen, err)
+	_, err = db.Begin()
+	assertEq(t, ErrNotOpen, err)
+
+	var empty Database
+	_, err = empty.Transact("SELECT 1")
+	assertEq(t, ErrNotOpen, err)
+}
+
+// Check if a cancelled context aborts operations
+func TestDatabaseContextCancelled(t *testing.T) {
+	db := openTestDb(t)
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := db.TransactContext(ctx, "INSERT INTO Items VALUES (0, 1)")
+	assertEq(t, true, errors.Is(err, context.Canceled))
+	_, err = db.QueryContext(ctx, "SELECT * FROM Items")
+	assertEq(t, true, errors.Is(err, context.Canceled))
+	assertEq(t, 0, countItems(t, db))
+}
+
+// Check if open rows keep writers waiting until they are closed
+func TestDatabaseRowsHoldLock(t *testing.T) {
+	db := openTestDb(t)
+	defer db.Close()
+
+	rows, err := db.Query("SELECT * FROM Items")
+	assertEq(t, nil, err)
+
+	written := make(chan error)
+	go func() {
+		_, err := db.Transact("INSERT INTO Items VALUES (0, 1)")
+		written <- err
+	}()
+
+	select {
+	case <-written:
+		t.Error("statement ran while rows were open")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	rows.Close()
+	rows.Close()
+	assertEq(t, nil, <-written)
+}
+
+// Check if callers waiting for the lock give up once their context is done
+func TestDatabaseLockContext(t *testing.T) {
+	db := openTestDb(t)
+	defer db.Close()
+
+	tx, err := db.Begin()
+	assertEq(t, nil, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = db.QueryContext(ctx, "SELECT * FROM Items")
+	assertEq(t, true, errors.Is(err, context.DeadlineExceeded))
+	_, err = db.TransactContext(ctx, "INSERT INTO Items VALUES (0, 1)")
+	assertEq(t, true, errors.Is(err, context.DeadlineExceeded))
+	_, err = db.BeginContext(ctx)
+	assertEq(t, true, errors.Is(err, context.DeadlineExceeded))
+
+	// the abandoned waits must not hold the lock
+	assertEq(t, nil, tx.Rollback())
+	rows, err := db.Query("SELECT * FROM Items")
+	assertEq(t, nil, err)
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = db.TransactContext(ctx, "INSERT INTO Items VALUES (0, 1)")
+	assertEq(t, true, errors.Is(err, context.DeadlineExceeded))
+	rows.Close()
+	assertEq(t, 0, countItems(t, db))
+	_, err = db.Transact("INSERT INTO Items VALUES (0, 1)")
+	assertEq(t, nil, err)
+}
+
+// Check if a transaction finished twice reports it
+func TestDatabaseTxDone(t *testing.T) {
+	db := openTestDb(t)
+	defer db.Close()
+
+	tx, err := db.Begin()
+	assertEq(t, nil, err)
+	_, err = tx.Transact("INSERT INTO Items VALUES (0, 1)")
+	assertEq(t, nil, err)
+	assertEq(t, 1, countItems(t, tx))
+	assertEq(t, nil, tx.Commit())
+
+	assertEq(t, ErrTxDone, tx.Commit())
+	assertEq(t, nil, tx.Rollback())
+	_, err = tx.Transact("INSERT INTO Items VALUES (0, 1)")
+	assertEq(t, ErrTxDone, err)
+	assertEq(t, 1, countItems(t, db))
+}
+
+// Check if concurrent statements, queries and transactions neither deadlock nor lose writes
+func TestDatabaseConcurrentAccess(t *testing.T) {
+	db := openTestDb(t)
+	defer db.Close()
+
+	const workers = 16
+	const iterations = 50
+	var wait sync.WaitGroup
+	for worker := 0; worker < workers; worker++ {
+		wait.Add(1)
+		go func(worker int) {
+			defer wait.Done()
+			for i := 0; i < iterations; i++ {
+				switch i % 4 {
+				case 0:
+					_, err := db.Transact("INSERT INTO Items VALUES (?, ?)", worker, i)
+					if err != nil {
+						t.Error(err)
+					}
+				case 1:
+					db.Transact("INSERT INTO Missing VALUES (?)", i)
+				case 2:
+					tx, err := db.Begin()
+					if err != nil {
+						t.Error(err)
+						continue
+					}
+					tx.Transact("INSERT INTO Items VALUES (?, ?)", worker, i)
+					if worker%2 == 0 {
+						tx.Commit()
+					} else {
+						tx.Rollback()
+					}
+				case 3:
+					rows, err := db.Query("SELECT worker, value FROM Items WHERE worker=?", worker)
+					if err != nil {
+						t.Error(err)
+						continue
+					}
+					for rows.Next() {
+					}
+					rows.Close()
+				}
+			}
+		}(worker)
+	}
+	wait.Wait()
+
+	// every worker inserts once per 4 iterations, even workers commit their transactions as well
+	perWorker := (iterations + 3) / 4
+	assertEq(t, workers*perWorker+workers/2*((iterations+1)/4), countItems(t, db))
+}
+
+// Check if an in-memory copy keeps the rows, their ids and the indexes, and is independent of the original
+func TestDatabaseCopyInMemory(t *testing.T) {
+	db := openTestDb(t)
+	defer db.Close()
+	_, err := db.Transact("CREATE UNIQUE INDEX ItemWorkers ON Items (worker)")
+	assertEq(t, nil, err)
+	for i := 0; i < 3; i++ {
+		_, err = db.Transact("INSERT INTO Items VALUES (?, ?)", i, i*10)
+		assertEq(t, nil, err)
+	}
+	_, err = db.Transact("DELETE FROM Items WHERE worker=0")
+	assertEq(t, nil, err)
+
+	var copied Database
+	assertEq(t, nil, db.CopyInMemory(&copied))
+	defer copied.Close()
+	assertEq(t, 2, countItems(t, &copied))
+
+	rows, err := copied.Query("SELECT rowid, value FROM Items WHERE worker=2")
+	assertEq(t, nil, err)
+	var id, value int
+	assertEq(t, true, rows.Next())
+	assertEq(t, nil, rows.Scan(&id, &value))
+	rows.Close()
+	assertEq(t, 3, id)
+	assertEq(t, 20, value)
+
+	_, err = copied.Transact("INSERT INTO Items VALUES (1, 0)")
+	assertEq(t, false, err == nil)
+	_, err = copied.Transact("INSERT INTO Items VALUES (5, 0)")
+	assertEq(t, nil, err)
+	assertEq(t, 3, countItems(t, &copied))
+	assertEq(t, 2, countItems(t, db))
+}
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// headerMagic marks the canonical header encoding, so it can't be confused with other hashed data
+var headerMagic = []byte("ABCH")
+
+// signingMagic marks signing payloads, so a signature can't be confused with other signed data
+var signingMagic = []byte("ABSP")
+
+// Encode returns the canonical binary encoding of the header used for hashing.
+// Integers are fixed width big endian and variable length fields are prefixed with their length.
+// The signature is not encoded, as it is computed over the encoding.
+func (header BlockHeader) Encode() []byte {
+	var buffer bytes.Buffer
+	buffer.Write(headerMagic)
+	writeUint(&buffer, uint64(header.Version))
+	writeUint(&buffer, uint64(header.ID))
+	writeBytes(&buffer, header.PrevHash)
+	writeBytes(&buffer, header.MerkleRoot)
+	if header.Version >= StateRootBlockVersion {
+		writeBytes(&buffer, header.StateRoot)
+	}
+	writeUint(&buffer, uint64(header.Timestamp))
+	writeBytes(&buffer, []byte(header.Producer))
+	return buffer.Bytes()
+}
+
+// SigningPayload returns the canonical encoding of the fields of a signed client request. The chain id and the rpc method
+// are encoded first, so a signature is only valid for a single method of a single chain.
+// Each field is encoded with its type tag, integers and floats as fixed width big endian, strings and binary data
+// prefixed with their length. Fields are converted like statement parameters, so int and int64 encode the same.
+func SigningPayload(chainID string, method string, fields ...interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.Write(signingMagic)
+	writeBytes(&buffer, []byte(chainID))
+	writeBytes(&buffer, []byte(method))
+	writeUint(&buffer, uint64(len(fields)))
+	for i, field := range fields {
+		value, err := driver.DefaultParameterConverter.ConvertValue(field)
+		if err != nil {
+			return nil, fmt.Errorf("field %d: %v", i, err)
+		}
+
+		switch v := value.(type) {
+		case nil:
+			buffer.WriteByte(tagNull)
+		case int64:
+			buffer.WriteByte(tagInt)
+			writeUint(&buffer, uint64(v))
+		case float64:
+			buffer.WriteByte(tagFloat)
+			writeUint(&buffer, math.Float64bits(v))
+		case bool:
+			buffer.WriteByte(tagBool)
+			if v {
+				buffer.WriteByte(1)
+			} else {
+				buffer.WriteByte(0)
+			}
+		case string:
+			buffer.WriteByte(tagString)
+			writeBytes(&buffer, []byte(v))
+		case []byte:
+			buffer.WriteByte(tagBytes)
+			writeBytes(&buffer, v)
+		default:
+			return nil, fmt.Errorf("field %d: unsupported type %T", i, value)
+		}
+	}
+	return buffer.Bytes(), nil
+}
+
+func writeUint(buffer *bytes.Buffer, value uint64) {
+	var data [8]byte
+	binary.BigEndian.PutUint64(data[:], value)
+	buffer.Write(data[:])
+}
+
+func writeBytes(buffer *bytes.Buffer, data []byte) {
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(data)))
+	buffer.Write(length[:])
+	buffer.Write(data)
+}
@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// Check if ids outside of the unicode range produce different hashes
+func TestHashLargeIDs(t *testing.T) {
+	first := NewBlock(0x110000, []byte{1}, "data")
+	second := first
+	second.ID = 0x110001
+
+	assertEq(t, false, bytes.Equal(first.Hash(), second.Hash()))
+}
+
+// Check if moving bytes between fields changes the hash
+func TestHashFieldBoundaries(t *testing.T) {
+	first := NewBlock(1, []byte{1, 2}, "data")
+	first.Producer = "ab"
+	second := first
+	second.PrevHash = []byte{1}
+	second.MerkleRoot = append([]byte{2}, first.MerkleRoot...)
+
+	assertEq(t, false, bytes.Equal(first.Hash(), second.Hash()))
+
+	third := first
+	third.Timestamp = first.Timestamp + 1
+	assertEq(t, false, bytes.Equal(first.Hash(), third.Hash()))
+}
+
+// Check if the encoding is stable for the same header
+func TestHeaderEncoding(t *testing.T) {
+	header := BlockHeader{Version: CanonicalBlockVersion, ID: 2, PrevHash: []byte{1}, MerkleRoot: []byte{2}, Timestamp: 3, Producer: "p"}
+	encoded := header.Encode()
+
+	assertEq(t, 4+8+8+4+1+4+1+8+4+1, len(encoded))
+	assertArrayEq(t, encoded[:4], []byte("ABCH"))
+	header.Signature = []byte{1, 2, 3}
+	assertEq(t, true, bytes.Equal(encoded, header.Encode()))
+}
+
+// Check if a legacy chain can be rehashed with the current block version
+func TestMigrateChain(t *testing.T) {
+	legacy := Blockchain{}
+	first := Block{BlockHeader: BlockHeader{ID: 0, PrevHash: []byte{0}}, Transactions: []string{"first"}}
+	legacy.InsertBlock(first)
+	second := Block{BlockHeader: BlockHeader{ID: 1, PrevHash: first.Hash()}, Transactions: []string{"second"}}
+	legacy.InsertBlock(second)
+
+	migrated, err := MigrateChain(legacy, testKey{"producer"}, "0x01")
+	assertEq(t, nil, err)
+	assertEq(t, 2, len(migrated))
+	assertEq(t, true, migrated.IsValid(testKey{"producer"}))
+	for i, block := range migrated {
+		assertEq(t, CanonicalBlockVersion, block.Version)
+		assertEq(t, "0x01", block.Producer)
+		assertEq(t, legacy[i].Transactions[0], block.Transactions[0])
+	}
+}
+
+// Check if the state root is committed by the hash of current blocks
+func TestHashStateRoot(t *testing.T) {
+	first := NewBlock(1, []byte{1}, "data")
+	first.StateRoot = []byte{1}
+	second := first
+	second.StateRoot = []byte{2}
+
+	assertEq(t, false, bytes.Equal(first.Hash(), second.Hash()))
+}
+
+// Check the signing payload against fixed vectors, clients in other languages must produce the same bytes
+func TestSigningPayloadVectors(t *testing.T) {
+	vectors := []struct {
+		chainID  string
+		method   string
+		fields   []interface{}
+		expected string
+	}{
+		{"chain", "AccountHandler.CreateAccount", []interface{}{"account.create", uint64(1), "user", 0, []byte{1, 2}},
+			"41425350" + "00000005" + "636861696e" + "0000001c" + "4163636f756e7448616e646c65722e4372656174654163636f756e74" +
+				"0000000000000005" + "73" + "0000000e" + "6163636f756e742e637265617465" + "69" + "0000000000000001" +
+				"73" + "00000004" + "75736572" + "69" + "0000000000000000" + "62" + "00000002" + "0102"},
+		{"c", "m", []interface{}{true, nil, 1.5, int64(-1)},
+			"41425350" + "00000001" + "63" + "00000001" + "6d" + "0000000000000004" +
+				"74" + "01" + "6e" + "66" + "3ff8000000000000" + "69" + "ffffffffffffffff"},
+	}
+	for _, vector := range vectors {
+		payload, err := SigningPayload(vector.chainID, vector.method, vector.fields...)
+		assertEq(t, nil, err)
+		assertEq(t, vector.expected, hex.EncodeToString(payload))
+	}
+}
+
+// Check if moving bytes between fields, the chain id or the method changes the signing payload
+func TestSigningPayloadBoundaries(t *testing.T) {
+	first, _ := SigningPayload("chain", "method", "ab", "c")
+	second, _ := SigningPayload("chain", "method", "a", "bc")
+	assertEq(t, false, bytes.Equal(first, second))
+
+	third, _ := SigningPayload("chainmethod", "", "ab", "c")
+	assertEq(t, false, bytes.Equal(first, third))
+
+	number, _ := SigningPayload("chain", "method", 12)
+	text, _ := SigningPayload("chain", "method", "12")
+	assertEq(t, false, bytes.Equal(number, text))
+}
+
+// Check if integer types and named string types encode like the values stored in requests
+func TestSigningPayloadTypes(t *testing.T) {
+	type name string
+	first, _ := SigningPayload("chain", "method", 1, name("a"))
+	second, _ := SigningPayload("chain", "method", int64(1), "a")
+	assertEq(t, true, bytes.Equal(first, second))
+
+	_, err := SigningPayload("chain", "method", uint64(1<<63))
+	assertEq(t, true, err != nil)
+	_, err = SigningPayload("chain", "method", struct{}{})
+	assertEq(t, true, err != nil)
+}
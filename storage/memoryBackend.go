@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"sync"
+
+	//blank import, registers the pure go sqlite driver
+	_ "modernc.org/sqlite"
+)
+
+// memoryDriver name of the pure go sqlite driver
+const memoryDriver = "sqlite"
+
+// MemoryBackend keeps the chain and the state in memory. It doesn't need cgo or files,
+// which makes it usable for tests and ephemeral nodes. Everything is lost when the node stops.
+type MemoryBackend struct{}
+
+// OpenChainStore creates an empty chain store
+func (MemoryBackend) OpenChainStore(dir string) (ChainStore, error) {
+	return &memoryChainStore{}, nil
+}
+
+// OpenStateDb creates an empty in-memory state database
+func (MemoryBackend) OpenStateDb(db *Database, dir string, reset bool) error {
+	err := db.open(memoryDriver, ":memory:")
+	if err != nil {
+		return err
+	}
+	// every connection to :memory: is a separate database
+	db.database.SetMaxOpenConns(1)
+	return nil
+}
+
+// Persistent returns false, nothing survives a restart
+func (MemoryBackend) Persistent() bool {
+	return false
+}
+
+// memoryChainStore keeps the blocks in a slice
+type memoryChainStore struct {
+	chain      Blockchain
+	version    int
+	hasVersion bool
+	mutex      sync.Mutex
+}
+
+func (store *memoryChainStore) LoadBlocks() (Blockchain, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	return append(Blockchain{}, store.chain...), nil
+}
+
+func (store *memoryChainStore) Height() (int, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	return len(store.chain), nil
+}
+
+func (store *memoryChainStore) AppendBlock(block Block) error {
+	store.mutex.Lock()
+	store.chain.InsertBlock(block)
+	store.mutex.Unlock()
+	return nil
+}
+
+func (store *memoryChainStore) RemoveBlocks(height int) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if height < len(store.chain) {
+		store.chain = store.chain[:height]
+	}
+	return nil
+}
+
+func (store *memoryChainStore) ReplaceBlocks(chain Blockchain) error {
+	store.mutex.Lock()
+	store.chain = append(Blockchain{}, chain...)
+	store.mutex.Unlock()
+	return nil
+}
+
+func (store *memoryChainStore) Version() (int, bool, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	return store.version, store.hasVersion, nil
+}
+
+func (store *memoryChainStore) SetVersion(version int) error {
+	store.mutex.Lock()
+	store.version, store.hasVersion = version, true
+	store.mutex.Unlock()
+	return nil
+}
+
+func (store *memoryChainStore) Close() error {
+	return nil
+}
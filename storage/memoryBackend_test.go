@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"testing"
+)
+
+// Check if the memory chain store keeps blocks in order and supports truncating them
+func TestMemoryChainStore(t *testing.T) {
+	var chain Blockchain
+	chain.AddBlock("first")
+	chain.AddBlock("second")
+	chain.AddBlock("third")
+
+	store, err := MemoryBackend{}.OpenChainStore("")
+	assertEq(t, nil, err)
+	for _, block := range chain {
+		assertEq(t, nil, store.AppendBlock(block))
+	}
+
+	height, err := store.Height()
+	assertEq(t, nil, err)
+	assertEq(t, 3, height)
+
+	assertEq(t, nil, store.RemoveBlocks(2))
+	loaded, err := store.LoadBlocks()
+	assertEq(t, nil, err)
+	assertEq(t, 2, len(loaded))
+	assertEq(t, true, loaded.IsValid(nil))
+	assertEq(t, "second", loaded[1].Transactions[0])
+
+	assertEq(t, nil, store.ReplaceBlocks(chain[:1]))
+	height, _ = store.Height()
+	assertEq(t, 1, height)
+}
+
+// Check if the chain version marker is only reported once it was set
+func TestMemoryChainStoreVersion(t *testing.T) {
+	store, _ := MemoryBackend{}.OpenChainStore("")
+	_, found, err := store.Version()
+	assertEq(t, nil, err)
+	assertEq(t, false, found)
+
+	assertEq(t, nil, store.SetVersion(CurrentBlockVersion))
+	version, found, _ := store.Version()
+	assertEq(t, true, found)
+	assertEq(t, CurrentBlockVersion, version)
+}
+
+// Check if backends are selected by their configuration name
+func TestBackendByName(t *testing.T) {
+	backend, err := BackendByName(MemoryBackendName)
+	assertEq(t, nil, err)
+	assertEq(t, false, backend.Persistent())
+
+	backend, err = BackendByName(SQLiteBackendName)
+	assertEq(t, nil, err)
+	assertEq(t, true, backend.Persistent())
+
+	_, err = BackendByName("unknown")
+	assertEq(t, true, err != nil)
+}
@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"crypto/sha256"
+)
+
+// Prefixes separating leaf hashes from inner node hashes, so a node can't be passed off as a transaction
+const (
+	merkleLeafPrefix = 0x00
+	merkleNodePrefix = 0x01
+)
+
+// MerkleRoot computes the root of a merkle tree built over the transactions.
+// A node without a sibling is promoted to the next level unchanged.
+func MerkleRoot(transactions []string) []byte {
+	if len(transactions) == 0 {
+		hash := sha256.Sum256(nil)
+		return hash[:]
+	}
+
+	level := make([][]byte, len(transactions))
+	for i, tx := range transactions {
+		hash := sha256.New()
+		hash.Write([]byte{merkleLeafPrefix})
+		hash.Write([]byte(tx))
+		level[i] = hash.Sum(nil)
+	}
+
+	for len(level) > 1 {
+		var next [][]byte
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			hash := sha256.New()
+			hash.Write([]byte{merkleNodePrefix})
+			hash.Write(level[i])
+			hash.Write(level[i+1])
+			next = append(next, hash.Sum(nil))
+		}
+		level = next
+	}
+	return level[0]
+}
@@ -0,0 +1,27 @@
+package storage
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Check if the root depends on every transaction and on their order
+func TestMerkleRoot(t *testing.T) {
+	root := MerkleRoot([]string{"a", "b", "c"})
+
+	assertEq(t, true, bytes.Equal(root, MerkleRoot([]string{"a", "b", "c"})))
+	assertEq(t, false, bytes.Equal(root, MerkleRoot([]string{"b", "a", "c"})))
+	assertEq(t, false, bytes.Equal(root, MerkleRoot([]string{"a", "b", "d"})))
+	assertEq(t, false, bytes.Equal(root, MerkleRoot([]string{"a", "b"})))
+}
+
+// Check if a duplicated last transaction doesn't produce the same root
+func TestMerkleRootOddLeaves(t *testing.T) {
+	assertEq(t, false, bytes.Equal(MerkleRoot([]string{"a", "b", "c"}), MerkleRoot([]string{"a", "b", "c", "c"})))
+}
+
+// Check if a single transaction is not its own root
+func TestMerkleRootSingle(t *testing.T) {
+	assertEq(t, 32, len(MerkleRoot([]string{"a"})))
+	assertEq(t, 32, len(MerkleRoot(nil)))
+}
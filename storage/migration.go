@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"AdminBlockchain/utils"
+)
+
+// MigrateChain rebuilds the chain with the canonical block version. Transactions, timestamps and producers are kept,
+// hashes are recomputed and every block is signed again, as the old signatures don't cover the new hashes.
+// Blocks without a producer are attributed to the migrating signer. Blocks already using the canonical hashing are
+// kept as they are, only their links are updated.
+func MigrateChain(chain Blockchain, signer utils.SignatureCreator, producer string) (Blockchain, error) {
+	var migrated Blockchain
+	for _, block := range chain {
+		next := migrated.NextBlock(block.Transactions...)
+		// state roots can't be computed without replaying the chain, older blocks don't commit to a state
+		next.Version = block.Version
+		if next.Version < CanonicalBlockVersion {
+			next.Version = CanonicalBlockVersion
+		}
+		next.StateRoot = block.StateRoot
+		next.Timestamp = block.Timestamp
+		next.Producer = block.Producer
+		if next.Producer == "" {
+			next.Producer = producer
+		}
+
+		err := next.Sign(signer)
+		if err != nil {
+			return nil, err
+		}
+		migrated.InsertBlock(next)
+	}
+	return migrated, nil
+}
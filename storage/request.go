@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RequestVersion prefix of block transactions holding a signed client request instead of a statement
+const RequestVersion = "req1:"
+
+// Request a signed client request. It is stored in the block in front of the statements it caused,
+// so the chain records who authorized each change.
+type Request struct {
+	Method    string        // rpc method which received the request
+	Operation string        // operation tag covered by the signature
+	Signer    string        // address of the signing account
+	Nonce     uint64        // nonce of the signing account covered by the signature
+	Params    []interface{} // signed operation fields
+	Signature []byte
+}
+
+// IsRequest checks if a block transaction holds a signed request
+func IsRequest(data string) bool {
+	return strings.HasPrefix(data, RequestVersion)
+}
+
+// Encode serializes the request with the typed value encoding of transactions
+func (request Request) Encode() (string, error) {
+	var builder strings.Builder
+	builder.WriteString(RequestVersion)
+	writeValue(&builder, tagString, request.Method)
+	writeValue(&builder, tagString, request.Operation)
+	writeValue(&builder, tagString, request.Signer)
+	writeValue(&builder, tagInt, strconv.FormatUint(request.Nonce, 10))
+	err := encodeValue(&builder, request.Signature)
+	if err != nil {
+		return "", err
+	}
+
+	for i, param := range request.Params {
+		err = encodeValue(&builder, param)
+		if err != nil {
+			return "", fmt.Errorf("param %d: %v", i, err)
+		}
+	}
+	return builder.String(), nil
+}
+
+// DecodeRequest parses a request stored in a block
+func DecodeRequest(data string) (Request, error) {
+	var request Request
+	if !IsRequest(data) {
+		return request, errors.New("not a request")
+	}
+
+	var header []string
+	rest := data[len(RequestVersion):]
+	for len(rest) > 0 {
+		tag, payload, next, err := readValue(rest)
+		if err != nil {
+			return Request{}, err
+		}
+		rest = next
+
+		if len(header) < 4 {
+			if (len(header) < 3 && tag != tagString) || (len(header) == 3 && tag != tagInt) {
+				return Request{}, errors.New("malformed request header")
+			}
+			header = append(header, payload)
+			continue
+		}
+		value, err := parseValue(tag, payload)
+		if err != nil {
+			return Request{}, err
+		}
+		if request.Signature == nil {
+			signature, ok := value.([]byte)
+			if !ok {
+				return Request{}, errors.New("malformed request signature")
+			}
+			request.Signature = signature
+			continue
+		}
+		request.Params = append(request.Params, value)
+	}
+
+	if len(header) < 4 || request.Signature == nil {
+		return Request{}, errors.New("truncated request")
+	}
+	nonce, err := strconv.ParseUint(header[3], 10, 64)
+	if err != nil {
+		return Request{}, err
+	}
+	request.Method, request.Operation, request.Signer, request.Nonce = header[0], header[1], header[2], nonce
+	return request, nil
+}
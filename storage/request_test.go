@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Check if a signed request survives an encode/decode round trip
+func TestRequestRoundTrip(t *testing.T) {
+	request := Request{
+		Method:    "ContractHandler.Create",
+		Operation: "contract.create",
+		Signer:    "0x0102030405",
+		Nonce:     7,
+		Params:    []interface{}{testAddress("0xabc"), "spec;1", 10, []byte{1, 2}},
+		Signature: []byte{9, 8, 7},
+	}
+	data, err := request.Encode()
+	assertEq(t, nil, err)
+	assertEq(t, true, IsRequest(data))
+
+	decoded, err := DecodeRequest(data)
+	assertEq(t, nil, err)
+	assertEq(t, request.Method, decoded.Method)
+	assertEq(t, request.Operation, decoded.Operation)
+	assertEq(t, request.Signer, decoded.Signer)
+	assertEq(t, uint64(7), decoded.Nonce)
+	assertEq(t, true, bytes.Equal(decoded.Signature, request.Signature))
+	assertEq(t, 4, len(decoded.Params))
+	assertEq(t, "0xabc", decoded.Params[0])
+	assertEq(t, int64(10), decoded.Params[2])
+	assertEq(t, true, bytes.Equal(decoded.Params[3].([]byte), []byte{1, 2}))
+}
+
+// Check if statements and truncated requests are not decoded as requests
+func TestRequestMalformed(t *testing.T) {
+	tx, _ := Transaction{Query: "select 1"}.Encode()
+	assertEq(t, false, IsRequest(tx))
+	_, err := DecodeRequest(tx)
+	assertEq(t, true, err != nil)
+
+	data, _ := Request{Method: "m", Operation: "o", Signer: "s", Nonce: 1, Signature: []byte{1}}.Encode()
+	_, err = DecodeRequest(data[:len(data)-6])
+	assertEq(t, true, err != nil)
+}
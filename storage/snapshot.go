@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SnapshotDirName directory holding state snapshots, relative to the chain path
+const SnapshotDirName = "snapshots"
+
+// Snapshot a copy of the state database taken at a block height
+type Snapshot struct {
+	Path string
+	StateInfo
+}
+
+// SnapshotDir returns the directory holding the state snapshots of the chain
+func (sp *Provider) SnapshotDir() string {
+	return filepath.Join(sp.path, SnapshotDirName)
+}
+
+// CreateSnapshot writes a consistent copy of the state database into the snapshot directory
+func (sp *Provider) CreateSnapshot() (Snapshot, error) {
+	dir := sp.SnapshotDir()
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	tmpPath := filepath.Join(dir, "snapshot.tmp")
+	os.Remove(tmpPath)
+	_, err = sp.StateDb.Transact("VACUUM INTO ?", tmpPath)
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	// the state may change while the copy is made, so the height is read from the copy itself
+	snapshot, err := readSnapshot(tmpPath)
+	if err != nil {
+		os.Remove(tmpPath)
+		return Snapshot{}, err
+	}
+	snapshot.Path = filepath.Join(dir, fmt.Sprintf("state-%010d.db", snapshot.Height))
+	err = os.Rename(tmpPath, snapshot.Path)
+	return snapshot, err
+}
+
+func readSnapshot(path string) (Snapshot, error) {
+	var db Database
+	db.OpenDb(path)
+	defer db.Close()
+
+	info, found, err := ReadStateInfo(&db)
+	if err == nil && !found {
+		err = errors.New("snapshot has no state info")
+	}
+	return Snapshot{Path: path, StateInfo: info}, err
+}
+
+// ListSnapshots returns the snapshots in the directory ordered by block height. Unreadable files are skipped.
+func ListSnapshots(dir string) ([]Snapshot, error) {
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []Snapshot
+	for _, file := range files {
+		if file.IsDir() || !strings.HasPrefix(file.Name(), "state-") || !strings.HasSuffix(file.Name(), ".db") {
+			continue
+		}
+		snapshot, err := readSnapshot(filepath.Join(dir, file.Name()))
+		if err == nil {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Height < snapshots[j].Height })
+	return snapshots, nil
+}
+
+// PruneSnapshots removes all snapshots except the newest ones
+func PruneSnapshots(dir string, keep int) ([]Snapshot, error) {
+	snapshots, err := ListSnapshots(dir)
+	if err != nil || len(snapshots) <= keep {
+		return nil, err
+	}
+
+	removed := snapshots[:len(snapshots)-keep]
+	for _, snapshot := range removed {
+		err = os.Remove(snapshot.Path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return removed, nil
+}
+
+// LatestSnapshot returns the newest snapshot that was taken from the chain
+func (sp *Provider) LatestSnapshot() (Snapshot, bool) {
+	if sp.Backend != nil && !sp.Backend.Persistent() {
+		return Snapshot{}, false
+	}
+	snapshots, err := ListSnapshots(sp.SnapshotDir())
+	if err != nil {
+		return Snapshot{}, false
+	}
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		if snapshots[i].Height > 0 && snapshots[i].Matches(sp.Chain) {
+			return snapshots[i], true
+		}
+	}
+	return Snapshot{}, false
+}
+
+// RestoreSnapshot replaces the state database file with the snapshot. The state database must be closed.
+// The snapshot is copied next to the state database first, so a failed copy leaves the state untouched.
+func RestoreSnapshot(snapshot Snapshot, stateDbPath string) error {
+	source, err := os.Open(snapshot.Path)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	tmpPath := stateDbPath + ".restore"
+	target, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(target, source)
+	if err == nil {
+		err = target.Sync()
+	}
+	closeErr := target.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	// the journal of the replaced state must not be applied to the snapshot
+	for _, suffix := range []string{"-wal", "-shm"} {
+		os.Remove(stateDbPath + suffix)
+	}
+	return os.Rename(tmpPath, stateDbPath)
+}
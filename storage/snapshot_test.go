@@ -0,0 +1,99 @@
+//go:build cgo
+// +build cgo
+
+package storage
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// applyTestBlock runs the statements on the state and appends a block recording them with the resulting state root
+func applyTestBlock(t *testing.T, sp *Provider, statements ...string) Block {
+	tx, err := sp.StateDb.Begin()
+	assertEq(t, nil, err)
+	defer tx.Rollback()
+
+	var transactions []string
+	for _, statement := range statements {
+		_, err = tx.Transact(statement)
+		assertEq(t, nil, err)
+		data, err := Transaction{Query: statement}.Encode()
+		assertEq(t, nil, err)
+		transactions = append(transactions, data)
+	}
+	block := sp.Chain.NextBlock(transactions...)
+	block.StateRoot, err = ComputeStateRoot(tx)
+	assertEq(t, nil, err)
+	assertEq(t, nil, WriteStateInfo(tx, block))
+	assertEq(t, nil, sp.AppendBlock(block))
+	assertEq(t, nil, tx.Commit())
+	return block
+}
+
+// replayTestBlock applies the statements of the block to the state
+func replayTestBlock(t *testing.T, sp *Provider, block Block) {
+	tx, err := sp.StateDb.Begin()
+	assertEq(t, nil, err)
+	defer tx.Rollback()
+	for _, data := range block.Transactions {
+		decoded, err := DecodeTransaction(data)
+		assertEq(t, nil, err)
+		_, err = tx.Transact(decoded.Query, decoded.Params...)
+		assertEq(t, nil, err)
+	}
+	assertEq(t, nil, VerifyStateRoot(tx, block))
+	assertEq(t, nil, WriteStateInfo(tx, block))
+	assertEq(t, nil, tx.Commit())
+}
+
+// Check if a restored snapshot holds the state of its height and replaying the later blocks reaches their state roots
+func TestSnapshotRestoreReplay(t *testing.T) {
+	dir := t.TempDir()
+	sp := Provider{Backend: SQLiteBackend{}}
+	sp.LoadChain(dir)
+	defer sp.Close()
+	assertEq(t, nil, sp.OpenState(false))
+
+	applyTestBlock(t, &sp, "create table Items (name text)", "insert into Items values ('first')")
+	snapshot, err := sp.CreateSnapshot()
+	assertEq(t, nil, err)
+	assertEq(t, 1, snapshot.Height)
+	assertEq(t, true, snapshot.Matches(sp.Chain))
+
+	last := applyTestBlock(t, &sp, "insert into Items values ('second')")
+	latest, found := sp.LatestSnapshot()
+	assertEq(t, true, found)
+	assertEq(t, 1, latest.Height)
+
+	sp.StateDb.Close()
+	assertEq(t, nil, RestoreSnapshot(latest, StateDbPath))
+	_, err = os.Stat(StateDbPath + ".restore")
+	assertEq(t, true, os.IsNotExist(err))
+	assertEq(t, nil, sp.OpenState(false))
+
+	info, found, err := ReadStateInfo(&sp.StateDb)
+	assertEq(t, nil, err)
+	assertEq(t, true, found)
+	assertEq(t, 1, info.Height)
+	root, err := ComputeStateRoot(&sp.StateDb)
+	assertEq(t, nil, err)
+	assertEq(t, true, bytes.Equal(root, sp.Chain[0].StateRoot))
+
+	replayTestBlock(t, &sp, last)
+	root, err = ComputeStateRoot(&sp.StateDb)
+	assertEq(t, nil, err)
+	assertEq(t, true, bytes.Equal(root, last.StateRoot))
+}
+
+// Check if a snapshot that can't be read leaves the state database untouched
+func TestRestoreMissingSnapshot(t *testing.T) {
+	path := t.TempDir() + "/storage.db"
+	assertEq(t, nil, ioutil.WriteFile(path, []byte("state"), 0600))
+	assertEq(t, true, RestoreSnapshot(Snapshot{Path: path + ".missing"}, path) != nil)
+	data, err := ioutil.ReadFile(path)
+	assertEq(t, nil, err)
+	assertEq(t, "state", string(data))
+}
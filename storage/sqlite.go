@@ -0,0 +1,9 @@
+//go:build cgo
+// +build cgo
+
+package storage
+
+import (
+	//blank import, registers the sqlite3 driver
+	_ "github.com/mattn/go-sqlite3"
+)
@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"os"
+	"strconv"
+)
+
+// SQLiteBackend stores the chain and the state in sqlite database files. Requires cgo.
+type SQLiteBackend struct{}
+
+// OpenChainStore opens blockchain.db in dir
+func (SQLiteBackend) OpenChainStore(dir string) (ChainStore, error) {
+	store := &sqliteChainStore{}
+	store.db.OpenDb(dir + "/blockchain.db")
+	return store, store.init()
+}
+
+// OpenStateDb opens storage.db in dir
+func (SQLiteBackend) OpenStateDb(db *Database, dir string, reset bool) error {
+	path := dir + "/storage.db"
+	if reset {
+		for _, suffix := range []string{"", "-wal", "-shm"} {
+			os.Remove(path + suffix)
+		}
+	}
+	db.OpenDb(path)
+	return nil
+}
+
+// Persistent returns true, database files survive restarts
+func (SQLiteBackend) Persistent() bool {
+	return true
+}
+
+// sqliteChainStore keeps the blocks in the ChainState table
+type sqliteChainStore struct {
+	db Database
+}
+
+func (store *sqliteChainStore) init() error {
+	_, err := store.db.Transact("CREATE TABLE IF NOT EXISTS ChainState (id integer, hash blob, data text)")
+	if err != nil {
+		return err
+	}
+	// columns added after the first release, older databases only hold legacy blocks
+	for _, column := range [][2]string{
+		{"version", "integer default 0"},
+		{"merkle", "blob"},
+		{"state", "blob"},
+		{"timestamp", "integer default 0"},
+		{"producer", "text default ''"},
+		{"signature", "blob"}} {
+		err = store.db.ensureColumn("ChainState", column[0], column[1])
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = store.db.Transact("CREATE TABLE IF NOT EXISTS ChainInfo (key text primary key, value text)")
+	return err
+}
+
+func (store *sqliteChainStore) LoadBlocks() (Blockchain, error) {
+	rows, err := store.db.Query("SELECT id, hash, data, version, merkle, state, timestamp, producer, signature FROM ChainState ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chain Blockchain
+	var data string
+	for rows.Next() {
+		var block Block
+		err = rows.Scan(&block.ID, &block.PrevHash, &data, &block.Version, &block.MerkleRoot, &block.StateRoot,
+			&block.Timestamp, &block.Producer, &block.Signature) //integer, blob, text, integer, blob, blob, integer, text, blob
+		if err != nil {
+			return nil, err
+		}
+		if block.Version == LegacyBlockVersion {
+			block.Transactions = []string{data}
+		} else {
+			block.Transactions, err = decodeTransactionList(data)
+			if err != nil {
+				return nil, err
+			}
+		}
+		chain.InsertBlock(block)
+	}
+	return chain, nil
+}
+
+func (store *sqliteChainStore) Height() (int, error) {
+	rows, err := store.db.Query("SELECT COUNT(*) FROM ChainState")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var count int
+	if rows.Next() {
+		err = rows.Scan(&count)
+	}
+	return count, err
+}
+
+func (store *sqliteChainStore) AppendBlock(block Block) error {
+	_, err := store.db.Transact(insertBlockStatement, blockRow(block)...)
+	return err
+}
+
+// insertBlockStatement stores a block, its parameters are returned by blockRow
+const insertBlockStatement = "INSERT INTO ChainState (id, hash, data, version, merkle, state, timestamp, producer, signature) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)"
+
+func blockRow(block Block) []interface{} {
+	data := encodeTransactionList(block.Transactions)
+	if block.Version == LegacyBlockVersion {
+		data = block.Transactions[0]
+	}
+	return []interface{}{block.ID, block.PrevHash, data, block.Version, block.MerkleRoot, block.StateRoot, block.Timestamp, block.Producer, block.Signature}
+}
+
+func (store *sqliteChainStore) RemoveBlocks(height int) error {
+	_, err := store.db.Transact("DELETE FROM ChainState WHERE id >= ?", height)
+	return err
+}
+
+// ReplaceBlocks overwrites the chain in a single transaction, the stored chain is kept if it fails
+func (store *sqliteChainStore) ReplaceBlocks(chain Blockchain) error {
+	tx, err := store.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Transact("DELETE FROM ChainState")
+	if err != nil {
+		return err
+	}
+	for _, block := range chain {
+		_, err = tx.Transact(insertBlockStatement, blockRow(block)...)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (store *sqliteChainStore) Version() (int, bool, error) {
+	rows, err := store.db.Query("SELECT value FROM ChainInfo WHERE key='version'")
+	if err != nil {
+		return 0, false, err
+	}
+	defer rows.Close()
+
+	var value string
+	if !rows.Next() {
+		return 0, false, nil
+	}
+	err = rows.Scan(&value)
+	if err != nil {
+		return 0, false, err
+	}
+	version, err := strconv.Atoi(value)
+	return version, err == nil, err
+}
+
+func (store *sqliteChainStore) SetVersion(version int) error {
+	_, err := store.db.Transact("INSERT OR REPLACE INTO ChainInfo (key, value) VALUES ('version', ?)", strconv.Itoa(version))
+	return err
+}
+
+func (store *sqliteChainStore) Close() error {
+	store.db.Close()
+	return nil
+}
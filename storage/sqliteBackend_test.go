@@ -0,0 +1,29 @@
+//go:build cgo
+// +build cgo
+
+package storage
+
+import (
+	"testing"
+)
+
+// Check if a failing replacement keeps the stored chain
+func TestSQLiteReplaceBlocksAtomic(t *testing.T) {
+	var chain Blockchain
+	chain.AddBlock("first")
+	chain.AddBlock("second")
+
+	store, err := SQLiteBackend{}.OpenChainStore(t.TempDir())
+	assertEq(t, nil, err)
+	defer store.Close()
+	assertEq(t, nil, store.ReplaceBlocks(chain))
+	height, _ := store.Height()
+	assertEq(t, 2, height)
+
+	// inserts fail after the delete, the delete must be rolled back as well
+	_, err = store.(*sqliteChainStore).db.Transact("ALTER TABLE ChainState DROP COLUMN signature")
+	assertEq(t, nil, err)
+	assertEq(t, true, store.ReplaceBlocks(chain[:1]) != nil)
+	height, _ = store.Height()
+	assertEq(t, 2, height)
+}
@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"bytes"
+)
+
+// StateInfo describes how much of the chain is applied to the state database
+type StateInfo struct {
+	Height  int    // amount of applied blocks
+	TipHash []byte // hash of the last applied block
+}
+
+// queryer runs read queries on a database or a transaction
+type queryer interface {
+	Query(query string, params ...interface{}) (*Rows, error)
+}
+
+// ReadStateInfo reads the state info of a state database. Returns false if the database doesn't track it.
+func ReadStateInfo(db queryer) (StateInfo, bool, error) {
+	var info StateInfo
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type='table' AND name='StateInfo'")
+	if err != nil {
+		return info, false, err
+	}
+	found := rows.Next()
+	rows.Close()
+	if !found {
+		return info, false, nil
+	}
+
+	rows, err = db.Query("SELECT height, hash FROM StateInfo")
+	if err != nil {
+		return info, false, err
+	}
+	defer rows.Close()
+	if rows.Next() {
+		err = rows.Scan(&info.Height, &info.TipHash)
+	}
+	return info, err == nil, err
+}
+
+// WriteStateInfo marks the block as the last one applied to the state. Must be called in the transaction applying the block.
+func WriteStateInfo(tx *Tx, block Block) error {
+	_, err := tx.Transact("CREATE TABLE IF NOT EXISTS StateInfo (height integer, hash blob)")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Transact("DELETE FROM StateInfo")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Transact("INSERT INTO StateInfo (height, hash) VALUES (?, ?)", block.ID+1, block.Hash())
+	return err
+}
+
+// Matches checks if the state was built from a prefix of the chain
+func (info StateInfo) Matches(chain Blockchain) bool {
+	if info.Height == 0 {
+		return true
+	}
+	if info.Height > len(chain) {
+		return false
+	}
+	return bytes.Equal(chain[info.Height-1].Hash(), info.TipHash)
+}
@@ -0,0 +1,16 @@
+package storage
+
+import "testing"
+
+// Check if a state is matched only against the chain it was built from
+func TestStateInfoMatches(t *testing.T) {
+	blockchain := Blockchain{}
+	blockchain.AddBlock("hello")
+	blockchain.AddBlock("data")
+
+	assertEq(t, true, StateInfo{}.Matches(blockchain))
+	assertEq(t, true, StateInfo{Height: 1, TipHash: blockchain[0].Hash()}.Matches(blockchain))
+	assertEq(t, true, StateInfo{Height: 2, TipHash: blockchain[1].Hash()}.Matches(blockchain))
+	assertEq(t, false, StateInfo{Height: 2, TipHash: blockchain[0].Hash()}.Matches(blockchain))
+	assertEq(t, false, StateInfo{Height: 3, TipHash: blockchain[1].Hash()}.Matches(blockchain))
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+)
+
+// ComputeStateRoot computes a deterministic hash over all handler tables of the state database.
+// Tables are hashed in name order with their schema, rows in rowid order with typed values.
+// Internal tables used for bookkeeping are not part of the state.
+func ComputeStateRoot(db queryer) ([]byte, error) {
+	rows, err := db.Query("SELECT name, sql FROM sqlite_master WHERE type='table' AND name NOT LIKE 'sqlite_%' AND name != 'StateInfo' ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	var tables [][2]string
+	for rows.Next() {
+		var name, schema string
+		err = rows.Scan(&name, &schema)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		tables = append(tables, [2]string{name, schema})
+	}
+	rows.Close()
+
+	hash := sha256.New()
+	for _, table := range tables {
+		var builder strings.Builder
+		writeValue(&builder, tagString, table[0])
+		writeValue(&builder, tagString, table[1])
+		hash.Write([]byte(builder.String()))
+
+		err = hashTable(db, table[0], func(row string) { hash.Write([]byte(row)) })
+		if err != nil {
+			return nil, err
+		}
+	}
+	return hash.Sum(nil), nil
+}
+
+func hashTable(db queryer, table string, write func(string)) error {
+	rows, err := db.Query(fmt.Sprintf("SELECT rowid, * FROM \"%s\" ORDER BY rowid", strings.Replace(table, "\"", "\"\"", -1)))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	values := make([]interface{}, len(cols))
+	pointers := make([]interface{}, len(cols))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+
+	for rows.Next() {
+		err = rows.Scan(pointers...)
+		if err != nil {
+			return err
+		}
+
+		var builder strings.Builder
+		writeValue(&builder, tagInt, fmt.Sprint(len(values)))
+		for _, value := range values {
+			err = encodeValue(&builder, value)
+			if err != nil {
+				return err
+			}
+		}
+		write(builder.String())
+	}
+	return rows.Err()
+}
+
+// VerifyStateRoot checks if the state matches the state root committed in the block.
+// Blocks older than StateRootBlockVersion don't commit to a state and are not checked.
+func VerifyStateRoot(db queryer, block Block) error {
+	if block.Version < StateRootBlockVersion {
+		return nil
+	}
+	root, err := ComputeStateRoot(db)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(root, block.StateRoot) {
+		return fmt.Errorf("state root mismatch at block %d, the local state diverged from the producer", block.ID)
+	}
+	return nil
+}
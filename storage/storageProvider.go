@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"AdminBlockchain/utils"
+	"errors"
 	"log"
 )
 
@@ -11,69 +13,174 @@ var (
 
 //Provider handles storing and loading blockchain data from the database
 type Provider struct {
-	Chain   Blockchain
-	ChainDb Database
-	StateDb Database
+	Chain        Blockchain
+	ChainStore   ChainStore
+	StateDb      Database
+	Backend      Backend                  // storage backend, SQLiteBackend if not set
+	ChainVersion int                      // oldest block version in the chain
+
+	SnapshotInterval int // a state snapshot is taken every SnapshotInterval blocks, disabled if 0
+	SnapshotsKept    int // amount of snapshots kept when taking periodic snapshots
+	path             string
 }
 
 //LoadChain loads the chain state from the database.
 func (sp *Provider) LoadChain(DbPath string) {
-	sp.ChainDb.OpenDb(DbPath + "/blockchain.db")
+	sp.path = DbPath
+	if sp.Backend == nil {
+		sp.Backend = SQLiteBackend{}
+	}
 	const stateDbName = "/storage.db"
 	StateDbPath = DbPath + stateDbName
 
-	sp.ChainDb.Transact("CREATE TABLE IF NOT EXISTS ChainState (id integer, hash blob, data text)")
+	store, err := sp.Backend.OpenChainStore(DbPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sp.ChainStore = store
 
-	rows, err := sp.ChainDb.Query("SELECT * FROM ChainState")
+	sp.Chain, err = store.LoadBlocks()
 	if err != nil {
 		log.Fatal(err)
 	}
-	var id int
-	var hash []byte
-	var data string
 
-	for rows.Next() {
-		err = rows.Scan(&id, &hash, &data) //integer, blob, text
-		if err != nil {
-			log.Fatal(err)
+	// the producer signatures are verified against the validator sets kept in the state, when the state is recovered
+	if !sp.Chain.IsValid(nil) {
+		log.Fatal("The chain state database is corrupted.")
+	}
+
+	sp.loadChainVersion()
+}
+
+// OpenState opens the state database of the loaded chain. The existing state is discarded if reset is set.
+func (sp *Provider) OpenState(reset bool) error {
+	return sp.Backend.OpenStateDb(&sp.StateDb, sp.path, reset)
+}
+
+// IsOpen checks if a chain is loaded
+func (sp *Provider) IsOpen() bool {
+	return sp.ChainStore != nil
+}
+
+// loadChainVersion reads the chain version marker. Chains created before the marker was introduced are
+// recognized by the version of their first block.
+func (sp *Provider) loadChainVersion() {
+	version, found, err := sp.ChainStore.Version()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if found {
+		sp.ChainVersion = version
+	} else {
+		sp.ChainVersion = CurrentBlockVersion
+		if len(sp.Chain) > 0 {
+			sp.ChainVersion = sp.Chain[0].Version
 		}
-		sp.Chain.InsertBlock(Block{id, hash, data})
+		utils.LogError(sp.ChainStore.SetVersion(sp.ChainVersion))
 	}
-	rows.Close()
 
-	if !sp.Chain.IsValid() {
-		log.Fatal("The chain state database is corrupted.")
+	if sp.ChainVersion < CanonicalBlockVersion {
+		log.Printf("The chain uses legacy block version %d, run the migrate tool to rehash it.", sp.ChainVersion)
 	}
 }
 
-//UpdateChainState writes the current blockchain into the database
+//UpdateChainState writes blocks missing in the database. Blocks are persisted as they are appended, this only catches up
+// blocks added to the chain directly.
 func (sp *Provider) UpdateChainState() {
-	rows, err := sp.ChainDb.Query("SELECT COUNT(*) FROM ChainState")
+	count, err := sp.ChainStore.Height()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	var count int
-	if rows.Next() {
-		rows.Scan(&count)
-	}
-	rows.Close()
 	if count < len(sp.Chain) {
 		for _, item := range sp.Chain[count:] {
-			_, err = sp.ChainDb.Transact("INSERT INTO ChainState (id, hash, data) VALUES (?, ?, ?)", item.ID, item.PrevHash, item.Data)
-			if err != nil {
-				log.Print(err)
-			}
+			utils.LogError(sp.ChainStore.AppendBlock(item))
 		}
 	}
 }
 
+// AppendBlock persists the block in the chain database and adds it at the top of the chain.
+// The block is stored before the state changes are committed, so it can be replayed if the node stops in between.
+func (sp *Provider) AppendBlock(block Block) error {
+	if block.ID != len(sp.Chain) {
+		return errors.New("invalid block id, append only at block height")
+	}
+	err := sp.ChainStore.AppendBlock(block)
+	if err != nil {
+		return err
+	}
+	sp.Chain.InsertBlock(block)
+	return nil
+}
+
+// SnapshotIfDue takes a state snapshot if the chain height reached the snapshot interval and prunes old snapshots.
+// Must be called after the state changes of the top block are committed.
+func (sp *Provider) SnapshotIfDue() {
+	height := len(sp.Chain)
+	if !sp.Backend.Persistent() || sp.SnapshotInterval <= 0 || height == 0 || height%sp.SnapshotInterval != 0 {
+		return
+	}
+
+	go func() {
+		snapshot, err := sp.CreateSnapshot()
+		if err != nil {
+			log.Print(err)
+			return
+		}
+		log.Printf("Created state snapshot at block height %d", snapshot.Height)
+		if sp.SnapshotsKept > 0 {
+			_, err = PruneSnapshots(sp.SnapshotDir(), sp.SnapshotsKept)
+			utils.LogError(err)
+		}
+	}()
+}
+
+// RemoveLastBlock removes the top block from the chain and the chain database, used when its state changes couldn't be committed
+func (sp *Provider) RemoveLastBlock() error {
+	height := len(sp.Chain)
+	if height == 0 {
+		return errors.New("chain is empty")
+	}
+	return sp.RemoveBlocks(height - 1)
+}
+
+// RemoveBlocks removes the blocks starting at the height from the chain and the chain database,
+// used when the chain is replaced by another branch. The state has to be recovered afterwards.
+func (sp *Provider) RemoveBlocks(height int) error {
+	if height < 0 || height > len(sp.Chain) {
+		return errors.New("invalid block height")
+	}
+	err := sp.ChainStore.RemoveBlocks(height)
+	if err != nil {
+		return err
+	}
+	sp.Chain = sp.Chain[:height]
+	return nil
+}
+
+// ReplaceChain overwrites the stored chain, used when migrating a chain to a new block version
+func (sp *Provider) ReplaceChain(chain Blockchain) error {
+	err := sp.ChainStore.ReplaceBlocks(chain)
+	if err != nil {
+		return err
+	}
+
+	sp.Chain = chain
+	sp.ChainVersion = CurrentBlockVersion
+	if len(chain) > 0 {
+		sp.ChainVersion = chain[0].Version
+	}
+	return sp.ChainStore.SetVersion(sp.ChainVersion)
+}
+
 // Close closes open databases
 func (sp *Provider) Close() {
-	if sp.ChainDb.IsOpen() {
+	if sp.IsOpen() {
 		log.Print("Closing storage...")
 		sp.UpdateChainState()
-		sp.ChainDb.Close()
+		utils.LogError(sp.ChainStore.Close())
+		sp.ChainStore = nil
 		sp.StateDb.Close()
 	}
 }
@@ -0,0 +1,195 @@
+package storage
+
+import (
+	"database/sql/driver"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// TransactionVersion prefix of the current transaction encoding
+const TransactionVersion = "tx1:"
+
+// Value type tags used by the transaction encoding
+const (
+	tagNull   = 'n'
+	tagInt    = 'i'
+	tagFloat  = 'f'
+	tagBool   = 't'
+	tagString = 's'
+	tagBytes  = 'b'
+)
+
+// Transaction a single sql statement with its parameters, as stored in a block
+type Transaction struct {
+	Query  string
+	Params []interface{}
+}
+
+// Encode serializes the transaction into a self-describing string.
+// Every value is written as <type tag><payload length>:<payload>, so no separator has to be escaped.
+func (tx Transaction) Encode() (string, error) {
+	var builder strings.Builder
+	builder.WriteString(TransactionVersion)
+	writeValue(&builder, tagString, tx.Query)
+
+	for i, param := range tx.Params {
+		err := encodeValue(&builder, param)
+		if err != nil {
+			return "", fmt.Errorf("param %d: %v", i, err)
+		}
+	}
+	return builder.String(), nil
+}
+
+// encodeValue writes a tagged value, the value is converted to one of the types supported by sql drivers first
+func encodeValue(builder *strings.Builder, param interface{}) error {
+	value, err := driver.DefaultParameterConverter.ConvertValue(param)
+	if err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case nil:
+		writeValue(builder, tagNull, "")
+	case int64:
+		writeValue(builder, tagInt, strconv.FormatInt(v, 10))
+	case float64:
+		writeValue(builder, tagFloat, strconv.FormatFloat(v, 'g', -1, 64))
+	case bool:
+		writeValue(builder, tagBool, strconv.FormatBool(v))
+	case string:
+		writeValue(builder, tagString, v)
+	case []byte:
+		writeValue(builder, tagBytes, base64.StdEncoding.EncodeToString(v))
+	default:
+		return fmt.Errorf("unsupported type %T", value)
+	}
+	return nil
+}
+
+func writeValue(builder *strings.Builder, tag byte, payload string) {
+	builder.WriteByte(tag)
+	builder.WriteString(strconv.Itoa(len(payload)))
+	builder.WriteByte(':')
+	builder.WriteString(payload)
+}
+
+// DecodeTransaction parses a transaction stored in a block. Blocks written before
+// the versioned encoding was introduced are decoded with the legacy format.
+func DecodeTransaction(data string) (Transaction, error) {
+	if !strings.HasPrefix(data, TransactionVersion) {
+		return decodeLegacyTransaction(data)
+	}
+
+	var tx Transaction
+	rest := data[len(TransactionVersion):]
+	first := true
+	for len(rest) > 0 {
+		tag, payload, next, err := readValue(rest)
+		if err != nil {
+			return Transaction{}, err
+		}
+		rest = next
+
+		if first {
+			if tag != tagString {
+				return Transaction{}, errors.New("transaction must start with a query")
+			}
+			tx.Query = payload
+			first = false
+			continue
+		}
+
+		value, err := parseValue(tag, payload)
+		if err != nil {
+			return Transaction{}, err
+		}
+		tx.Params = append(tx.Params, value)
+	}
+
+	if first {
+		return Transaction{}, errors.New("empty transaction")
+	}
+	return tx, nil
+}
+
+func readValue(data string) (byte, string, string, error) {
+	tag := data[0]
+	sep := strings.IndexByte(data, ':')
+	if sep < 2 {
+		return 0, "", "", errors.New("malformed transaction value")
+	}
+	length, err := strconv.Atoi(data[1:sep])
+	if err != nil || length < 0 || sep+1+length > len(data) {
+		return 0, "", "", errors.New("invalid transaction value length")
+	}
+	end := sep + 1 + length
+	return tag, data[sep+1 : end], data[end:], nil
+}
+
+func parseValue(tag byte, payload string) (interface{}, error) {
+	switch tag {
+	case tagNull:
+		return nil, nil
+	case tagInt:
+		return strconv.ParseInt(payload, 10, 64)
+	case tagFloat:
+		return strconv.ParseFloat(payload, 64)
+	case tagBool:
+		return strconv.ParseBool(payload)
+	case tagString:
+		return payload, nil
+	case tagBytes:
+		return base64.StdEncoding.DecodeString(payload)
+	default:
+		return nil, fmt.Errorf("unknown value type %q", tag)
+	}
+}
+
+// decodeLegacyTransaction parses the old "query;param;{raw}base64{raw}" format.
+// All non binary parameters are returned as strings, as they were before.
+func decodeLegacyTransaction(data string) (Transaction, error) {
+	params := strings.Split(data, ";")
+	tx := Transaction{Query: params[0]}
+	for _, param := range params[1:] {
+		if strings.HasPrefix(param, "{raw}") && strings.HasSuffix(param, "{raw}") && len(param) >= 10 {
+			raw, err := base64.StdEncoding.DecodeString(param[5 : len(param)-5])
+			if err != nil {
+				return Transaction{}, err
+			}
+			tx.Params = append(tx.Params, raw)
+		} else {
+			tx.Params = append(tx.Params, param)
+		}
+	}
+	return tx, nil
+}
+
+// encodeTransactionList joins encoded transactions of a block into a single string
+func encodeTransactionList(transactions []string) string {
+	var builder strings.Builder
+	for _, tx := range transactions {
+		writeValue(&builder, tagString, tx)
+	}
+	return builder.String()
+}
+
+// decodeTransactionList splits a string created by encodeTransactionList
+func decodeTransactionList(data string) ([]string, error) {
+	var transactions []string
+	for len(data) > 0 {
+		tag, payload, rest, err := readValue(data)
+		if err != nil {
+			return nil, err
+		}
+		if tag != tagString {
+			return nil, fmt.Errorf("unexpected value type %q in transaction list", tag)
+		}
+		transactions = append(transactions, payload)
+		data = rest
+	}
+	return transactions, nil
+}
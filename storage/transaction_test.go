@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"bytes"
+	"testing"
+)
+
+type testAddress string
+
+// Check if all supported parameter types survive an encode/decode round trip
+func TestTransactionRoundTrip(t *testing.T) {
+	tx := Transaction{
+		Query:  "insert into Contracts (reporter, info, reward, done, data, extra) values (?, ?, ?, ?, ?, ?)",
+		Params: []interface{}{testAddress("0xabc"), "http://host/spec?a=1;b=2", 42, true, []byte{0, 1, 2, ';'}, nil},
+	}
+	data, err := tx.Encode()
+	assertEq(t, nil, err)
+
+	decoded, err := DecodeTransaction(data)
+	assertEq(t, nil, err)
+	assertEq(t, tx.Query, decoded.Query)
+	assertEq(t, 6, len(decoded.Params))
+	assertEq(t, "0xabc", decoded.Params[0])
+	assertEq(t, "http://host/spec?a=1;b=2", decoded.Params[1])
+	assertEq(t, int64(42), decoded.Params[2])
+	assertEq(t, true, decoded.Params[3])
+	assertEq(t, true, bytes.Equal(decoded.Params[4].([]byte), []byte{0, 1, 2, ';'}))
+	assertEq(t, nil, decoded.Params[5])
+}
+
+// Check if a transaction without params can be decoded
+func TestTransactionNoParams(t *testing.T) {
+	data, err := Transaction{Query: "create table A (a int)"}.Encode()
+	assertEq(t, nil, err)
+
+	decoded, err := DecodeTransaction(data)
+	assertEq(t, nil, err)
+	assertEq(t, "create table A (a int)", decoded.Query)
+	assertEq(t, 0, len(decoded.Params))
+}
+
+// Check if unsupported parameter types are rejected
+func TestTransactionUnsupportedParam(t *testing.T) {
+	_, err := Transaction{Query: "select ?", Params: []interface{}{struct{}{}}}.Encode()
+	assertEq(t, true, err != nil)
+}
+
+// Check if truncated transactions are rejected
+func TestTransactionTruncated(t *testing.T) {
+	data, _ := Transaction{Query: "select ?", Params: []interface{}{"value"}}.Encode()
+
+	_, err := DecodeTransaction(data[:len(data)-2])
+	assertEq(t, true, err != nil)
+}
+
+// Check if transactions written by the old semicolon format are still readable
+func TestLegacyTransaction(t *testing.T) {
+	decoded, err := DecodeTransaction("insert into Accounts (address, level, pkey) values (?, ?, ?);0x01;1;{raw}AAEC{raw}")
+	assertEq(t, nil, err)
+	assertEq(t, "insert into Accounts (address, level, pkey) values (?, ?, ?)", decoded.Query)
+	assertEq(t, 3, len(decoded.Params))
+	assertEq(t, "0x01", decoded.Params[0])
+	assertEq(t, "1", decoded.Params[1])
+	assertEq(t, true, bytes.Equal(decoded.Params[2].([]byte), []byte{0, 1, 2}))
+}
+
+// Check if the transactions of a block can be stored in a single column
+func TestTransactionList(t *testing.T) {
+	first, _ := Transaction{Query: "insert into A values (?)", Params: []interface{}{"a;b"}}.Encode()
+	transactions := []string{first, "legacy;query", ""}
+
+	decoded, err := decodeTransactionList(encodeTransactionList(transactions))
+	assertEq(t, nil, err)
+	assertEq(t, 3, len(decoded))
+	for i := range transactions {
+		assertEq(t, transactions[i], decoded[i])
+	}
+}
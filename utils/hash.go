@@ -16,3 +16,14 @@ func Hash(params ...interface{}) []byte {
 	hash.Write(buffer.Bytes())
 	return hash.Sum(nil)
 }
+
+// HashFields produces a sha256 hash of a list of parameters. Each parameter is length prefixed,
+// so different lists never hash the same input.
+func HashFields(params ...interface{}) []byte {
+	hash := sha256.New()
+	for _, item := range params {
+		value := fmt.Sprintf("%v", item)
+		fmt.Fprintf(hash, "%d:%s", len(value), value)
+	}
+	return hash.Sum(nil)
+}
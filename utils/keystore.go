@@ -0,0 +1,284 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/term"
+)
+
+// Environment variables holding the keystore passphrase, or the path of a file holding it
+const (
+	PassphraseEnv     = "KEYSTORE_PASSPHRASE"
+	PassphraseFileEnv = "KEYSTORE_PASSPHRASE_FILE"
+)
+
+// scrypt parameters of new key files
+const (
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+)
+
+const keyFileVersion = 1
+
+var identityName = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9_.-]*$`)
+
+// keyFile a private key encrypted with a passphrase. The key is derived with scrypt, the PKCS#8 encoded
+// private key is sealed with AES-256-GCM using the public key as additional data.
+type keyFile struct {
+	Version    int
+	Algorithm  string
+	PublicKey  []byte // PKIX encoded public key, readable without the passphrase
+	Salt       []byte
+	N, R, P    int
+	Nonce      []byte
+	Ciphertext []byte
+}
+
+// Keystore a directory of passphrase encrypted private keys, one file per named identity
+type Keystore struct {
+	Dir string
+}
+
+// OpenKeystore opens the keystore directory, creating it if needed
+func OpenKeystore(dir string) (*Keystore, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	return &Keystore{Dir: dir}, nil
+}
+
+func (ks *Keystore) path(name string) (string, error) {
+	if !identityName.MatchString(name) {
+		return "", fmt.Errorf("invalid identity name %q", name)
+	}
+	return filepath.Join(ks.Dir, name+".json"), nil
+}
+
+// Store encrypts the key with the passphrase and stores it under the name, existing identities are not replaced
+func (ks *Keystore) Store(name string, key SignatureCreator, passphrase []byte) error {
+	path, err := ks.path(name)
+	if err != nil {
+		return err
+	}
+	if len(passphrase) == 0 {
+		return errors.New("empty passphrase")
+	}
+	der, err := marshalPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	public := key.PublicKey()
+	file := keyFile{Version: keyFileVersion, Algorithm: public.Algorithm(), N: scryptN, R: scryptR, P: scryptP}
+	file.PublicKey, err = public.Store()
+	if err != nil {
+		return err
+	}
+
+	file.Salt = make([]byte, 32)
+	_, err = rand.Read(file.Salt)
+	if err != nil {
+		return err
+	}
+	aead, err := keyFileCipher(file, passphrase)
+	if err != nil {
+		return err
+	}
+	file.Nonce = make([]byte, aead.NonceSize())
+	_, err = rand.Read(file.Nonce)
+	if err != nil {
+		return err
+	}
+	file.Ciphertext = aead.Seal(nil, file.Nonce, der, file.PublicKey)
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if os.IsExist(err) {
+		return fmt.Errorf("identity %q already exists", name)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(data)
+	if err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Load decrypts the private key of the identity
+func (ks *Keystore) Load(name string, passphrase []byte) (SignatureCreator, error) {
+	file, err := ks.read(name)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := keyFileCipher(file, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	der, err := aead.Open(nil, file.Nonce, file.Ciphertext, file.PublicKey)
+	if err != nil {
+		return nil, errors.New("wrong passphrase or damaged key file")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	return newSignatureCreator(parsed)
+}
+
+// PublicKey returns the public key of the identity, no passphrase is needed
+func (ks *Keystore) PublicKey(name string) (SignatureValidator, error) {
+	file, err := ks.read(name)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePublicKeyWithAlgorithm(file.Algorithm, file.PublicKey)
+}
+
+// List returns the names of the stored identities
+func (ks *Keystore) List() ([]string, error) {
+	entries, err := ioutil.ReadDir(ks.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".json")
+		if !entry.IsDir() && name != entry.Name() && identityName.MatchString(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (ks *Keystore) read(name string) (keyFile, error) {
+	var file keyFile
+	path, err := ks.path(name)
+	if err != nil {
+		return file, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return file, fmt.Errorf("identity %q not found", name)
+	}
+	if err != nil {
+		return file, err
+	}
+	err = json.Unmarshal(data, &file)
+	if err != nil {
+		return file, err
+	}
+	if file.Version != keyFileVersion {
+		return file, fmt.Errorf("unsupported key file version %d", file.Version)
+	}
+	return file, nil
+}
+
+// keyFileCipher derives the encryption key of the file from the passphrase.
+// The scrypt parameters are read from the file, a damaged file could make the derivation take any time or memory.
+func keyFileCipher(file keyFile, passphrase []byte) (cipher.AEAD, error) {
+	if file.N != scryptN || file.R != scryptR || file.P != scryptP {
+		return nil, fmt.Errorf("unsupported scrypt parameters N=%d r=%d p=%d", file.N, file.R, file.P)
+	}
+	key, err := scrypt.Key(passphrase, file.Salt, file.N, file.R, file.P, scryptKeyLen)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// marshalPrivateKey returns the PKCS#8 encoding of the key
+func marshalPrivateKey(key SignatureCreator) ([]byte, error) {
+	switch key := key.(type) {
+	case *rsaPrivateKey:
+		return x509.MarshalPKCS8PrivateKey(key.PrivateKey)
+	case *ed25519PrivateKey:
+		return x509.MarshalPKCS8PrivateKey(key.PrivateKey)
+	case *ecdsaPrivateKey:
+		return x509.MarshalPKCS8PrivateKey(key.PrivateKey)
+	default:
+		return nil, fmt.Errorf("can't store private key %T", key)
+	}
+}
+
+// ReadPassphrase returns the passphrase from the environment, from the file named by the environment
+// or asks for it on the terminal.
+func ReadPassphrase(prompt string) ([]byte, error) {
+	if passphrase, found := os.LookupEnv(PassphraseEnv); found {
+		return []byte(passphrase), nil
+	}
+	if path := os.Getenv(PassphraseFileEnv); path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(strings.TrimRight(string(data), "\r\n")), nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf("no passphrase, set %s or %s", PassphraseEnv, PassphraseFileEnv)
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	passphrase, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	return passphrase, err
+}
+
+// ReadNewPassphrase reads the passphrase of a new key like ReadPassphrase, on the terminal it is asked for twice.
+func ReadNewPassphrase(prompt string) ([]byte, error) {
+	_, found := os.LookupEnv(PassphraseEnv)
+	if found || os.Getenv(PassphraseFileEnv) != "" || !term.IsTerminal(int(os.Stdin.Fd())) {
+		return ReadPassphrase(prompt)
+	}
+	passphrase, err := ReadPassphrase(prompt)
+	if err != nil {
+		return nil, err
+	}
+	repeated, err := ReadPassphrase("Repeat the passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	if string(passphrase) != string(repeated) {
+		return nil, errors.New("passphrases don't match")
+	}
+	return passphrase, nil
+}
+
+// LoadKeystoreKey loads the private key of the identity from the keystore directory, the passphrase is read with ReadPassphrase
+func LoadKeystoreKey(dir string, name string) (SignatureCreator, error) {
+	ks, err := OpenKeystore(dir)
+	if err != nil {
+		return nil, err
+	}
+	passphrase, err := ReadPassphrase(fmt.Sprintf("Passphrase of %s: ", name))
+	if err != nil {
+		return nil, err
+	}
+	return ks.Load(name, passphrase)
+}
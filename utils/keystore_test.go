@@ -0,0 +1,123 @@
+package utils
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func openTestKeystore(t *testing.T) *Keystore {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "keystore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	ks, err := OpenKeystore(filepath.Join(dir, "keys"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ks
+}
+
+// Check if a stored key decrypts to the same key and its public key is readable without the passphrase
+func TestKeystoreRoundTrip(t *testing.T) {
+	ks := openTestKeystore(t)
+	passphrase := []byte("passphrase")
+	for _, algorithm := range testAlgorithms {
+		key := generateTestKey(t, algorithm)
+		if err := ks.Store(algorithm, key, passphrase); err != nil {
+			t.Fatal(err)
+		}
+
+		loaded, err := ks.Load(algorithm, passphrase)
+		if err != nil {
+			t.Fatalf("%s: %v", algorithm, err)
+		}
+		signature, err := loaded.Sign([]byte("message"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = key.PublicKey().CheckSignature([]byte("message"), signature); err != nil {
+			t.Errorf("%s: loaded key differs: %v", algorithm, err)
+		}
+		public, err := ks.PublicKey(algorithm)
+		if err != nil || public.Algorithm() != algorithm {
+			t.Errorf("%s: public key not readable: %v", algorithm, err)
+		}
+	}
+
+	names, err := ks.List()
+	if err != nil || len(names) != len(testAlgorithms) {
+		t.Errorf("listed %v, %v", names, err)
+	}
+	info, err := os.Stat(filepath.Join(ks.Dir, KeyAlgorithmEd25519+".json"))
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("key file is readable by others: %v", err)
+	}
+	if err = ks.Store(KeyAlgorithmEd25519, generateTestKey(t, KeyAlgorithmEd25519), passphrase); err == nil {
+		t.Error("existing identity replaced")
+	}
+}
+
+// Check if a key isn't decrypted with a wrong passphrase
+func TestKeystoreWrongPassphrase(t *testing.T) {
+	ks := openTestKeystore(t)
+	if err := ks.Store("key", generateTestKey(t, KeyAlgorithmEd25519), []byte("passphrase")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Load("key", []byte("wrong")); err == nil {
+		t.Error("key decrypted with a wrong passphrase")
+	}
+	if err := ks.Store("empty", generateTestKey(t, KeyAlgorithmEd25519), nil); err == nil {
+		t.Error("key stored without a passphrase")
+	}
+}
+
+// Check if damaged key files are rejected
+func TestKeystoreCorrupted(t *testing.T) {
+	ks := openTestKeystore(t)
+	passphrase := []byte("passphrase")
+	if err := ks.Store("key", generateTestKey(t, KeyAlgorithmEd25519), passphrase); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(ks.Dir, "key.json")
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, damage := range map[string]func(file *keyFile){
+		"ciphertext": func(file *keyFile) { file.Ciphertext[0] ^= 1 },
+		"public key": func(file *keyFile) { file.PublicKey, _ = generateTestKey(t, KeyAlgorithmEd25519).PublicKey().Store() },
+		"version":    func(file *keyFile) { file.Version++ },
+		"scrypt N":   func(file *keyFile) { file.N = 1 << 30 },
+		"scrypt r":   func(file *keyFile) { file.R = 1 << 20 },
+		"scrypt p":   func(file *keyFile) { file.P = 1 << 20 },
+	} {
+		var file keyFile
+		if err = json.Unmarshal(data, &file); err != nil {
+			t.Fatal(err)
+		}
+		damage(&file)
+		damaged, err := json.Marshal(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(path, damaged, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = ks.Load("key", passphrase); err == nil {
+			t.Errorf("key with damaged %s decrypted", name)
+		}
+	}
+
+	if _, err = ks.Load("../key", passphrase); err == nil {
+		t.Error("key loaded from outside the keystore")
+	}
+	if _, err = ks.Load("missing", passphrase); err == nil {
+		t.Error("missing key loaded")
+	}
+}
@@ -2,6 +2,9 @@ package utils
 
 import (
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
@@ -13,6 +16,13 @@ import (
 	"io/ioutil"
 )
 
+// Key algorithms, stored with the keys of accounts
+const (
+	KeyAlgorithmRSA       = "rsa"
+	KeyAlgorithmEd25519   = "ed25519"
+	KeyAlgorithmECDSAP256 = "ecdsa-p256"
+)
+
 // LoadPublicKey loads an parses a PEM encoded private key file.
 func LoadPublicKey(path string) (SignatureValidator, error) {
 	gob.Register(rsaPublicKey{})
@@ -51,31 +61,98 @@ func parsePrivateKey(pemBytes []byte) (SignatureCreator, error) {
 		return nil, errors.New("no key found")
 	}
 
-	var signer rsaPrivateKey
 	switch block.Type {
 	case "RSA PRIVATE KEY":
 		rsa, err := x509.ParsePKCS1PrivateKey(block.Bytes)
 		if err != nil {
 			return nil, err
 		}
-		signer = rsaPrivateKey{rsa}
+		return &rsaPrivateKey{rsa}, nil
+	case "EC PRIVATE KEY":
+		key, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return newSignatureCreator(key)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return newSignatureCreator(key)
 	default:
 		return nil, fmt.Errorf("unsupported key type %q", block.Type)
 	}
-	return &signer, nil
+}
+
+// newSignatureCreator wraps a parsed private key
+func newSignatureCreator(key interface{}) (SignatureCreator, error) {
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return &rsaPrivateKey{key}, nil
+	case ed25519.PrivateKey:
+		return &ed25519PrivateKey{key}, nil
+	case *ecdsa.PrivateKey:
+		if key.Curve != elliptic.P256() {
+			return nil, errors.New("unsupported ECDSA curve, only P-256 is supported")
+		}
+		return &ecdsaPrivateKey{key}, nil
+	default:
+		return nil, fmt.Errorf("unsupported private key %T", key)
+	}
+}
+
+// GenerateKey creates a new private key using the algorithm.
+func GenerateKey(algorithm string) (SignatureCreator, error) {
+	switch algorithm {
+	case KeyAlgorithmRSA:
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		return &rsaPrivateKey{key}, nil
+	case KeyAlgorithmEd25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return &ed25519PrivateKey{key}, nil
+	case KeyAlgorithmECDSAP256:
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsaPrivateKey{key}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key algorithm %q", algorithm)
+	}
+}
+
+// EncodePublicKey returns the PEM encoding of the key, as read by LoadPublicKey.
+func EncodePublicKey(key SignatureValidator) ([]byte, error) {
+	data, err := key.Store()
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: data}), nil
 }
 
 // SignatureCreator creates signatures from a private key.
 type SignatureCreator interface {
 	// Sign returns raw signature for data.
 	Sign(data []byte) ([]byte, error)
+	// PublicKey returns the validator for created signatures.
+	PublicKey() SignatureValidator
 }
 
 // SignatureValidator verifies signatures using a public key.
 type SignatureValidator interface {
 	// CheckSignature checks the signature for data.
 	CheckSignature(data []byte, sig []byte) error
+	// Store returns the PKIX encoding of the key.
 	Store() ([]byte, error)
+	// Algorithm returns the key algorithm, one of the KeyAlgorithm constants.
+	Algorithm() string
 }
 
 type rsaPublicKey struct {
@@ -94,6 +171,11 @@ func (r *rsaPrivateKey) Sign(data []byte) ([]byte, error) {
 	return rsa.SignPKCS1v15(rand.Reader, r.PrivateKey, crypto.SHA256, d)
 }
 
+// PublicKey returns the public part of the key
+func (r *rsaPrivateKey) PublicKey() SignatureValidator {
+	return &rsaPublicKey{&r.PrivateKey.PublicKey}
+}
+
 // CheckSignature verifies the message using the signature
 func (r *rsaPublicKey) CheckSignature(message []byte, sig []byte) error {
 	h := sha256.New()
@@ -107,12 +189,114 @@ func (r *rsaPublicKey) Store() ([]byte, error) {
 	return x509.MarshalPKIXPublicKey(r.PublicKey)
 }
 
-// ParsePublicKey read key from raw storage
+// Algorithm returns the key algorithm
+func (r *rsaPublicKey) Algorithm() string {
+	return KeyAlgorithmRSA
+}
+
+type ed25519PublicKey struct {
+	ed25519.PublicKey
+}
+
+type ed25519PrivateKey struct {
+	ed25519.PrivateKey
+}
+
+// Sign signs data, Ed25519 hashes the data itself
+func (e *ed25519PrivateKey) Sign(data []byte) ([]byte, error) {
+	return ed25519.Sign(e.PrivateKey, data), nil
+}
+
+// PublicKey returns the public part of the key
+func (e *ed25519PrivateKey) PublicKey() SignatureValidator {
+	return &ed25519PublicKey{e.PrivateKey.Public().(ed25519.PublicKey)}
+}
+
+// CheckSignature verifies the message using the signature
+func (e *ed25519PublicKey) CheckSignature(message []byte, sig []byte) error {
+	if !ed25519.Verify(e.PublicKey, message, sig) {
+		return errors.New("ed25519: verification error")
+	}
+	return nil
+}
+
+// Store prepares key for storage
+func (e *ed25519PublicKey) Store() ([]byte, error) {
+	return x509.MarshalPKIXPublicKey(e.PublicKey)
+}
+
+// Algorithm returns the key algorithm
+func (e *ed25519PublicKey) Algorithm() string {
+	return KeyAlgorithmEd25519
+}
+
+type ecdsaPublicKey struct {
+	*ecdsa.PublicKey
+}
+
+type ecdsaPrivateKey struct {
+	*ecdsa.PrivateKey
+}
+
+// Sign signs the sha256 hash of data, the signature is ASN.1 encoded
+func (e *ecdsaPrivateKey) Sign(data []byte) ([]byte, error) {
+	d := sha256.Sum256(data)
+	return ecdsa.SignASN1(rand.Reader, e.PrivateKey, d[:])
+}
+
+// PublicKey returns the public part of the key
+func (e *ecdsaPrivateKey) PublicKey() SignatureValidator {
+	return &ecdsaPublicKey{&e.PrivateKey.PublicKey}
+}
+
+// CheckSignature verifies the message using the signature
+func (e *ecdsaPublicKey) CheckSignature(message []byte, sig []byte) error {
+	d := sha256.Sum256(message)
+	if !ecdsa.VerifyASN1(e.PublicKey, d[:], sig) {
+		return errors.New("ecdsa: verification error")
+	}
+	return nil
+}
+
+// Store prepares key for storage
+func (e *ecdsaPublicKey) Store() ([]byte, error) {
+	return x509.MarshalPKIXPublicKey(e.PublicKey)
+}
+
+// Algorithm returns the key algorithm
+func (e *ecdsaPublicKey) Algorithm() string {
+	return KeyAlgorithmECDSAP256
+}
+
+// ParsePublicKey read key from raw storage, the algorithm is taken from the PKIX encoding
 func ParsePublicKey(data []byte) (SignatureValidator, error) {
 	tmpKey, err := x509.ParsePKIXPublicKey(data)
-	rsaKey, ok := tmpKey.(*rsa.PublicKey)
-	if err != nil || !ok {
-		return nil, errors.New("invalid key type, only RSA is supported")
+	if err != nil {
+		return nil, err
+	}
+	switch key := tmpKey.(type) {
+	case *rsa.PublicKey:
+		return &rsaPublicKey{key}, nil
+	case ed25519.PublicKey:
+		return &ed25519PublicKey{key}, nil
+	case *ecdsa.PublicKey:
+		if key.Curve != elliptic.P256() {
+			return nil, errors.New("unsupported ECDSA curve, only P-256 is supported")
+		}
+		return &ecdsaPublicKey{key}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", tmpKey)
+	}
+}
+
+// ParsePublicKeyWithAlgorithm reads a key stored together with its algorithm, the key must use that algorithm
+func ParsePublicKeyWithAlgorithm(algorithm string, data []byte) (SignatureValidator, error) {
+	key, err := ParsePublicKey(data)
+	if err != nil {
+		return nil, err
+	}
+	if key.Algorithm() != algorithm {
+		return nil, fmt.Errorf("key is not a %s key", algorithm)
 	}
-	return &rsaPublicKey{rsaKey}, nil
+	return key, nil
 }
@@ -0,0 +1,174 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var testAlgorithms = []string{KeyAlgorithmEd25519, KeyAlgorithmECDSAP256}
+
+func generateTestKey(t *testing.T, algorithm string) SignatureCreator {
+	t.Helper()
+	key, err := GenerateKey(algorithm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// Check if signatures verify with the key that made them and fail for other messages
+func TestSignVerify(t *testing.T) {
+	message := []byte("message")
+	for _, algorithm := range testAlgorithms {
+		key := generateTestKey(t, algorithm)
+		if key.PublicKey().Algorithm() != algorithm {
+			t.Errorf("%s: generated a %s key", algorithm, key.PublicKey().Algorithm())
+		}
+		signature, err := key.Sign(message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = key.PublicKey().CheckSignature(message, signature); err != nil {
+			t.Errorf("%s: %v", algorithm, err)
+		}
+		if key.PublicKey().CheckSignature([]byte("other message"), signature) == nil {
+			t.Errorf("%s: signature verified for another message", algorithm)
+		}
+		if generateTestKey(t, algorithm).PublicKey().CheckSignature(message, signature) == nil {
+			t.Errorf("%s: signature verified with another key", algorithm)
+		}
+		signature[0] ^= 1
+		if key.PublicKey().CheckSignature(message, signature) == nil {
+			t.Errorf("%s: damaged signature verified", algorithm)
+		}
+	}
+}
+
+// Check if a signature of one algorithm is rejected by keys of the other algorithms
+func TestCrossAlgorithmSignature(t *testing.T) {
+	message := []byte("message")
+	for _, signer := range testAlgorithms {
+		signature, err := generateTestKey(t, signer).Sign(message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, verifier := range testAlgorithms {
+			if verifier != signer && generateTestKey(t, verifier).PublicKey().CheckSignature(message, signature) == nil {
+				t.Errorf("%s signature verified by a %s key", signer, verifier)
+			}
+		}
+	}
+}
+
+// Check if stored public keys parse back with their algorithm and are rejected for another algorithm
+func TestPublicKeyStore(t *testing.T) {
+	for _, algorithm := range testAlgorithms {
+		key := generateTestKey(t, algorithm)
+		data, err := key.PublicKey().Store()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := ParsePublicKeyWithAlgorithm(algorithm, data)
+		if err != nil {
+			t.Fatalf("%s: %v", algorithm, err)
+		}
+		stored, err := parsed.Store()
+		if err != nil || !bytes.Equal(stored, data) {
+			t.Errorf("%s: key changed by parsing it", algorithm)
+		}
+		signature, err := key.Sign([]byte("message"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = parsed.CheckSignature([]byte("message"), signature); err != nil {
+			t.Errorf("%s: %v", algorithm, err)
+		}
+
+		for _, other := range testAlgorithms {
+			if _, err = ParsePublicKeyWithAlgorithm(other, data); other != algorithm && err == nil {
+				t.Errorf("%s key parsed as a %s key", algorithm, other)
+			}
+		}
+	}
+	if _, err := GenerateKey("dsa"); err == nil {
+		t.Error("generated a key of an unknown algorithm")
+	}
+}
+
+// Check if PKCS#8 and PEM encoded private keys import and their public keys export as read by LoadPublicKey
+func TestImportExportKeys(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, algorithm := range testAlgorithms {
+		key := generateTestKey(t, algorithm)
+		der, err := marshalPrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blocks := []*pem.Block{{Type: "PRIVATE KEY", Bytes: der}}
+		if ecdsaKey, ok := key.(*ecdsaPrivateKey); ok {
+			sec1, err := x509.MarshalECPrivateKey(ecdsaKey.PrivateKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			blocks = append(blocks, &pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1})
+		}
+
+		for _, block := range blocks {
+			path := filepath.Join(dir, algorithm+".pem")
+			err = ioutil.WriteFile(path, pem.EncodeToMemory(block), 0600)
+			if err != nil {
+				t.Fatal(err)
+			}
+			imported, err := LoadPrivateKey(path)
+			if err != nil {
+				t.Fatalf("%s %s: %v", algorithm, block.Type, err)
+			}
+			signature, err := imported.Sign([]byte("message"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = key.PublicKey().CheckSignature([]byte("message"), signature); err != nil {
+				t.Errorf("%s %s: imported key differs: %v", algorithm, block.Type, err)
+			}
+		}
+
+		exported, err := EncodePublicKey(key.PublicKey())
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, algorithm+".pub.pem")
+		err = ioutil.WriteFile(path, exported, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		public, err := LoadPublicKey(path)
+		if err != nil {
+			t.Fatalf("%s: %v", algorithm, err)
+		}
+		stored, _ := public.Store()
+		original, _ := key.PublicKey().Store()
+		if public.Algorithm() != algorithm || !bytes.Equal(stored, original) {
+			t.Errorf("%s: exported public key differs", algorithm)
+		}
+	}
+
+	if _, err = parsePrivateKey([]byte("not a key")); err == nil {
+		t.Error("parsed a private key without a PEM block")
+	}
+	if _, err = parsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("damaged")})); err == nil {
+		t.Error("parsed a damaged PKCS#8 key")
+	}
+	if _, err = parsePublicKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("key")})); err == nil {
+		t.Error("parsed a private key block as public key")
+	}
+}